@@ -18,6 +18,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"strings"
 
@@ -33,13 +34,13 @@ import (
 
 	nodeInfoManager "github.com/IBM/ibm-csi-common/pkg/metadata"
 	"github.com/IBM/ibm-csi-common/pkg/metrics"
-	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"github.com/IBM/ibmcloud-volume-vpc/pkg/watcher"
 	csiConfig "github.com/kubernetes-sigs/ibm-vpc-block-csi-driver/config"
 	driver "github.com/kubernetes-sigs/ibm-vpc-block-csi-driver/pkg/ibmcsidriver"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 func init() {
@@ -52,6 +53,8 @@ var (
 	endpoint             = flag.String("endpoint", "unix:/tmp/csi.sock", "CSI endpoint")
 	metricsAddress       = flag.String("metrics-address", "0.0.0.0:9080", "Metrics address")
 	extraVolumeLabelsStr = flag.String("extra-labels", "", "Extra labels to tag all volumes created by driver. It is a comma separated list of key value pairs like '<key1>:<value1>,<key2>:<value2>'.")
+	userAgentSuffix      = flag.String("user-agent-suffix", "", "Suffix appended to the User-Agent of the VPC API requests made by the driver.")
+	hostMountPath        = flag.String("host-mount-path", "", "Host mount namespace e.g /host/proc/1/ns/mnt. If the driver runs in another mount namespace, the volumes are mounted in the host mount namespace with nsenter.")
 	vendorVersion        string
 	logger               *zap.Logger
 )
@@ -96,11 +99,21 @@ func handle(logger *zap.Logger) {
 		logger.Fatal("Failed to instantiate IKS-Storage provider", zap.Error(err))
 	}
 
+	userAgent := driver.GetUserAgent(vendorVersion, ibmcloudProvider.GetClusterID(), *userAgentSuffix)
+	if err = driver.SetProviderUserAgent(ibmcloudProvider, userAgent); err != nil {
+		logger.Warn("Failed to set User-Agent for the provider", zap.Error(err))
+	} else {
+		logger.Info("VPC API requests User-Agent", zap.String("UserAgent", userAgent))
+	}
+
 	// Setup CSI Driver
 	ibmCSIDriver := driver.GetIBMCSIDriver()
 
 	// Get new instance for the Mount Manager
-	mounter := mountManager.NewNodeMounter()
+	mounter, hostNamespaceMounts := driver.NewNodeMounter(*hostMountPath)
+	if hostNamespaceMounts {
+		logger.Info("Mounting volumes in the host mount namespace", zap.String("HostMountPath", *hostMountPath))
+	}
 
 	nodeName := os.Getenv("KUBE_NODE_NAME")
 
@@ -116,9 +129,31 @@ func handle(logger *zap.Logger) {
 	}
 
 	logger.Info("Successfully initialized driver...")
-	serveMetrics()
+	ibmCSIDriver.SetKubeClient(k8sClient.Clientset, wait.NeverStop)
+	shutdownTracing, err := driver.SetupTracing(logger, csiConfig.CSIDriverName, vendorVersion)
+	if err != nil {
+		logger.Fatal("Failed to setup tracing...", zap.Error(err))
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+	serveMetrics(ibmCSIDriver)
+	// Report staging mounts left behind by a kubelet/driver crash if its node POD
+	if os.Getenv("IS_NODE_SERVER") == "true" {
+		cleanup := os.Getenv("CLEANUP_ORPHANED_STAGING_MOUNTS") == "true"
+		if err := ibmCSIDriver.CheckOrphanedStagingMounts(k8sClient.Clientset, nodeName, cleanup); err != nil {
+			logger.Warn("Failed to check orphaned staging mounts", zap.Error(err))
+		}
+	}
+	startPVWatcher := strings.Contains(os.Getenv("POD_NAME"), "csi-controller") && strings.Contains(os.Getenv("IKS_ENABLED"), "True")
+	ibmCSIDriver.LogStartupSummary(map[string]bool{
+		"metrics":                      true,
+		"tracing":                      os.Getenv("TRACING_OTLP_ENDPOINT") != "",
+		"pvWatcher":                    startPVWatcher,
+		"orphanedStagingMountsCleanup": os.Getenv("IS_NODE_SERVER") == "true" && os.Getenv("CLEANUP_ORPHANED_STAGING_MOUNTS") == "true",
+	})
 	// Start PV watcher if its controller POD
-	if strings.Contains(os.Getenv("POD_NAME"), "csi-controller") && strings.Contains(os.Getenv("IKS_ENABLED"), "True") {
+	if startPVWatcher {
 		pvwatcher := watcher.New(logger, csiConfig.CSIDriverName, csiConfig.CSIProviderVolumeType, ibmcloudProvider)
 		go pvwatcher.Start()
 	}
@@ -126,14 +161,29 @@ func handle(logger *zap.Logger) {
 	ibmCSIDriver.Run(*endpoint)
 }
 
-func serveMetrics() {
+func serveMetrics(ibmCSIDriver *driver.IBMCSIDriver) {
 	logger.Info("Starting metrics endpoint")
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
+		// Readiness of the CSI socket, distinct from the liveness probe
+		http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			if !ibmCSIDriver.IsReady() {
+				http.Error(w, "CSI socket not ready", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		})
+		// Reachability of the VPC API by the controller, distinct from the readiness of the CSI socket
+		http.HandleFunc("/livez", ibmCSIDriver.ServeLiveness)
+		// Recent attach/detach operations of a volume, e.g /debug/volume-operations?volumeID=<volume ID>
+		http.HandleFunc("/debug/volume-operations", ibmCSIDriver.ServeVolumeOperations)
+		// Effective provider endpoints, credentials redacted
+		http.HandleFunc("/debug/config", ibmCSIDriver.ServeConfig)
 		//http.Handle("/health-check", healthCheck)
 		err := http.ListenAndServe(*metricsAddress, nil) // #nosec G114: use default timeout.
 		logger.Error("Failed to start metrics service:", zap.Error(err))
 	}()
 	metrics.RegisterAll(csiConfig.CSIDriverGithubName)
 	libMetrics.RegisterAll()
+	driver.RegisterMetrics()
 }
@@ -0,0 +1,296 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// apiRateLimitErrors backend error codes, or texts, returned when the VPC API rate limit is exceeded (HTTP 429)
+var apiRateLimitErrors = []string{"rate_limit_exceeded", "too_many_requests", "Too Many Requests"}
+
+// errAPIRateLimitWait is returned when the request cannot get a token of the VPC API rate limiter before its deadline
+var errAPIRateLimitWait = errors.New("VPC API rate limit reached")
+
+// apiRateLimiterMinLimitDivisor the rate limit is never lowered below the configured rate divided by this value
+const apiRateLimiterMinLimitDivisor = 8
+
+// apiRateLimiter is a token bucket shared by all the VPC API calls of the controller. The rate is halved every
+// time the API returns 429 and restored step by step on the successful calls. A nil apiRateLimiter does not
+// limit anything.
+type apiRateLimiter struct {
+	mu       sync.Mutex
+	limiter  *rate.Limiter
+	maxLimit rate.Limit
+	minLimit rate.Limit
+}
+
+// newAPIRateLimiter returns a limiter allowing ratePerSecond calls per second with bursts of burst calls,
+// nil if ratePerSecond is not positive. The burst defaults to ratePerSecond.
+func newAPIRateLimiter(ratePerSecond int, burst int) *apiRateLimiter {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = ratePerSecond
+	}
+	return &apiRateLimiter{
+		limiter:  rate.NewLimiter(rate.Limit(ratePerSecond), burst),
+		maxLimit: rate.Limit(ratePerSecond),
+		minLimit: rate.Limit(ratePerSecond) / apiRateLimiterMinLimitDivisor,
+	}
+}
+
+// newVPCAPIRateLimiter returns the rate limiter of the VPC API calls of the controller. VPC_API_RATE_LIMIT sets the
+// number of calls per second (unset or 0 means no limit) and VPC_API_RATE_BURST the number of calls allowed at once.
+func newVPCAPIRateLimiter(logger *zap.Logger) *apiRateLimiter {
+	ratePerSecond := getNonNegativeIntEnv(logger, "VPC_API_RATE_LIMIT", 0)
+	burst := getNonNegativeIntEnv(logger, "VPC_API_RATE_BURST", 0)
+	if ratePerSecond > 0 && logger != nil {
+		logger.Info("Rate limiting VPC API calls", zap.Int("Rate", ratePerSecond), zap.Int("Burst", burst))
+	}
+	return newAPIRateLimiter(ratePerSecond, burst)
+}
+
+// wait blocks until a call is allowed. It returns errAPIRateLimitWait if the call cannot be made before the
+// context is done.
+func (l *apiRateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	err := l.limiter.Wait(ctx)
+	l.recordSaturation()
+	if err != nil {
+		return fmt.Errorf("%w, retry later: %v", errAPIRateLimitWait, err)
+	}
+	return nil
+}
+
+// observe adapts the rate to the result of a call, the rate is halved if the API returned 429 and increased by
+// a tenth of the configured rate on success
+func (l *apiRateLimiter) observe(ctxLogger *zap.Logger, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.limiter.Limit()
+	if err != nil {
+		if !matchBackendError(err, apiRateLimitErrors) {
+			return
+		}
+		next := current / 2
+		if next < l.minLimit {
+			next = l.minLimit
+		}
+		l.limiter.SetLimit(next)
+		ctxLogger.Warn("VPC API rate limit exceeded, backing off", zap.Float64("Rate", float64(next)), zap.Error(err))
+	} else if current < l.maxLimit {
+		next := current + l.maxLimit/10
+		if next > l.maxLimit {
+			next = l.maxLimit
+		}
+		l.limiter.SetLimit(next)
+	}
+	l.recordSaturation()
+}
+
+// recordSaturation records the share of the burst which is used, 1 when the calls wait for tokens
+func (l *apiRateLimiter) recordSaturation() {
+	saturation := 1 - l.limiter.Tokens()/float64(l.limiter.Burst())
+	if saturation < 0 {
+		saturation = 0
+	} else if saturation > 1 {
+		saturation = 1
+	}
+	vpcAPIRateLimiterSaturation.Set(saturation)
+}
+
+// rateLimitedSession makes the VPC API calls of the session through the rate limiter
+type rateLimitedSession struct {
+	provider.Session
+	ctx       context.Context
+	ctxLogger *zap.Logger
+	limiter   *apiRateLimiter
+}
+
+// statusError returns an error for the 429 http responses, which are not always reported as errors
+func statusError(response *http.Response, err error) error {
+	if err == nil && response != nil && response.StatusCode == http.StatusTooManyRequests {
+		return errors.New(http.StatusText(http.StatusTooManyRequests))
+	}
+	return err
+}
+
+// CreateVolume ...
+func (s *rateLimitedSession) CreateVolume(volumeRequest provider.Volume) (*provider.Volume, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	volume, err := s.Session.CreateVolume(volumeRequest)
+	s.limiter.observe(s.ctxLogger, err)
+	return volume, err
+}
+
+// DeleteVolume ...
+func (s *rateLimitedSession) DeleteVolume(volume *provider.Volume) error {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return err
+	}
+	err := s.Session.DeleteVolume(volume)
+	s.limiter.observe(s.ctxLogger, err)
+	return err
+}
+
+// GetVolume ...
+func (s *rateLimitedSession) GetVolume(id string) (*provider.Volume, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	volume, err := s.Session.GetVolume(id)
+	s.limiter.observe(s.ctxLogger, err)
+	return volume, err
+}
+
+// GetVolumeByName ...
+func (s *rateLimitedSession) GetVolumeByName(name string) (*provider.Volume, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	volume, err := s.Session.GetVolumeByName(name)
+	s.limiter.observe(s.ctxLogger, err)
+	return volume, err
+}
+
+// ListVolumes ...
+func (s *rateLimitedSession) ListVolumes(limit int, start string, tags map[string]string) (*provider.VolumeList, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	volumes, err := s.Session.ListVolumes(limit, start, tags)
+	s.limiter.observe(s.ctxLogger, err)
+	return volumes, err
+}
+
+// ExpandVolume ...
+func (s *rateLimitedSession) ExpandVolume(expandVolumeRequest provider.ExpandVolumeRequest) (int64, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return 0, err
+	}
+	capacity, err := s.Session.ExpandVolume(expandVolumeRequest)
+	s.limiter.observe(s.ctxLogger, err)
+	return capacity, err
+}
+
+// AttachVolume ...
+func (s *rateLimitedSession) AttachVolume(attachRequest provider.VolumeAttachmentRequest) (*provider.VolumeAttachmentResponse, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	response, err := s.Session.AttachVolume(attachRequest)
+	s.limiter.observe(s.ctxLogger, err)
+	return response, err
+}
+
+// WaitForAttachVolume ...
+func (s *rateLimitedSession) WaitForAttachVolume(attachRequest provider.VolumeAttachmentRequest) (*provider.VolumeAttachmentResponse, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	response, err := s.Session.WaitForAttachVolume(attachRequest)
+	s.limiter.observe(s.ctxLogger, err)
+	return response, err
+}
+
+// DetachVolume ...
+func (s *rateLimitedSession) DetachVolume(detachRequest provider.VolumeAttachmentRequest) (*http.Response, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	response, err := s.Session.DetachVolume(detachRequest)
+	s.limiter.observe(s.ctxLogger, statusError(response, err))
+	return response, err
+}
+
+// WaitForDetachVolume ...
+func (s *rateLimitedSession) WaitForDetachVolume(detachRequest provider.VolumeAttachmentRequest) error {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return err
+	}
+	err := s.Session.WaitForDetachVolume(detachRequest)
+	s.limiter.observe(s.ctxLogger, err)
+	return err
+}
+
+// CreateSnapshot ...
+func (s *rateLimitedSession) CreateSnapshot(sourceVolumeID string, snapshotParameters provider.SnapshotParameters) (*provider.Snapshot, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.Session.CreateSnapshot(sourceVolumeID, snapshotParameters)
+	s.limiter.observe(s.ctxLogger, err)
+	return snapshot, err
+}
+
+// DeleteSnapshot ...
+func (s *rateLimitedSession) DeleteSnapshot(snapshot *provider.Snapshot) error {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return err
+	}
+	err := s.Session.DeleteSnapshot(snapshot)
+	s.limiter.observe(s.ctxLogger, err)
+	return err
+}
+
+// GetSnapshot ...
+func (s *rateLimitedSession) GetSnapshot(snapshotID string) (*provider.Snapshot, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.Session.GetSnapshot(snapshotID)
+	s.limiter.observe(s.ctxLogger, err)
+	return snapshot, err
+}
+
+// GetSnapshotByName ...
+func (s *rateLimitedSession) GetSnapshotByName(snapshotName string) (*provider.Snapshot, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.Session.GetSnapshotByName(snapshotName)
+	s.limiter.observe(s.ctxLogger, err)
+	return snapshot, err
+}
+
+// ListSnapshots ...
+func (s *rateLimitedSession) ListSnapshots(limit int, start string, tags map[string]string) (*provider.SnapshotList, error) {
+	if err := s.limiter.wait(s.ctx); err != nil {
+		return nil, err
+	}
+	snapshots, err := s.Session.ListSnapshots(limit, start, tags)
+	s.limiter.observe(s.ctxLogger, err)
+	return snapshots, err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIRateLimiterBackoff(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// disabled limiter
+	var disabled *apiRateLimiter
+	assert.Nil(t, newAPIRateLimiter(0, 10))
+	assert.Nil(t, disabled.wait(context.Background()))
+	disabled.observe(logger, nil)
+
+	limiter := newAPIRateLimiter(16, 0)
+	assert.Equal(t, 16, limiter.limiter.Burst())
+	tooManyRequests := providerError.Message{Code: "rate_limit_exceeded", Description: "Too Many Requests"}
+
+	// 429 halves the rate down to a floor
+	limiter.observe(logger, tooManyRequests)
+	assert.Equal(t, rate.Limit(8), limiter.limiter.Limit())
+	for i := 0; i < 5; i++ {
+		limiter.observe(logger, tooManyRequests)
+	}
+	assert.Equal(t, rate.Limit(2), limiter.limiter.Limit())
+
+	// other errors leave the rate unchanged
+	limiter.observe(logger, errors.New("volume not found"))
+	assert.Equal(t, rate.Limit(2), limiter.limiter.Limit())
+
+	// successful calls restore the configured rate
+	limiter.observe(logger, nil)
+	assert.InDelta(t, 3.6, float64(limiter.limiter.Limit()), 0.001)
+	for i := 0; i < 20; i++ {
+		limiter.observe(logger, nil)
+	}
+	assert.Equal(t, rate.Limit(16), limiter.limiter.Limit())
+}
+
+func TestAPIRateLimiterWait(t *testing.T) {
+	limiter := newAPIRateLimiter(1, 1)
+	assert.Nil(t, limiter.wait(context.Background()))
+
+	// the bucket is empty, the next token comes after the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := limiter.wait(ctx)
+	assert.True(t, errors.Is(err, errAPIRateLimitWait))
+}
+
+func TestRateLimitedSession(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	t.Setenv("VPC_API_RATE_LIMIT", "1")
+	icDriver := initIBMCSIDriver(t)
+	icDriver.cs.apiLimiter = newVPCAPIRateLimiter(logger)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+
+	// 429 of the backend backs off
+	fakeStructSession.ListVolumesReturns(nil, providerError.Message{Code: "rate_limit_exceeded", Description: "Too Many Requests", Type: providerError.RetrivalFailed})
+	_, err = icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 10})
+	assert.NotNil(t, err)
+	assert.Equal(t, rate.Limit(0.5), icDriver.cs.apiLimiter.limiter.Limit())
+
+	// calls which cannot get a token before the deadline are not sent and retried
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = icDriver.cs.ListVolumes(ctx, &csi.ListVolumesRequest{MaxEntries: 10})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, fakeStructSession.ListVolumesCallCount())
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getProfileVolumeLimit returns the max number of volumes attachable to an instance of the profile from
+// VOLUME_ATTACHMENT_LIMIT_BY_PROFILE e.g "*:12;bx2-2x8:8", where "*" applies to the profiles not listed.
+// 0 means the limit of the profile is not known
+func getProfileVolumeLimit(profile string) (int, error) {
+	// Instance type node labels use '.' where the VPC profile names use '-' e.g bx2.2x8
+	profile = strings.ReplaceAll(profile, ".", "-")
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(os.Getenv("VOLUME_ATTACHMENT_LIMIT_BY_PROFILE"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		name, value, found := strings.Cut(entry, ":")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !found || err != nil || limit < 0 {
+			return 0, fmt.Errorf("<%s> is not a valid entry, expecting <instance profile>:<max volumes>", entry)
+		}
+		limits[strings.ReplaceAll(strings.TrimSpace(name), ".", "-")] = limit
+	}
+	if limit, ok := limits[profile]; ok {
+		return limit, nil
+	}
+	return limits[defaultProfileLimitKey], nil
+}
+
+// getInstanceProfile returns the instance profile of the node from its instance type label, empty if it is not known
+func (csiNS *CSINodeServer) getInstanceProfile(ctx context.Context, ctxLogger *zap.Logger, nodeName string) string {
+	if csiNS.kubeClient == nil || len(nodeName) == 0 {
+		return ""
+	}
+	node, err := csiNS.kubeClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		ctxLogger.Warn("Unable to get the instance profile of the node", zap.String("NodeName", nodeName), zap.Error(err))
+		return ""
+	}
+	return node.Labels[InstanceTypeLabel]
+}
+
+// getInstanceProfileFamily returns the family of the instance profile e.g bx2 for bx2-2x8 or bx2.2x8
+func getInstanceProfileFamily(profile string) string {
+	family, _, _ := strings.Cut(strings.ReplaceAll(profile, ".", "-"), "-")
+	return family
+}
+
+// getInstanceProfileVolumeLimit returns the max number of volumes attachable to an instance of the profile,
+// 0 if it is not known
+func getInstanceProfileVolumeLimit(ctxLogger *zap.Logger, profile string) int64 {
+	if len(profile) == 0 {
+		return 0
+	}
+	limit, err := getProfileVolumeLimit(profile)
+	if err != nil {
+		ctxLogger.Warn("Ignoring invalid VOLUME_ATTACHMENT_LIMIT_BY_PROFILE", zap.Error(err))
+		return 0
+	}
+	ctxLogger.Info("Instance profile volume limit", zap.String("Profile", profile), zap.Int("Limit", limit))
+	return int64(limit)
+}
+
+// getNodeAttachLimit returns the name and the attach limit of the node as reported by its CSINode, from the
+// instance profile of the node in NodeGetInfo. The limit is 0 if the node reports none.
+func getNodeAttachLimit(csiNodes []*storagev1.CSINode, driverName string, nodeID string) (string, int) {
+	for _, csiNode := range csiNodes {
+		for _, driver := range csiNode.Spec.Drivers {
+			if driver.Name != driverName || driver.NodeID != nodeID {
+				continue
+			}
+			if driver.Allocatable != nil && driver.Allocatable.Count != nil {
+				return csiNode.Name, int(*driver.Allocatable.Count)
+			}
+			return csiNode.Name, 0
+		}
+	}
+	return "", 0
+}
+
+// checkNodeAttachLimit returns a ResourceExhausted error if the node already has its max number of volumes attached,
+// other than the volume to attach. The limit is not enforced if it cannot be determined.
+func (csiCS *CSIControllerServer) checkNodeAttachLimit(ctxLogger *zap.Logger, nodeID string, volumeID string) error {
+	if csiCS.kubeCache == nil {
+		return nil
+	}
+	if !csiCS.kubeCache.hasSynced() {
+		ctxLogger.Warn("Unable to check the attach limit of the node, kubernetes objects not synced yet", zap.String("NodeID", nodeID))
+		return nil
+	}
+	nodeName, limit := getNodeAttachLimit(csiCS.kubeCache.listCSINodes(), csiCS.Driver.name, nodeID)
+	if limit == 0 {
+		return nil
+	}
+	attachedVolumes := nodeAttachedVolumes(csiCS.kubeCache.listVolumeAttachments(), csiCS.kubeCache.listPersistentVolumes(), csiCS.Driver.name, nodeName, true)
+	delete(attachedVolumes, volumeID)
+	ctxLogger.Info("Node attach limit", zap.String("NodeID", nodeID), zap.Int("Attached", len(attachedVolumes)), zap.Int("Limit", limit))
+	if len(attachedVolumes) >= limit {
+		return status.Errorf(codes.ResourceExhausted, "node %s has reached its limit of %d attached volumes", nodeID, limit)
+	}
+	return nil
+}
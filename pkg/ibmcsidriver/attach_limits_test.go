@@ -0,0 +1,166 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetProfileVolumeLimit(t *testing.T) {
+	limit, err := getProfileVolumeLimit("bx2-2x8")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, limit)
+
+	t.Setenv("VOLUME_ATTACHMENT_LIMIT_BY_PROFILE", "*:12; bx2-2x8:8")
+	limit, err = getProfileVolumeLimit("bx2.2x8")
+	assert.Nil(t, err)
+	assert.Equal(t, 8, limit)
+	limit, err = getProfileVolumeLimit("mx2-16x128")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, limit)
+
+	t.Setenv("VOLUME_ATTACHMENT_LIMIT_BY_PROFILE", "bx2-2x8=8")
+	_, err = getProfileVolumeLimit("bx2-2x8")
+	assert.NotNil(t, err)
+}
+
+func TestGetInstanceProfileFamily(t *testing.T) {
+	assert.Equal(t, "bx2", getInstanceProfileFamily("bx2-2x8"))
+	assert.Equal(t, "cx3d", getInstanceProfileFamily("cx3d.4x10"))
+	assert.Equal(t, "", getInstanceProfileFamily(""))
+}
+
+func TestNodeGetInfoInstanceProfile(t *testing.T) {
+	t.Setenv("KUBE_NODE_NAME", "testnode")
+	t.Setenv("VOLUME_ATTACHMENT_LIMIT_BY_PROFILE", "*:12;bx2-2x8:8")
+	icDriver := initIBMCSIDriver(t)
+	icDriver.ns.kubeClient = k8sfake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "testnode", Labels: map[string]string{InstanceTypeLabel: "bx2.2x8"}},
+	})
+
+	resp, err := icDriver.ns.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), resp.MaxVolumesPerNode)
+	assert.Equal(t, map[string]string{utils.NodeRegionLabel: "testregion", utils.NodeZoneLabel: "testzone", InstanceProfileFamilyLabel: "bx2"}, resp.AccessibleTopology.Segments)
+
+	// unknown node
+	t.Setenv("KUBE_NODE_NAME", "othernode")
+	resp, err = icDriver.ns.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(DefaultVolumesPerNode), resp.MaxVolumesPerNode)
+	assert.Equal(t, map[string]string{utils.NodeRegionLabel: "testregion", utils.NodeZoneLabel: "testzone"}, resp.AccessibleTopology.Segments)
+}
+
+func TestControllerPublishVolumeAttachLimit(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	fakeStructSession.GetVolumeReturns(&provider.Volume{VolumeID: "vol123"}, nil)
+	attachResponse := &provider.VolumeAttachmentResponse{VolumeAttachmentRequest: provider.VolumeAttachmentRequest{VolumeID: "vol123", InstanceID: "node123", VPCVolumeAttachment: &provider.VolumeAttachment{DevicePath: "/tmp"}}}
+	fakeStructSession.AttachVolumeReturns(attachResponse, nil)
+	fakeStructSession.WaitForAttachVolumeReturns(attachResponse, nil)
+
+	limit := int32(2)
+	objects := []runtime.Object{&storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: "testnode"},
+		Spec: storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{{
+			Name: icDriver.name, NodeID: "node123", Allocatable: &storagev1.VolumeNodeResources{Count: &limit},
+		}}},
+	}}
+	for _, volumeID := range []string{"vol-a", "vol-b"} {
+		pvName := "pv-" + volumeID
+		objects = append(objects,
+			&corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: pvName},
+				Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: icDriver.name, VolumeHandle: volumeID},
+				}},
+			},
+			&storagev1.VolumeAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: "va-" + volumeID},
+				Spec: storagev1.VolumeAttachmentSpec{
+					Attacher: icDriver.name,
+					NodeName: "testnode",
+					Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				},
+				Status: storagev1.VolumeAttachmentStatus{Attached: true},
+			})
+	}
+	// being attached or detached, not counted
+	pvName := "pv-vol-c"
+	deletionTime := metav1.Now()
+	objects = append(objects,
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-vol-c"},
+			Spec:       storagev1.VolumeAttachmentSpec{Attacher: icDriver.name, NodeName: "testnode", Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName}},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-vol-d", DeletionTimestamp: &deletionTime, Finalizers: []string{"external-attacher/vpc-block-csi-driver"}},
+			Spec:       storagev1.VolumeAttachmentSpec{Attacher: icDriver.name, NodeName: "testnode", Source: storagev1.VolumeAttachmentSource{InlineVolumeSpec: &corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: icDriver.name, VolumeHandle: "vol-d"}}}}},
+			Status:     storagev1.VolumeAttachmentStatus{Attached: true},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pvName},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: icDriver.name, VolumeHandle: "vol-c"},
+			}},
+		})
+	clientset := k8sfake.NewSimpleClientset(objects...)
+	setKubeClient(t, icDriver, clientset)
+	req := &csi.ControllerPublishVolumeRequest{VolumeId: "vol123", NodeId: "node123", VolumeCapability: stdVolCap[0]}
+
+	// node is full
+	_, err = icDriver.cs.ControllerPublishVolume(context.Background(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "limit of 2")
+	assert.Equal(t, 0, fakeStructSession.AttachVolumeCallCount())
+
+	// a volume was detached
+	assert.Nil(t, clientset.StorageV1().VolumeAttachments().Delete(context.Background(), "va-vol-b", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool { return len(icDriver.cs.kubeCache.listVolumeAttachments()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	_, err = icDriver.cs.ControllerPublishVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakeStructSession.AttachVolumeCallCount())
+
+	// nodes without CSINode are not limited
+	req.NodeId = "node456"
+	_, err = icDriver.cs.ControllerPublishVolume(context.Background(), req)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	commonError "github.com/IBM/ibm-csi-common/pkg/messages"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	userError "github.com/IBM/ibmcloud-volume-vpc/common/messages"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// backendErrorDomain domain of the error details of the backend errors
+const backendErrorDomain = "iaas.cloud.ibm.com"
+
+// backendErrorOverride maps a backend error code, or a text found in the backend error, to a gRPC code
+type backendErrorOverride struct {
+	match string
+	code  codes.Code
+}
+
+// grpcCodeNames gRPC codes which can be set in BACKEND_ERROR_CODE_OVERRIDES, OK is not allowed as it would hide the error
+var grpcCodeNames = func() map[string]codes.Code {
+	names := make(map[string]codes.Code)
+	for c := codes.Canceled; c <= codes.Unauthenticated; c++ {
+		names[c.String()] = c
+	}
+	return names
+}()
+
+// getBackendErrorOverrides returns the overrides set in BACKEND_ERROR_CODE_OVERRIDES e.g
+// "volume_capacity_max=OutOfRange;over_limit=ResourceExhausted". The gRPC code decides whether the sidecars
+// retry the call, e.g Unavailable or Aborted are retried while InvalidArgument or FailedPrecondition are final.
+// Exact backend error codes are matched first, then the texts in the order of the longest first.
+func getBackendErrorOverrides() ([]backendErrorOverride, error) {
+	overrides := []backendErrorOverride{}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv("BACKEND_ERROR_CODE_OVERRIDES"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		match, codeName, found := strings.Cut(entry, "=")
+		match = strings.TrimSpace(match)
+		code, ok := grpcCodeNames[strings.TrimSpace(codeName)]
+		if !found || len(match) == 0 || !ok {
+			return nil, fmt.Errorf("<%s> is not a valid entry, expecting <backend error code or text>=<gRPC code> e.g over_limit=ResourceExhausted", entry)
+		}
+		if seen[match] {
+			return nil, fmt.Errorf("<%s> is overridden more than once", match)
+		}
+		seen[match] = true
+		overrides = append(overrides, backendErrorOverride{match: match, code: code})
+	}
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return len(overrides[i].match) > len(overrides[j].match)
+	})
+	return overrides, nil
+}
+
+// snapshotBusyErrors backend error codes, or texts, returned when deleting a snapshot which is still in use
+// e.g being restored or cloned, or which is already being deleted. The deletion succeeds once the operation completes.
+var snapshotBusyErrors = []string{"snapshot_in_use", "snapshot_busy", "snapshot_deleting", "is being deleted"}
+
+// snapshotDependentErrors backend error codes, or texts, returned when deleting a snapshot which has dependents
+// e.g copies or clones, they must be removed first
+var snapshotDependentErrors = []string{"snapshot_has_dependents", "snapshot_has_clones", "snapshot_has_copies"}
+
+// zoneCapacityErrors backend error codes, or texts, returned when the zone has no capacity left for the volume
+var zoneCapacityErrors = []string{"insufficient_capacity", "zone_capacity_exhausted", "out of capacity"}
+
+// matchBackendError returns true if the backend error code is one of the matches or the backend error contains one of them
+func matchBackendError(err error, matches []string) bool {
+	errorCode := userError.GetUserErrorCode(err)
+	for _, match := range matches {
+		if match == errorCode || strings.Contains(err.Error(), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBackendNotFoundError returns true if the VPC API reported the resource as not found. The provider library wraps
+// every VPC API error in its own error e.g FailedToDeleteVolume, whose code, type and RC say nothing of the cause, so
+// the wrapped VPC API error is checked
+func isBackendNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	backendError := err.Error()
+	var msg providerError.Message
+	if errors.As(err, &msg) {
+		backendError = msg.BackendError
+	}
+	if strings.Contains(backendError, "not_found") {
+		return true
+	}
+	match := httpStatusPattern.FindStringSubmatch(backendError)
+	return match != nil && match[1] == "404"
+}
+
+// vpcErrorCodes built-in gRPC codes of the VPC API error codes, or texts. Retriable errors e.g throttling return
+// Unavailable, while errors which would fail again e.g invalid input return InvalidArgument.
+var vpcErrorCodes = []backendErrorOverride{
+	{match: "rate_limit", code: codes.Unavailable},
+	{match: "too_many_requests", code: codes.Unavailable},
+	{match: "over_limit", code: codes.ResourceExhausted},
+	{match: "quota_exceeded", code: codes.ResourceExhausted},
+	{match: "not_found", code: codes.NotFound},
+	{match: "validation_", code: codes.InvalidArgument},
+	{match: "bad_field", code: codes.InvalidArgument},
+	{match: "conflict", code: codes.Aborted},
+}
+
+// httpStatusPattern HTTP status of the VPC API response, as reported in the backend error e.g RC:429
+var httpStatusPattern = regexp.MustCompile(`RC:\s*(\d{3})`)
+
+// httpStatusCodes built-in gRPC codes of the HTTP status of the VPC API response
+var httpStatusCodes = map[int]codes.Code{
+	400: codes.InvalidArgument,
+	401: codes.Unauthenticated,
+	403: codes.PermissionDenied,
+	404: codes.NotFound,
+	409: codes.Aborted,
+	422: codes.InvalidArgument,
+	429: codes.Unavailable,
+	500: codes.Internal,
+	502: codes.Unavailable,
+	503: codes.Unavailable,
+	504: codes.Unavailable,
+}
+
+// classifyVPCError returns the gRPC code of the backend error from its VPC API error code, then from the HTTP status
+// of the VPC API response. False if the error is not known
+func classifyVPCError(err error) (codes.Code, bool) {
+	if code, ok := classifyBackendError(vpcErrorCodes, err); ok {
+		return code, true
+	}
+	if err == nil {
+		return codes.OK, false
+	}
+	if match := httpStatusPattern.FindStringSubmatch(err.Error()); match != nil {
+		httpStatus, _ := strconv.Atoi(match[1])
+		if code, ok := httpStatusCodes[httpStatus]; ok {
+			return code, true
+		}
+	}
+	return codes.OK, false
+}
+
+// withBackendErrorDetails adds the backend error to the details of the CSI error, so that the original VPC error
+// is available to the callers whatever the gRPC code
+func withBackendErrorDetails(csiErr error, err error) error {
+	withDetails, detailsErr := status.Convert(csiErr).WithDetails(&errdetails.ErrorInfo{
+		Reason:   userError.GetUserErrorCode(err),
+		Domain:   backendErrorDomain,
+		Metadata: map[string]string{"backendError": err.Error()},
+	})
+	if detailsErr != nil {
+		return csiErr
+	}
+	return withDetails.Err()
+}
+
+// classifyBackendError returns the overridden gRPC code of the backend error, false if no override matches
+func classifyBackendError(overrides []backendErrorOverride, err error) (codes.Code, bool) {
+	if err == nil || len(overrides) == 0 {
+		return codes.OK, false
+	}
+	errorCode := userError.GetUserErrorCode(err)
+	for _, override := range overrides {
+		if override.match == errorCode {
+			return override.code, true
+		}
+	}
+	for _, override := range overrides {
+		if strings.Contains(err.Error(), override.match) {
+			return override.code, true
+		}
+	}
+	return codes.OK, false
+}
+
+// getCSIBackendError returns the CSI error of a backend error, using the configured override if any, the
+// VPC API error code or HTTP status otherwise, and the classification of commonError.GetCSIBackendError
+// for the unknown errors. Calls held back by the VPC API rate limiter return Unavailable so they are retried.
+// The backend error is kept in the details of the CSI error.
+func (csiCS *CSIControllerServer) getCSIBackendError(ctxLogger *zap.Logger, requestID string, err error) error {
+	if errors.Is(err, errAPIRateLimitWait) {
+		ctxLogger.Warn("Request not sent to the backend", zap.Error(err))
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	code, overridden := classifyBackendError(csiCS.backendErrorOverrides, err)
+	classified := overridden
+	if !classified {
+		code, classified = classifyVPCError(err)
+	}
+	if !classified {
+		return withBackendErrorDetails(commonError.GetCSIBackendError(ctxLogger, requestID, err), err)
+	}
+	userMsg := commonError.GetCSIMessage(commonError.InternalError)
+	userMsg.Type = code
+	userMsg.RequestID = requestID
+	userMsg.BackendError = err.Error()
+	ctxLogger.Error("FAILED BACKEND ERROR", zap.Error(userMsg), zap.Stringer("Code", code), zap.Bool("Overridden", overridden))
+	return withBackendErrorDetails(status.Error(userMsg.Type, userMsg.Info()), err)
+}
+
+// getDeleteSnapshotError returns the CSI error of a failed snapshot deletion. A snapshot in use or being deleted
+// returns Aborted so the deletion is retried, a snapshot with dependents returns FailedPrecondition with the
+// backend details of the dependents. Configured overrides take precedence.
+func (csiCS *CSIControllerServer) getDeleteSnapshotError(ctxLogger *zap.Logger, requestID string, snapshotID string, err error) error {
+	if _, overridden := classifyBackendError(csiCS.backendErrorOverrides, err); overridden {
+		return csiCS.getCSIBackendError(ctxLogger, requestID, err)
+	}
+	if matchBackendError(err, snapshotBusyErrors) {
+		ctxLogger.Warn("Snapshot is in use or being deleted, deletion will be retried", zap.String("SnapshotID", snapshotID), zap.Error(err))
+		return status.Errorf(codes.Aborted, "snapshot %s is in use or being deleted, retry later: %v", snapshotID, err)
+	}
+	if matchBackendError(err, snapshotDependentErrors) {
+		ctxLogger.Error("Snapshot has dependents", zap.String("SnapshotID", snapshotID), zap.Error(err))
+		return status.Errorf(codes.FailedPrecondition, "snapshot %s has dependents which must be deleted first: %v", snapshotID, err)
+	}
+	return csiCS.getCSIBackendError(ctxLogger, requestID, err)
+}
+
+// getCreateVolumeError returns the CSI error of a failed volume creation. A zone without capacity returns
+// ResourceExhausted so the provisioner can reschedule the volume in another zone. Configured overrides take precedence.
+func (csiCS *CSIControllerServer) getCreateVolumeError(ctxLogger *zap.Logger, requestID string, zone string, err error) error {
+	if _, overridden := classifyBackendError(csiCS.backendErrorOverrides, err); !overridden && matchBackendError(err, zoneCapacityErrors) {
+		ctxLogger.Error("Zone has no capacity for the volume", zap.String("Zone", zone), zap.Error(err))
+		return status.Errorf(codes.ResourceExhausted, "zone %s has no capacity for the volume: %v", zone, err)
+	}
+	return csiCS.getCSIBackendError(ctxLogger, requestID, err)
+}
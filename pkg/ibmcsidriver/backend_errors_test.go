@@ -0,0 +1,287 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetBackendErrorOverrides(t *testing.T) {
+	testCases := []struct {
+		name         string
+		env          string
+		expOverrides []backendErrorOverride
+		expErr       bool
+	}{
+		{
+			name:         "Not set",
+			expOverrides: []backendErrorOverride{},
+		},
+		{
+			name: "Valid overrides, longest text first",
+			env:  "over_limit=ResourceExhausted; RC:500 = Unavailable ;",
+			expOverrides: []backendErrorOverride{
+				{match: "over_limit", code: codes.ResourceExhausted},
+				{match: "RC:500", code: codes.Unavailable},
+			},
+		},
+		{
+			name:   "Unknown gRPC code",
+			env:    "over_limit=Retry",
+			expErr: true,
+		},
+		{
+			name:   "OK is not allowed",
+			env:    "over_limit=OK",
+			expErr: true,
+		},
+		{
+			name:   "Missing code",
+			env:    "over_limit",
+			expErr: true,
+		},
+		{
+			name:   "Empty match",
+			env:    "=Unavailable",
+			expErr: true,
+		},
+		{
+			name:   "Duplicate match",
+			env:    "over_limit=Unavailable;over_limit=Aborted",
+			expErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("BACKEND_ERROR_CODE_OVERRIDES", tc.env)
+			overrides, err := getBackendErrorOverrides()
+			if tc.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expOverrides, overrides)
+		})
+	}
+}
+
+func TestClassifyBackendError(t *testing.T) {
+	overrides := []backendErrorOverride{
+		{match: "volume_capacity_max", code: codes.OutOfRange},
+		{match: "over_limit", code: codes.ResourceExhausted},
+	}
+
+	code, ok := classifyBackendError(overrides, providerError.Message{Code: "over_limit", Description: "quota exceeded"})
+	assert.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, code)
+
+	code, ok = classifyBackendError(overrides, errors.New("Trace Code:1, volume_capacity_max Please check"))
+	assert.True(t, ok)
+	assert.Equal(t, codes.OutOfRange, code)
+
+	_, ok = classifyBackendError(overrides, providerError.Message{Code: "not_found", Description: "volume not found"})
+	assert.False(t, ok)
+
+	_, ok = classifyBackendError(nil, providerError.Message{Code: "over_limit"})
+	assert.False(t, ok)
+}
+
+func TestClassifyVPCError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		err     error
+		expCode codes.Code
+		expOK   bool
+	}{
+		{
+			name:    "Throttled",
+			err:     errors.New("Trace Code:1, Code:too_many_requests, Description:Too many requests, RC:429"),
+			expCode: codes.Unavailable,
+			expOK:   true,
+		},
+		{
+			name:    "Quota exceeded",
+			err:     providerError.Message{Code: "FailedToPlaceOrder", Description: "Trace Code:1, Code:over_limit, Description:The volume quota is exceeded, RC:400"},
+			expCode: codes.ResourceExhausted,
+			expOK:   true,
+		},
+		{
+			name:    "Not found",
+			err:     providerError.Message{Code: "not_found", Description: "volume not found"},
+			expCode: codes.NotFound,
+			expOK:   true,
+		},
+		{
+			name:    "Bad input by HTTP status",
+			err:     errors.New("Trace Code:1, Code:volume_capacity_max, Description:Capacity too large, RC:400 Bad Request"),
+			expCode: codes.InvalidArgument,
+			expOK:   true,
+		},
+		{
+			name:    "Service unavailable",
+			err:     errors.New("Trace Code:1, Code:internal_error, Description:Service unavailable, RC: 503"),
+			expCode: codes.Unavailable,
+			expOK:   true,
+		},
+		{
+			name:  "Unknown error",
+			err:   errors.New("connection reset by peer"),
+			expOK: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, ok := classifyVPCError(tc.err)
+			assert.Equal(t, tc.expOK, ok)
+			if tc.expOK {
+				assert.Equal(t, tc.expCode, code)
+			}
+		})
+	}
+}
+
+func TestGetCSIBackendErrorDetails(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	backendErr := providerError.Message{Code: "FailedToExpandVolume", Description: "Trace Code:1, Code:too_many_requests, Description:Too many requests, RC:429"}
+	for _, err := range []error{backendErr, errors.New("connection reset by peer")} {
+		st := status.Convert(icDriver.cs.getCSIBackendError(logger, "req-1", err))
+		details := st.Details()
+		assert.Equal(t, 1, len(details))
+		errorInfo, ok := details[0].(*errdetails.ErrorInfo)
+		assert.True(t, ok)
+		assert.Equal(t, err.Error(), errorInfo.Metadata["backendError"])
+	}
+	st := status.Convert(icDriver.cs.getCSIBackendError(logger, "req-1", backendErr))
+	assert.Equal(t, codes.Unavailable, st.Code())
+	assert.Equal(t, "FailedToExpandVolume", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+}
+
+func TestCreateVolumeBackendErrorOverride(t *testing.T) {
+	testCases := []struct {
+		name       string
+		env        string
+		expErrCode codes.Code
+	}{
+		{
+			name:       "Built-in classification",
+			expErrCode: codes.ResourceExhausted,
+		},
+		{
+			name:       "Overridden error code",
+			env:        "over_limit=FailedPrecondition",
+			expErrCode: codes.FailedPrecondition,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("BACKEND_ERROR_CODE_OVERRIDES", tc.env)
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			fakeStructSession.CreateVolumeReturns((*provider.Volume)(nil), providerError.Message{Code: "over_limit", Description: "The volume quota is exceeded"})
+
+			params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}
+			_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: "test-name", CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+		})
+	}
+}
+
+func TestDeleteSnapshotBackendErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		env        string
+		libErr     error
+		expErrCode codes.Code
+		expMessage string
+	}{
+		{
+			name:       "Deletable snapshot",
+			expErrCode: codes.OK,
+		},
+		{
+			name:       "Snapshot in use",
+			libErr:     providerError.Message{Code: "FailedToDeleteSnapshot", Description: "Trace Code:1, Code:snapshot_in_use, Description:The snapshot is being restored"},
+			expErrCode: codes.Aborted,
+		},
+		{
+			name:       "Snapshot being deleted",
+			libErr:     providerError.Message{Code: "snapshot_deleting", Description: "The snapshot is already being deleted"},
+			expErrCode: codes.Aborted,
+		},
+		{
+			name:       "Snapshot with dependents",
+			libErr:     providerError.Message{Code: "FailedToDeleteSnapshot", Description: "Trace Code:1, Code:snapshot_has_copies, Description:The snapshot has copies r006-copy-1"},
+			expErrCode: codes.FailedPrecondition,
+			expMessage: "r006-copy-1",
+		},
+		{
+			name:       "Overridden snapshot in use",
+			env:        "snapshot_in_use=Unavailable",
+			libErr:     providerError.Message{Code: "FailedToDeleteSnapshot", Description: "Trace Code:1, Code:snapshot_in_use, Description:The snapshot is being restored"},
+			expErrCode: codes.Unavailable,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("BACKEND_ERROR_CODE_OVERRIDES", tc.env)
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			fakeStructSession.DeleteSnapshotReturns(tc.libErr)
+
+			_, err = icDriver.cs.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-id"})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if tc.expMessage != "" {
+				assert.Contains(t, status.Convert(err).Message(), tc.expMessage)
+			}
+		})
+	}
+}
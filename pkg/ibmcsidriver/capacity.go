@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+)
+
+// zoneUsageListLimit number of volumes listed per call when computing the capacity used in a zone
+const zoneUsageListLimit = 100
+
+// getZoneCapacityQuotas returns the block storage capacity quotas in GiB from ZONE_VOLUME_CAPACITY_QUOTA
+// e.g "*:20000;us-south-1:50000;us-south-1/sdp:10000", keyed by zone or by zone/profile for the profile pools
+func getZoneCapacityQuotas() (map[string]int64, error) {
+	quotas := make(map[string]int64)
+	for _, entry := range strings.Split(os.Getenv("ZONE_VOLUME_CAPACITY_QUOTA"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		name, value, found := strings.Cut(entry, ":")
+		quota, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !found || err != nil || quota < 0 {
+			return nil, fmt.Errorf("<%s> is not a valid entry, expecting <zone>[/<profile>]:<capacity in GiB>", entry)
+		}
+		quotas[strings.TrimSpace(name)] = quota
+	}
+	return quotas, nil
+}
+
+// getZoneCapacityQuota returns the block storage capacity quota of the zone in GiB, where "*" applies to the zones
+// not listed. 0 means no quota
+func getZoneCapacityQuota(zone string) (int64, error) {
+	quotas, err := getZoneCapacityQuotas()
+	if err != nil {
+		return 0, err
+	}
+	if quota, ok := quotas[zone]; ok {
+		return quota, nil
+	}
+	return quotas[defaultZoneQuotaKey], nil
+}
+
+// getProfileCapacityQuota returns the capacity quota in GiB of the profile pool of the zone e.g "us-south-1/sdp:10000",
+// where "*/sdp" applies to the zones not listed. False if the profile has no pool of its own
+func getProfileCapacityQuota(zone string, profile string) (int64, bool, error) {
+	quotas, err := getZoneCapacityQuotas()
+	if err != nil {
+		return 0, false, err
+	}
+	if quota, ok := quotas[zone+"/"+profile]; ok {
+		return quota, true, nil
+	}
+	quota, ok := quotas[defaultZoneQuotaKey+"/"+profile]
+	return quota, ok, nil
+}
+
+// getZoneVolumeUsage returns the capacity in GiB of the volumes in the zone, and of those of the profile
+func getZoneVolumeUsage(session provider.Session, zone string, profile string) (int64, int64, error) {
+	var used, profileUsed int64
+	start := ""
+	for {
+		volumeList, err := session.ListVolumes(zoneUsageListLimit, start, map[string]string{"zone.name": zone})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, vol := range volumeList.Volumes {
+			if vol.Capacity == nil {
+				continue
+			}
+			used += int64(*vol.Capacity)
+			if vol.Profile != nil && len(profile) != 0 && vol.Profile.Name == profile {
+				profileUsed += int64(*vol.Capacity)
+			}
+		}
+		if len(volumeList.Next) == 0 {
+			return used, profileUsed, nil
+		}
+		start = volumeList.Next
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetZoneCapacityQuota(t *testing.T) {
+	quota, err := getZoneCapacityQuota("us-south-1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), quota)
+
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "*:1000; us-south-1:5000")
+	quota, err = getZoneCapacityQuota("us-south-1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5000), quota)
+	quota, err = getZoneCapacityQuota("us-south-2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), quota)
+
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "us-south-1:-5")
+	_, err = getZoneCapacityQuota("us-south-1")
+	assert.NotNil(t, err)
+}
+
+func TestGetProfileCapacityQuota(t *testing.T) {
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "*:1000;us-south-1:5000;us-south-1/sdp:2000;*/sdp:500")
+	quota, pool, err := getProfileCapacityQuota("us-south-1", SDPProfile)
+	assert.Nil(t, err)
+	assert.True(t, pool)
+	assert.Equal(t, int64(2000), quota)
+
+	quota, pool, err = getProfileCapacityQuota("us-south-2", SDPProfile)
+	assert.Nil(t, err)
+	assert.True(t, pool)
+	assert.Equal(t, int64(500), quota)
+
+	_, pool, err = getProfileCapacityQuota("us-south-1", "general-purpose")
+	assert.Nil(t, err)
+	assert.False(t, pool)
+
+	_, pool, err = getProfileCapacityQuota("us-south-1", "")
+	assert.Nil(t, err)
+	assert.False(t, pool)
+
+	quota, err = getZoneCapacityQuota("us-south-1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5000), quota)
+
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "us-south-1/sdp")
+	_, _, err = getProfileCapacityQuota("us-south-1", SDPProfile)
+	assert.NotNil(t, err)
+}
+
+func TestGetCapacityZoneQuota(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "*:100")
+
+	icDriver := initIBMCSIDriver(t)
+	advertised := false
+	for _, capability := range icDriver.cscap {
+		advertised = advertised || capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_GET_CAPACITY
+	}
+	assert.True(t, advertised)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+
+	ten, twenty := 10, 20
+	fakeStructSession.ListVolumesReturnsOnCall(0, &provider.VolumeList{Next: "vol2", Volumes: []*provider.Volume{{VolumeID: "vol1", Capacity: &ten}}}, nil)
+	fakeStructSession.ListVolumesReturnsOnCall(1, &provider.VolumeList{Volumes: []*provider.Volume{{VolumeID: "vol2", Capacity: &twenty}, {VolumeID: "vol3"}}}, nil)
+	req := &csi.GetCapacityRequest{AccessibleTopology: &csi.Topology{Segments: map[string]string{utils.NodeZoneLabel: "us-south-1"}}}
+
+	resp, err := icDriver.cs.GetCapacity(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(70*utils.GiB), resp.AvailableCapacity)
+	assert.Equal(t, 2, fakeStructSession.ListVolumesCallCount())
+	_, _, filters := fakeStructSession.ListVolumesArgsForCall(1)
+	assert.Equal(t, "us-south-1", filters["zone.name"])
+
+	// zone over quota
+	overQuota := 120
+	fakeStructSession.ListVolumesReturnsOnCall(2, &provider.VolumeList{Volumes: []*provider.Volume{{VolumeID: "vol1", Capacity: &overQuota}}}, nil)
+	resp, err = icDriver.cs.GetCapacity(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), resp.AvailableCapacity)
+
+	// zone is required
+	_, err = icDriver.cs.GetCapacity(context.Background(), &csi.GetCapacityRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetCapacityProfileQuota(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("ZONE_VOLUME_CAPACITY_QUOTA", "*:100;*/sdp:40;us-south-2/sdp:80")
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+
+	ten, twenty := 10, 20
+	fakeStructSession.ListVolumesReturns(&provider.VolumeList{Volumes: []*provider.Volume{
+		{VolumeID: "vol1", Capacity: &ten, VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: SDPProfile}}},
+		{VolumeID: "vol2", Capacity: &twenty, VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: "general-purpose"}}},
+		{VolumeID: "vol3", Capacity: &twenty, VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: "general-purpose"}}},
+	}}, nil)
+	getCapacity := func(zone string, profile string) int64 {
+		req := &csi.GetCapacityRequest{
+			AccessibleTopology: &csi.Topology{Segments: map[string]string{utils.NodeZoneLabel: zone}},
+			Parameters:         map[string]string{Profile: profile},
+		}
+		resp, err := icDriver.cs.GetCapacity(context.Background(), req)
+		assert.Nil(t, err)
+		return resp.AvailableCapacity
+	}
+
+	// the sdp pool of 40GiB has 10GiB used
+	assert.Equal(t, int64(30*utils.GiB), getCapacity("us-south-1", SDPProfile))
+	// the sdp pool of 80GiB is bounded by the 50GiB left in the zone
+	assert.Equal(t, int64(50*utils.GiB), getCapacity("us-south-2", SDPProfile))
+	// no pool of its own, aggregate of the zone
+	assert.Equal(t, int64(50*utils.GiB), getCapacity("us-south-1", "general-purpose"))
+	assert.Equal(t, int64(50*utils.GiB), getCapacity("us-south-1", ""))
+}
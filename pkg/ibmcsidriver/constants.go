@@ -24,6 +24,36 @@ import (
 
 const (
 	createdByIBM = "Created By " + config.CSIDriverLogName
+
+	// sourceSnapshotTagPrefix tag prefix of the volumes restored from a snapshot, "/" is not a permitted tag character
+	sourceSnapshotTagPrefix = "source:snapshot:"
+
+	// sourceCloneTagPrefix tag prefix of the volumes cloned from a volume
+	sourceCloneTagPrefix = "source:clone:"
+
+	// encryptionTagPrefix tag prefix of the encryption of the volume, customer-managed or provider-managed
+	encryptionTagPrefix = "encryption:"
+
+	// customerManagedEncryption volume encrypted with a customer root key
+	customerManagedEncryption = "customer-managed"
+
+	// providerManagedEncryption volume encrypted with a provider managed key
+	providerManagedEncryption = "provider-managed"
+
+	// clusterNameTagPrefix tag prefix of the cluster name, set along with the clusterID tag
+	clusterNameTagPrefix = "clusterName:"
+
+	// maxVolumeTags max number of tags allowed on a resource by IBM Cloud
+	maxVolumeTags = 1000
+
+	// maxTagLen max length of a tag in chars
+	maxTagLen = 128
+
+	// maxResourceNameLen max length of a VPC resource name e.g a snapshot name
+	maxResourceNameLen = 63
+
+	// snapshotNameHashLen hex chars of the name hash kept when a scoped snapshot name is truncated
+	snapshotNameHashLen = 8
 )
 
 const (
@@ -114,6 +144,9 @@ const (
 	// IOPSLabel ...
 	IOPSLabel = "iops"
 
+	// BandwidthLabel ... throughput of the volume in megabits per second
+	BandwidthLabel = "bandwidth"
+
 	// ZoneLabel ...
 	ZoneLabel = "zone"
 
@@ -131,10 +164,84 @@ const (
 
 	// Throughput ...
 	Throughput = "throughput"
+
+	// IOScheduler I/O scheduler to be set on the volume device by the node server
+	IOScheduler = "ioScheduler"
+
+	// IOSchedulerMaxLen Max length of the I/O scheduler name in Chars
+	IOSchedulerMaxLen = 32
+
+	// MountOptions comma separated mount options passed to the node server through the volume context
+	MountOptions = "mountOptions"
+
+	// FsType file system type the volume was created for, passed to the node server through the volume context
+	FsType = "fsType"
+
+	// DryRun CreateVolume only validates the request and creates nothing if "true", a valid request fails with
+	// FailedPrecondition and an ErrorInfo detail of reason DryRunOKReason. It is rejected if set in a StorageClass, as
+	// the external-provisioner would retry the dry run forever
+	DryRun = "dryRun"
+
+	// DryRunOKReason ErrorInfo reason of the FailedPrecondition error of a valid dry run CreateVolume
+	DryRunOKReason = "DRY_RUN_OK"
+
+	// SnapshotConsistency VolumeSnapshotClass parameter recording whether the snapshot is crash or application consistent,
+	// as the consistency tag of the snapshot
+	SnapshotConsistency = "consistency"
+
+	// StorageClassName name of the StorageClass set in its parameters, as the external provisioner does not pass it,
+	// label of the CreateVolume counters if listed in METRICS_STORAGE_CLASSES
+	StorageClassName = "storageClassName"
+
+	// PVCName PVC name parameter added by the external provisioner with --extra-create-metadata
+	PVCName = "csi.storage.k8s.io/pvc/name"
+
+	// PVCNamespace PVC namespace parameter added by the external provisioner with --extra-create-metadata
+	PVCNamespace = "csi.storage.k8s.io/pvc/namespace"
+
+	// PVName PV name parameter added by the external provisioner with --extra-create-metadata
+	PVName = "csi.storage.k8s.io/pv/name"
+
+	// VolumeSnapshotName VolumeSnapshot name parameter added by the external snapshotter with --extra-create-metadata
+	VolumeSnapshotName = "csi.storage.k8s.io/volumesnapshot/name"
+
+	// VolumeSnapshotNamespace VolumeSnapshot namespace parameter added by the external snapshotter with --extra-create-metadata
+	VolumeSnapshotNamespace = "csi.storage.k8s.io/volumesnapshot/namespace"
+
+	// VolumeSnapshotContentName VolumeSnapshotContent name parameter added by the external snapshotter with --extra-create-metadata
+	VolumeSnapshotContentName = "csi.storage.k8s.io/volumesnapshotcontent/name"
+
+	// defaultNamespaceQuotaKey NAMESPACE_VOLUME_QUOTA entry applied to the namespaces which are not listed
+	defaultNamespaceQuotaKey = "*"
+
+	// defaultZoneQuotaKey ZONE_VOLUME_CAPACITY_QUOTA entry applied to the zones which are not listed
+	defaultZoneQuotaKey = "*"
+
+	// defaultProfileLimitKey VOLUME_ATTACHMENT_LIMIT_BY_PROFILE entry applied to the instance profiles which are not listed
+	defaultProfileLimitKey = "*"
+
+	// InstanceTypeLabel node label of the instance profile of the node
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+
+	// InstanceProfileFamilyLabel topology key of the instance profile family of the node e.g bx2, so that storage
+	// classes can restrict volumes to the nodes able to attach them through allowedTopologies
+	InstanceProfileFamilyLabel = "ibm-cloud.kubernetes.io/vpc-instance-profile-family"
+
+	// defaultRequestIDMetadataKey gRPC metadata key carrying the request ID of the caller, if REQUEST_ID_METADATA_KEY is not set
+	defaultRequestIDMetadataKey = "x-request-id"
 )
 
+// supportedSnapshotConsistencies the permitted values of the consistency snapshot parameter
+var supportedSnapshotConsistencies = []string{"crash", "application"}
+
 // SupportedFS the supported FS types
 var SupportedFS = []string{"ext2", "ext3", "ext4", "xfs"}
 
 // SupportedProfile the supported profile names
 var SupportedProfile = []string{"custom", "general-purpose", "5iops-tier", "10iops-tier", "sdp"}
+
+// profileIopsRanges the minimum and maximum IOPS of the profiles which take the iops parameter
+var profileIopsRanges = map[string][2]int{
+	CustomProfile: {100, 48000},
+	SDPProfile:    {3000, 64000},
+}
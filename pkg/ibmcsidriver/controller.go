@@ -18,8 +18,10 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	commonError "github.com/IBM/ibm-csi-common/pkg/messages"
@@ -34,6 +36,7 @@ import (
 
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes"
 )
 
 // CSIControllerServer ...
@@ -41,6 +44,33 @@ type CSIControllerServer struct {
 	Driver      *IBMCSIDriver
 	CSIProvider cloudProvider.CloudProviderInterface
 	mutex       utils.LockStore
+	// snapshotLimiter limits the concurrent CreateSnapshot/DeleteSnapshot operations
+	snapshotLimiter *operationLimiter
+	// expandLimiter limits the concurrent ControllerExpandVolume backend expansions
+	expandLimiter *operationLimiter
+	// opHistory recent attach/detach operations per volume
+	opHistory *operationHistory
+	// kubeClient kubernetes client of the controller, its objects are watched in kubeCache
+	kubeClient kubernetes.Interface
+	// namespaceQuotas max number of volumes per namespace set in NAMESPACE_VOLUME_QUOTA
+	namespaceQuotas map[string]int
+	// backendErrorOverrides gRPC codes of backend errors set in BACKEND_ERROR_CODE_OVERRIDES
+	backendErrorOverrides []backendErrorOverride
+	// volumeCondition reports the condition of the volumes in ListVolumes, see CONTROLLER_VOLUME_CONDITION
+	volumeCondition bool
+	// apiLimiter rate limits the VPC API calls of all the requests, see VPC_API_RATE_LIMIT
+	apiLimiter *apiRateLimiter
+	// kubeCache cached VolumeAttachments, PersistentVolumes and CSINodes for the node attach limits and the
+	// namespace volume quota, which are not enforced if nil
+	kubeCache *kubeObjectCache
+	// providerHealth checks the VPC API is reachable for the identity Probe, nil if not checked
+	providerHealth *providerHealthCheck
+	// snapshotTagger attaches the tags of the created snapshots, not tagged if nil
+	snapshotTagger resourceTagger
+	// volumeModifier changes the IOPS and the throughput of the volumes for ControllerModifyVolume
+	volumeModifier volumeModifier
+	// profileLookup verifies the profile of the dry run CreateVolume requests exists, not verified if nil
+	profileLookup volumeProfileLookup
 	csi.UnimplementedControllerServer
 }
 
@@ -64,12 +94,24 @@ const (
 var _ csi.ControllerServer = &CSIControllerServer{}
 
 // CreateVolume ...
-func (csiCS *CSIControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+func (csiCS *CSIControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (response *csi.CreateVolumeResponse, err error) {
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
-	ctxLogger.Info("CSIControllerServer-CreateVolume... ", zap.Reflect("Request", req))
+	dryRun := req.GetParameters()[DryRun] == TrueStr
+	if dryRun {
+		ctxLogger = ctxLogger.With(zap.Bool("DryRun", true))
+	}
+	ctxLogger.Info("CSIControllerServer-CreateVolume... ", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "CreateVolume", time.Now())
+	// Dry runs create nothing, they are not counted as CreateVolume calls
+	if !dryRun {
+		recordCreateVolumeAttempt(req.GetParameters()[StorageClassName])
+		defer func() {
+			recordCreateVolumeResult(req.GetParameters()[StorageClassName], err)
+		}()
+	}
 
 	// Check basic parameters validations i.e PVC name given
 	name := req.GetName()
@@ -84,8 +126,12 @@ func (csiCS *CSIControllerServer) CreateVolume(ctx context.Context, req *csi.Cre
 	}
 
 	// Validate volume capabilities, are all capabilities supported by driver or not
-	if !areVolumeCapabilitiesSupported(req.GetVolumeCapabilities(), csiCS.Driver.vcap) {
-		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeCapabilitiesNotSupported, requestID, nil)
+	if err = validateVolumeCapabilities(req.GetVolumeCapabilities(), csiCS.Driver.vcap); err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeCapabilitiesNotSupported, requestID, err)
+	}
+
+	if err = checkDeprecatedParameters(ctxLogger, req.GetParameters()); err != nil {
+		return nil, err
 	}
 
 	// Get volume input Parameters
@@ -106,10 +152,24 @@ func (csiCS *CSIControllerServer) CreateVolume(ctx context.Context, req *csi.Cre
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
 	}
 
+	if err = checkDeprecatedProfile(ctxLogger, req.GetParameters()[Profile]); err != nil {
+		return nil, err
+	}
+
+	// Tag the volume with the cluster name and its encryption, the cluster volume label tags are added by the provider library
+	reservedTags := 0
+	if conf := csiCS.CSIProvider.GetConfig(); conf != nil && conf.VPC != nil && len(conf.VPC.ClusterVolumeLabel) != 0 {
+		reservedTags = len(strings.Split(conf.VPC.ClusterVolumeLabel, ","))
+	}
+	if clusterNameTag := getClusterNameTag(ctxLogger); len(clusterNameTag) != 0 {
+		requestedVolume.Tags = addTagWithinLimit(ctxLogger, requestedVolume.Tags, clusterNameTag, reservedTags)
+	}
+	requestedVolume.Tags = addTagWithinLimit(ctxLogger, requestedVolume.Tags, getEncryptionTag(requestedVolume), reservedTags)
+
 	// TODO: Determine Zones and Region for the disk
 
 	// Validate if volume Already Exists
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		if userError.GetUserErrorCode(err) == string(utilReasonCode.EndpointNotReachable) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.EndpointNotReachable, requestID, err)
@@ -137,37 +197,99 @@ func (csiCS *CSIControllerServer) CreateVolume(ctx context.Context, req *csi.Cre
 		} else {
 			requestedVolume.SnapshotID = snapshotIdentifier
 		}
+		if err := validateSnapshotRegion(session, requestedVolume, ctxLogger); err != nil {
+			return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
+		}
+		// VPC restores the volume at the requested capacity, which can not be below the snapshot minimum capacity
+		if err = checkSnapshotRestoreSize(getSnapshotRestoreSize(session, requestedVolume, ctxLogger), *requestedVolume.Capacity); err != nil {
+			ctxLogger.Error("Invalid capacity for the snapshot restore", zap.Error(err))
+			return nil, err
+		}
+		// Tag the volume with its source, for snapshot/clone provenance
+		if sourceTag := getVolumeSourceTag(volumeSource); len(sourceTag) != 0 {
+			requestedVolume.Tags = addTagWithinLimit(ctxLogger, requestedVolume.Tags, sourceTag, reservedTags)
+		}
 	}
 
+	// Optionally wait until the volume is available, so that it can be attached right away
+	creationTimeout := time.Duration(getNonNegativeIntEnv(ctxLogger, "VOLUME_CREATION_TIMEOUT", 0)) * time.Second
+
 	existingVol, err := checkIfVolumeExists(session, *requestedVolume, ctxLogger)
 	if existingVol != nil && err == nil {
 		ctxLogger.Info("Volume already exists", zap.Reflect("ExistingVolume", existingVol))
+		if dryRun {
+			// No volume would be created, so the request is not reported as valid
+			return nil, dryRunVolumeExistsError(name)
+		}
 		if existingVol.Capacity != nil && requestedVolume.Capacity != nil && *existingVol.Capacity == *requestedVolume.Capacity {
-			return createCSIVolumeResponse(*existingVol, int64(*(existingVol.Capacity)*utils.GB), nil, csiCS.CSIProvider.GetClusterID(), csiCS.Driver.region), nil
+			if creationTimeout > 0 {
+				if existingVol, err = waitForVolumeAvailable(ctx, ctxLogger, session, existingVol, creationTimeout); err != nil {
+					return nil, err
+				}
+			}
+			return addNodeVolumeContext(createCSIVolumeResponse(*existingVol, int64(*(existingVol.Capacity)*utils.GB), nil, csiCS.CSIProvider.GetClusterID(), csiCS.Driver.region), req.GetParameters(), getDefaultedFsType(req.GetVolumeCapabilities(), requestedVolume)), nil
 		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeAlreadyExists, requestID, err, name, *requestedVolume.Capacity)
 	}
 
+	if err = csiCS.checkNamespaceVolumeQuota(ctxLogger, req.GetParameters()[PVCNamespace]); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if csiCS.profileLookup != nil && requestedVolume.Profile != nil {
+			exists, err := csiCS.profileLookup.profileExists(ctx, session, requestedVolume.Profile.Name)
+			if err != nil {
+				return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
+			}
+			if !exists {
+				return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, fmt.Errorf("volume profile %s does not exist in the VPC region", requestedVolume.Profile.Name))
+			}
+		}
+		ctxLogger.Info("Dry run, the volume request is valid and no volume is created")
+		return nil, dryRunError(requestedVolume, csiCS.Driver.name)
+	}
+
 	// Create volume
+	span := startProviderSpan(ctx, "CreateVolume", volumeSpanAttributes(requestedVolume)...)
 	volumeObj, err := session.CreateVolume(*requestedVolume)
+	endProviderSpan(ctx, span, err, volumeSpanAttributes(volumeObj)...)
+	if err != nil && creationTimeout > 0 && matchBackendError(err, volumeNotAvailableErrors) {
+		// The volume is created but not available yet, keep waiting for it rather than failing the request
+		if createdVol, lookupErr := checkIfVolumeExists(session, *requestedVolume, ctxLogger); createdVol != nil && lookupErr == nil {
+			ctxLogger.Warn("Volume created but not available yet", zap.String("VolumeID", createdVol.VolumeID), zap.Error(err))
+			volumeObj, err = createdVol, nil
+		}
+	}
 	if err != nil {
 		if providerError.RetrivalFailed == providerError.GetErrorType(err) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.ObjectNotFound, requestID, err, "creation")
 		}
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCreateVolumeError(ctxLogger, requestID, requestedVolume.Az, err)
+	}
+	if creationTimeout > 0 {
+		if volumeObj, err = waitForVolumeAvailable(ctx, ctxLogger, session, volumeObj, creationTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	// Accessible topology must be the zone the volume is provisioned in
+	if len(volumeObj.Az) == 0 {
+		volumeObj.Az = requestedVolume.Az
 	}
 
 	// return csi volume object
-	return createCSIVolumeResponse(*volumeObj, int64(*(requestedVolume.Capacity)*utils.GB), nil, csiCS.CSIProvider.GetClusterID(), csiCS.Driver.region), nil
+	return addNodeVolumeContext(createCSIVolumeResponse(*volumeObj, int64(*(requestedVolume.Capacity)*utils.GB), nil, csiCS.CSIProvider.GetClusterID(), csiCS.Driver.region), req.GetParameters(), getDefaultedFsType(req.GetVolumeCapabilities(), requestedVolume)), nil
 }
 
 // DeleteVolume ...
 func (csiCS *CSIControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
 	defer metrics.UpdateDurationFromStart(ctxLogger, "DeleteVolume", time.Now())
-	ctxLogger.Info("CSIControllerServer-DeleteVolume... ", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-DeleteVolume... ", zap.Reflect("Request", sanitizeRequest(req)))
 
 	// Validate arguments
 	volumeID := req.GetVolumeId()
@@ -180,7 +302,7 @@ func (csiCS *CSIControllerServer) DeleteVolume(ctx context.Context, req *csi.Del
 	// and delete volume by name
 
 	// get the session
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.FailedPrecondition, requestID, err)
 	}
@@ -193,19 +315,34 @@ func (csiCS *CSIControllerServer) DeleteVolume(ctx context.Context, req *csi.Del
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
+	span := startProviderSpan(ctx, "DeleteVolume", attrVolumeID.String(volumeID))
 	err = session.DeleteVolume(volume)
+	endProviderSpan(ctx, span, err, attrVolumeID.String(volumeID))
 	if err != nil {
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		// Volume may have been deleted after the lookup, DeleteVolume MUST be idempotent
+		if isVolumeNotFoundError(err) {
+			ctxLogger.Info("Volume not found. Returning success without deletion...", zap.Error(err))
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
+	}
+
+	// Optionally wait until the volume is actually gone, so that its name and quota can be reused right away
+	if timeout := getNonNegativeIntEnv(ctxLogger, "VOLUME_DELETION_CONFIRM_TIMEOUT", 0); timeout > 0 {
+		if err = waitForVolumeDeletion(ctx, ctxLogger, session, volumeID, time.Duration(timeout)*time.Second); err != nil {
+			return nil, err
+		}
 	}
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
 // ControllerPublishVolume ...
-func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (_ *csi.ControllerPublishVolumeResponse, err error) {
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
-	ctxLogger.Info("CSIControllerServer-ControllerPublishVolume...", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-ControllerPublishVolume...", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, metrics.FunctionLabel("ControllerPublishVolume"), time.Now())
 
 	volumeID := req.GetVolumeId()
@@ -216,6 +353,10 @@ func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, r
 	if len(nodeID) == 0 {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyNodeID, requestID, nil)
 	}
+	var attachmentID string
+	defer func() {
+		csiCS.recordVolumeOperation("ControllerPublishVolume", volumeID, nodeID, requestID, attachmentID, err)
+	}()
 
 	volumeCapability := req.GetVolumeCapability()
 	if volumeCapability == nil {
@@ -234,7 +375,7 @@ func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, r
 		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeCapabilitiesNotSupported, requestID, nil)
 	}
 
-	sess, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	sess, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
@@ -251,6 +392,10 @@ func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, r
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
 
+	if err = csiCS.checkNodeAttachLimit(ctxLogger, nodeID, volumeID); err != nil {
+		return nil, err
+	}
+
 	clusterID := csiCS.CSIProvider.GetClusterID()
 	volumeAttachmentReq := provider.VolumeAttachmentRequest{
 		VolumeID:   volumeID,
@@ -259,24 +404,28 @@ func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, r
 			ClusterID: &clusterID,
 		},
 	}
+	span := startProviderSpan(ctx, "AttachVolume", attrVolumeID.String(volumeID))
 	response, err := sess.AttachVolume(volumeAttachmentReq)
 	if err != nil {
+		endProviderSpan(ctx, span, err)
 		// Node should be present if not return the error code
 		if providerError.GetErrorType(err) == providerError.NodeNotFound {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.ObjectNotFound, requestID, err)
 		}
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 
 	//Pass in the VPCVolumeAttachment ID for efficient retrival in WaitForAttachVolume()
 	volumeAttachmentReq.VPCVolumeAttachment = &provider.VolumeAttachment{
 		ID: response.VPCVolumeAttachment.ID,
 	}
+	attachmentID = response.VPCVolumeAttachment.ID
 
 	response, err = sess.WaitForAttachVolume(volumeAttachmentReq)
+	endProviderSpan(ctx, span, err, attrAttachmentID.String(attachmentID))
 	if err != nil {
 		//retry gap is constant in the common lib i.e 10 seconds and number of retries are 4*Retry configure in the driver
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 
 	ctxLogger.Info("Attachment response", zap.Reflect("Response", response))
@@ -285,12 +434,13 @@ func (csiCS *CSIControllerServer) ControllerPublishVolume(ctx context.Context, r
 }
 
 // ControllerUnpublishVolume ...
-func (csiCS *CSIControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+func (csiCS *CSIControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (_ *csi.ControllerUnpublishVolumeResponse, err error) {
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
 	defer metrics.UpdateDurationFromStart(ctxLogger, metrics.FunctionLabel("ControllerUnpublishVolume"), time.Now())
-	ctxLogger.Info("CSIControllerServer-ControllerUnpublishVolume... ", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-ControllerUnpublishVolume... ", zap.Reflect("Request", sanitizeRequest(req)))
 
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -301,6 +451,9 @@ func (csiCS *CSIControllerServer) ControllerUnpublishVolume(ctx context.Context,
 	if len(nodeID) == 0 {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyNodeID, requestID, nil)
 	}
+	defer func() {
+		csiCS.recordVolumeOperation("ControllerUnpublishVolume", volumeID, nodeID, requestID, "", err)
+	}()
 
 	//Allow only one active attach/detach operation for an instance at anytime
 	csiCS.mutex.Lock(nodeID)
@@ -314,18 +467,21 @@ func (csiCS *CSIControllerServer) ControllerUnpublishVolume(ctx context.Context,
 			ClusterID: &clusterID,
 		},
 	}
-	sess, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	sess, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
+	span := startProviderSpan(ctx, "DetachVolume", attrVolumeID.String(volumeID))
 	response, err := sess.DetachVolume(volumeAttachmentReq)
 	if err != nil {
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		endProviderSpan(ctx, span, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 	err = sess.WaitForDetachVolume(volumeAttachmentReq)
+	endProviderSpan(ctx, span, err)
 	if err != nil {
 		//retry gap is constant in the common lib i.e 10 seconds and number of retries are 4*Retry configure in the driver
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 	ctxLogger.Info("Detach response", zap.Reflect("response", response))
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
@@ -333,10 +489,10 @@ func (csiCS *CSIControllerServer) ControllerUnpublishVolume(ctx context.Context,
 
 // ValidateVolumeCapabilities ...
 func (csiCS *CSIControllerServer) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
-	ctxLogger.Info("CSIControllerServer-ValidateVolumeCapabilities", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-ValidateVolumeCapabilities", zap.Reflect("Request", sanitizeRequest(req)))
 
 	// Validate Arguments
 	if req.GetVolumeCapabilities() == nil || len(req.GetVolumeCapabilities()) == 0 {
@@ -348,68 +504,78 @@ func (csiCS *CSIControllerServer) ValidateVolumeCapabilities(ctx context.Context
 	}
 
 	// Check if Requested Volume exists
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
 
 	// Get volume details by using volume ID, it should exists with provider
-	_, err = session.GetVolume(volumeID)
+	volume, err := session.GetVolume(volumeID)
 	if err != nil {
 		if providerError.RetrivalFailed == providerError.GetErrorType(err) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.ObjectNotFound, requestID, err, volumeID)
 		}
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 
-	// Setup Response
-	var confirmed *csi.ValidateVolumeCapabilitiesResponse_Confirmed
-	// Check if Volume Capabilities supported by the Driver Match
-	if areVolumeCapabilitiesSupported(req.GetVolumeCapabilities(), csiCS.Driver.vcap) {
-		confirmed = &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: req.GetVolumeCapabilities()}
+	// Check if the Volume Capabilities are supported by the Driver and match the volume
+	if err = validateVolumeMatch(volume, req, csiCS.Driver.vcap); err != nil {
+		ctxLogger.Info("Volume capabilities not supported", zap.Error(err))
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
 	}
 
 	// Return Response
 	return &csi.ValidateVolumeCapabilitiesResponse{
-		Confirmed: confirmed,
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: req.GetVolumeCapabilities()},
 	}, nil
 }
 
 // ListVolumes ...
 func (csiCS *CSIControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
 	ctxLogger.Info("CSIControllerServer-ListVolumes...", zap.Reflect("Request", req))
 	defer metrics.UpdateDurationFromStart(ctxLogger, metrics.FunctionLabel("ListVolumes"), time.Now())
 
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
 
 	maxEntries := int(req.MaxEntries)
 	tags := map[string]string{}
+	// Optionally list only the volumes of the resource group the driver creates volumes in, volumes created in
+	// another resource group through the resourceGroup storage class parameter are then not listed
+	if os.Getenv("LIST_VOLUMES_RESOURCE_GROUP_FILTER") == TrueStr {
+		if conf := csiCS.CSIProvider.GetConfig(); conf != nil && conf.VPC != nil && len(conf.VPC.G2ResourceGroupID) != 0 {
+			tags["resource_group.id"] = conf.VPC.G2ResourceGroupID
+		}
+	}
 	volumeList, err := session.ListVolumes(maxEntries, req.StartingToken, tags)
 	if err != nil {
-		errCode := err.(providerError.Message).Code
+		errCode := userError.GetUserErrorCode(err)
 		if strings.Contains(errCode, "InvalidListVolumesLimit") {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
 		} else if strings.Contains(errCode, "StartVolumeIDNotFound") {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.StartVolumeIDNotFound, requestID, err, req.StartingToken)
 		}
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
 
 	entries := []*csi.ListVolumesResponse_Entry{}
 	for _, vol := range volumeList.Volumes {
 		if vol.Capacity != nil {
-			entries = append(entries, &csi.ListVolumesResponse_Entry{
+			entry := &csi.ListVolumesResponse_Entry{
 				Volume: &csi.Volume{
 					VolumeId:      vol.VolumeID,
 					CapacityBytes: int64(*vol.Capacity * utils.GiB),
 				},
-			})
+			}
+			if csiCS.volumeCondition {
+				entry.Status = &csi.ListVolumesResponse_VolumeStatus{VolumeCondition: getVPCVolumeCondition(vol)}
+			}
+			entries = append(entries, entry)
 		}
 	}
 
@@ -419,19 +585,59 @@ func (csiCS *CSIControllerServer) ListVolumes(ctx context.Context, req *csi.List
 	}, nil
 }
 
-// GetCapacity ...
+// GetCapacity returns the capacity left in the zone of the topology, the zone quota set in ZONE_VOLUME_CAPACITY_QUOTA
+// less the capacity of the volumes of the zone. It is 0 if the zone is at quota.
 func (csiCS *CSIControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
-	_ = context.WithValue(ctx, provider.RequestID, requestID)
+	ctx = context.WithValue(ctx, provider.RequestID, requestID)
+	ctxLogger.Info("CSIControllerServer-GetCapacity", zap.Reflect("Request", sanitizeRequest(req)))
+	defer metrics.UpdateDurationFromStart(ctxLogger, metrics.FunctionLabel("GetCapacity"), time.Now())
 
-	ctxLogger.Info("CSIControllerServer-GetCapacity", zap.Reflect("Request", req))
-	return nil, commonError.GetCSIError(ctxLogger, commonError.MethodUnimplemented, requestID, nil, "GetCapacity")
+	if len(os.Getenv("ZONE_VOLUME_CAPACITY_QUOTA")) == 0 {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.MethodUnimplemented, requestID, nil, "GetCapacity")
+	}
+	zone := req.GetAccessibleTopology().GetSegments()[utils.NodeZoneLabel]
+	if len(zone) == 0 {
+		err := fmt.Errorf("the capacity is tracked per zone, the %s topology segment is required", utils.NodeZoneLabel)
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
+	}
+	quota, err := getZoneCapacityQuota(zone)
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
+	}
+	// The profiles with a pool of their own report its capacity, the others the aggregate of the zone
+	profile := req.GetParameters()[Profile]
+	profileQuota, profilePool, err := getProfileCapacityQuota(zone, profile)
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
+	}
+
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
+	}
+	used, profileUsed, err := getZoneVolumeUsage(session, zone, profile)
+	if err != nil {
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
+	}
+
+	available := quota - used
+	// The profile pool is bounded by the zone quota if any
+	if profilePool && (quota == 0 || profileQuota-profileUsed < available) {
+		available = profileQuota - profileUsed
+	}
+	if available < 0 {
+		available = 0
+	}
+	ctxLogger.Info("Zone capacity", zap.String("Zone", zone), zap.Int64("QuotaGiB", quota), zap.Int64("UsedGiB", used),
+		zap.String("Profile", profile), zap.Int64("ProfileQuotaGiB", profileQuota), zap.Int64("ProfileUsedGiB", profileUsed))
+	return &csi.GetCapacityResponse{AvailableCapacity: available * utils.GiB}, nil
 }
 
 // ControllerGetCapabilities implements the default GRPC callout.
 func (csiCS *CSIControllerServer) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	_ = context.WithValue(ctx, provider.RequestID, requestID)
 
@@ -444,10 +650,11 @@ func (csiCS *CSIControllerServer) ControllerGetCapabilities(ctx context.Context,
 
 // CreateSnapshot ...
 func (csiCS *CSIControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
-	ctxLogger.Info("CSIControllerServer-CreateSnapshot... ", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-CreateSnapshot... ", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "CreateSnapshot", time.Now())
 
 	//Feature flag to enable/disable CreateSnapshot feature.
@@ -467,8 +674,19 @@ func (csiCS *CSIControllerServer) CreateSnapshot(ctx context.Context, req *csi.C
 		return nil, commonError.GetCSIError(ctxLogger, commonError.MissingSourceVolumeID, requestID, nil)
 	}
 
+	consistency, err := getSnapshotConsistency(req.GetParameters())
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
+	}
+
+	if err := csiCS.acquireSnapshotSlot(ctx, ctxLogger); err != nil {
+		return nil, err
+	}
+	releaseSnapshotSlot := sync.OnceFunc(csiCS.snapshotLimiter.release)
+	defer releaseSnapshotSlot()
+
 	// Validate if volume Already Exists
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		if userError.GetUserErrorCode(err) == string(utilReasonCode.EndpointNotReachable) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.EndpointNotReachable, requestID, err)
@@ -479,37 +697,47 @@ func (csiCS *CSIControllerServer) CreateSnapshot(ctx context.Context, req *csi.C
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
 
-	snapshot, err := session.GetSnapshotByName(snapshotName)
+	snapshotTags := getSnapshotTags(ctxLogger, snapshotName, sourceVolumeID, req.GetParameters())
+	if consistency != "" {
+		snapshotTags[SnapshotConsistency] = consistency
+	}
+
+	backendSnapshotName := getBackendSnapshotName(getSnapshotNamePrefix(csiCS.CSIProvider.GetClusterID()), snapshotName)
+	snapshot, err := session.GetSnapshotByName(backendSnapshotName)
 	if snapshot != nil {
 		if snapshot.VolumeID != sourceVolumeID {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.SnapshotAlreadyExists, requestID, err, snapshotName, sourceVolumeID)
 		}
-		ctxLogger.Info("Snapshot with name already exist for volume", zap.Reflect("SnapshotName", snapshotName), zap.Reflect("VolumeID", sourceVolumeID))
+		ctxLogger.Info("Snapshot with name already exist for volume", zap.Reflect("SnapshotName", backendSnapshotName), zap.Reflect("VolumeID", sourceVolumeID))
+		// Tagging may have failed on a previous attempt
+		csiCS.tagSnapshot(ctx, ctxLogger, session, snapshot, snapshotTags)
 		return createCSISnapshotResponse(*snapshot), nil
 	}
 	snapshotParameters := provider.SnapshotParameters{}
-	snapshotParameters.Name = snapshotName
-	snapshotTags := map[string]string{
-		"name": snapshotName,
-	}
-	snapshotParameters.SnapshotTags = snapshotTags
+	snapshotParameters.Name = backendSnapshotName
 
+	span := startProviderSpan(ctx, "CreateSnapshot", attrVolumeID.String(sourceVolumeID))
 	snapshot, err = session.CreateSnapshot(sourceVolumeID, snapshotParameters)
+	endProviderSpan(ctx, span, err)
 
 	if err != nil {
+		// The other snapshot operations must not wait for the delay
+		releaseSnapshotSlot()
 		time.Sleep(time.Duration(getMaxDelaySnapshotCreate(ctxLogger)) * time.Second) //To avoid multiple retries from kubernetes to CSI Driver
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err, "creation")
 	}
+	csiCS.tagSnapshot(ctx, ctxLogger, session, snapshot, snapshotTags)
 	return createCSISnapshotResponse(*snapshot), nil
 }
 
 // DeleteSnapshot ...
 func (csiCS *CSIControllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
 	defer metrics.UpdateDurationFromStart(ctxLogger, "DeleteSnapshot", time.Now())
-	ctxLogger.Info("CSIControllerServer-DeleteSnapshot... ", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-DeleteSnapshot... ", zap.Reflect("Request", sanitizeRequest(req)))
 
 	// Validate arguments
 	snapshotID := req.GetSnapshotId()
@@ -517,8 +745,13 @@ func (csiCS *CSIControllerServer) DeleteSnapshot(ctx context.Context, req *csi.D
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptySnapshotID, requestID, nil)
 	}
 
+	if err := csiCS.acquireSnapshotSlot(ctx, ctxLogger); err != nil {
+		return nil, err
+	}
+	defer csiCS.snapshotLimiter.release()
+
 	// get the session
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		if userError.GetUserErrorCode(err) == string(utilReasonCode.EndpointNotReachable) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.EndpointNotReachable, requestID, err)
@@ -532,26 +765,28 @@ func (csiCS *CSIControllerServer) DeleteSnapshot(ctx context.Context, req *csi.D
 	snapshot := &provider.Snapshot{}
 	snapshot.SnapshotID, _ = getSnapshotAndAccountIDsFromCRN(snapshotID)
 
+	span := startProviderSpan(ctx, "DeleteSnapshot", attrSnapshotID.String(snapshot.SnapshotID))
 	err = session.DeleteSnapshot(snapshot)
+	endProviderSpan(ctx, span, err)
 	if err != nil {
 		if providerError.RetrivalFailed == providerError.GetErrorType(err) {
 			ctxLogger.Info("Snapshot not found. Returning success without deletion...")
 			return &csi.DeleteSnapshotResponse{}, nil
 		}
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getDeleteSnapshotError(ctxLogger, requestID, snapshot.SnapshotID, err)
 	}
 	return &csi.DeleteSnapshotResponse{}, nil
 }
 
 // ListSnapshots ...
 func (csiCS *CSIControllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	ctx = context.WithValue(ctx, provider.RequestID, requestID)
-	ctxLogger.Info("CSIControllerServer-ListSnapshots...", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-ListSnapshots...", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, metrics.FunctionLabel("ListSnapshots"), time.Now())
 
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		if userError.GetUserErrorCode(err) == string(utilReasonCode.EndpointNotReachable) {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.EndpointNotReachable, requestID, err)
@@ -564,15 +799,20 @@ func (csiCS *CSIControllerServer) ListSnapshots(ctx context.Context, req *csi.Li
 
 	entries := []*csi.ListSnapshotsResponse_Entry{}
 	snapshotID := req.GetSnapshotId()
+	sourceVolumeID := req.GetSourceVolumeId()
 	snapID, snapshotAccountID := getSnapshotAndAccountIDsFromCRN(snapshotID)
 	if len(snapID) != 0 {
 		if csiCS.Driver.accountID == snapshotAccountID { // in case snapshotID's account and cluster account ID is same
 			snapshot, err := session.GetSnapshot(snapID)
-			if snapshot == nil {
-				return &csi.ListSnapshotsResponse{}, nil
+			if err != nil {
+				if isSnapshotNotFoundError(err) {
+					ctxLogger.Info("Snapshot not found. Returning success ...", zap.Error(err))
+					return &csi.ListSnapshotsResponse{}, nil
+				}
+				return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 			}
-			if providerError.RetrivalFailed == providerError.GetErrorType(err) {
-				ctxLogger.Info("Snapshot not found. Returning success ...")
+			// both filters must match
+			if snapshot == nil || (len(sourceVolumeID) != 0 && snapshot.VolumeID != sourceVolumeID) {
 				return &csi.ListSnapshotsResponse{}, nil
 			}
 			return &csi.ListSnapshotsResponse{
@@ -598,13 +838,12 @@ func (csiCS *CSIControllerServer) ListSnapshots(ctx context.Context, req *csi.Li
 
 	maxEntries := int(req.GetMaxEntries())
 	tags := map[string]string{}
-	sourceVolumeID := req.GetSourceVolumeId()
 	if len(sourceVolumeID) != 0 {
 		tags["source_volume.id"] = sourceVolumeID
 	}
 	snapshotList, err := session.ListSnapshots(maxEntries, req.StartingToken, tags)
 	if err != nil {
-		errCode := err.(providerError.Message).Code
+		errCode := userError.GetUserErrorCode(err)
 		if strings.Contains(errCode, "InvalidListSnapshotLimit") {
 			return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
 		} else if strings.Contains(errCode, "StartSnapshotIDNotFound") {
@@ -628,17 +867,17 @@ func (csiCS *CSIControllerServer) ListSnapshots(ctx context.Context, req *csi.Li
 
 // getSnapshots ...
 func (csiCS *CSIControllerServer) getSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	_ = context.WithValue(ctx, provider.RequestID, requestID)
 
-	ctxLogger.Info("CSIControllerServer-getSnapshots", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-getSnapshots", zap.Reflect("Request", sanitizeRequest(req)))
 	return nil, commonError.GetCSIError(ctxLogger, commonError.MethodUnimplemented, requestID, nil, "getSnapshots")
 }
 
 // getSnapshotById ...
 func (csiCS *CSIControllerServer) getSnapshotByID(ctx context.Context, snapshotID string) (*csi.ListSnapshotsResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	// populate requestID in the context
 	_ = context.WithValue(ctx, provider.RequestID, requestID)
 
@@ -648,19 +887,22 @@ func (csiCS *CSIControllerServer) getSnapshotByID(ctx context.Context, snapshotI
 
 // ControllerExpandVolume ...
 func (csiCS *CSIControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger = traceRequestID(ctx, ctxLogger, requestID)
 	// populate requestID in the context
 	_ = context.WithValue(ctx, provider.RequestID, requestID)
 	defer metrics.UpdateDurationFromStart(ctxLogger, "ControllerExpandVolume", time.Now())
-	ctxLogger.Info("CSIControllerServer-ControllerExpandVolume", zap.Reflect("Request", req))
+	ctxLogger.Info("CSIControllerServer-ControllerExpandVolume", zap.Reflect("Request", sanitizeRequest(req)))
 	volumeID := req.GetVolumeId()
 	capacity := req.GetCapacityRange().GetRequiredBytes()
 	if len(volumeID) == 0 {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyVolumeID, requestID, nil)
 	}
+	// Raw block volumes have no file system to grow, the new size is seen by the pod on the device
+	nodeExpansionRequired := req.GetVolumeCapability().GetBlock() == nil
 
 	// get the session
-	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.FailedPrecondition, requestID, err)
 	}
@@ -674,25 +916,83 @@ func (csiCS *CSIControllerServer) ControllerExpandVolume(ctx context.Context, re
 		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
 	}
 
+	// The volume may already be larger e.g resized directly in VPC, report the actual capacity
+	// rather than the requested one as VPC volumes can not be shrunk
+	if volDetail.Capacity != nil {
+		backendCapacity := int64(*volDetail.Capacity) * utils.GB
+		if backendCapacity >= capacity {
+			ctxLogger.Info("Volume capacity is already equal or larger than the requested capacity", zap.Int64("BackendCapacity", backendCapacity), zap.Int64("RequestedCapacity", capacity))
+			return &csi.ControllerExpandVolumeResponse{CapacityBytes: backendCapacity, NodeExpansionRequired: nodeExpansionRequired}, nil
+		}
+	}
+
 	volumeExpansionReq := provider.ExpandVolumeRequest{
 		VolumeID: volumeID,
 		Capacity: capacity,
 	}
+	if err = csiCS.acquireExpandSlot(ctx, ctxLogger); err != nil {
+		return nil, err
+	}
+	defer csiCS.expandLimiter.release()
+	span := startProviderSpan(ctx, "ExpandVolume", attrVolumeID.String(volumeID))
 	_, err = session.ExpandVolume(volumeExpansionReq)
+	endProviderSpan(ctx, span, err)
 	if err != nil {
-		return nil, commonError.GetCSIBackendError(ctxLogger, requestID, err)
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
 	}
-	return &csi.ControllerExpandVolumeResponse{CapacityBytes: capacity, NodeExpansionRequired: true}, nil
+	return &csi.ControllerExpandVolumeResponse{CapacityBytes: capacity, NodeExpansionRequired: nodeExpansionRequired}, nil
 }
 
 // ControllerGetVolume ...
 func (csiCS *CSIControllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	return nil, commonError.GetCSIError(ctxLogger, commonError.MethodUnimplemented, requestID, nil, "ControllerGetVolume")
 }
 
 // ControllerModifyVolume ...
 func (csiCS *CSIControllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
-	return nil, commonError.GetCSIError(ctxLogger, commonError.MethodUnimplemented, requestID, nil, "ControllerModifyVolume")
+	ctxLogger, requestID := getContextLogger(ctx)
+	defer metrics.UpdateDurationFromStart(ctxLogger, "ControllerModifyVolume", time.Now())
+	ctxLogger.Info("CSIControllerServer-ControllerModifyVolume", zap.Reflect("Request", sanitizeRequest(req)))
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyVolumeID, requestID, nil)
+	}
+
+	// Reject the change of the attributes marked as immutable by the change-control policy
+	if err := validateMutableParameters(req.GetMutableParameters(), getImmutableVolumeAttributes(ctxLogger)); err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
+	}
+
+	session, err := csiCS.getProviderSession(ctx, ctxLogger)
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.FailedPrecondition, requestID, err)
+	}
+	volDetail, err := checkIfVolumeExists(session, provider.Volume{VolumeID: volumeID}, ctxLogger)
+	if volDetail == nil && err == nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.ObjectNotFound, requestID, nil, volumeID)
+	} else if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InternalError, requestID, err)
+	}
+
+	// The IOPS range and whether the throughput can be set depend on the profile of the volume
+	profileName := ""
+	if volDetail.Profile != nil {
+		profileName = volDetail.Profile.Name
+	}
+	iops, bandwidth, err := getModifyVolumeParameters(req.GetMutableParameters(), profileName)
+	if err != nil {
+		return nil, commonError.GetCSIError(ctxLogger, commonError.InvalidParameters, requestID, err)
+	}
+	if iops == 0 && bandwidth == 0 {
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	span := startProviderSpan(ctx, "ModifyVolume", attrVolumeID.String(volumeID))
+	err = csiCS.volumeModifier.modifyVolume(ctx, session, volumeID, iops, bandwidth)
+	endProviderSpan(ctx, span, err)
+	if err != nil {
+		return nil, csiCS.getCSIBackendError(ctxLogger, requestID, err)
+	}
+	return &csi.ControllerModifyVolumeResponse{}, nil
 }
@@ -18,20 +18,152 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"github.com/IBM/ibmcloud-volume-interface/config"
 	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
 	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	userError "github.com/IBM/ibmcloud-volume-vpc/common/messages"
+	iksprovider "github.com/IBM/ibmcloud-volume-vpc/iks/provider"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
 )
 
+// getProviderSession opens a provider session and counts the failures, which are
+// mostly IAM token generation errors, by reason code. The VPC API calls of the session
+// go through the shared rate limiter if VPC_API_RATE_LIMIT is set.
+func (csiCS *CSIControllerServer) getProviderSession(ctx context.Context, ctxLogger *zap.Logger) (provider.Session, error) {
+	session, err := csiCS.getUnlimitedProviderSession(ctx, ctxLogger)
+	if err != nil {
+		return session, err
+	}
+	if csiCS.apiLimiter != nil {
+		session = &rateLimitedSession{Session: session, ctx: ctx, ctxLogger: ctxLogger, limiter: csiCS.apiLimiter}
+	}
+	return session, nil
+}
+
+// getUnlimitedProviderSession opens a provider session whose VPC API calls are not rate limited, e.g for the
+// health check which must not wait behind the requests of the controller
+func (csiCS *CSIControllerServer) getUnlimitedProviderSession(ctx context.Context, ctxLogger *zap.Logger) (provider.Session, error) {
+	session, err := csiCS.CSIProvider.GetProviderSession(ctx, ctxLogger)
+	if err != nil {
+		providerSessionFailures.WithLabelValues(userError.GetUserErrorCode(err)).Inc()
+		return session, err
+	}
+	recordProviderTokenExpiry(ctxLogger, session)
+	return session, nil
+}
+
+// recordProviderTokenExpiry sets the provider token expiry gauge from the IAM access token of the VPC session, the
+// token is generated and refreshed by the provider library when the session is opened
+func recordProviderTokenExpiry(ctxLogger *zap.Logger, session provider.Session) {
+	creds, ok := getSessionCredentials(session)
+	if !ok || creds.AuthType != provider.IAMAccessToken {
+		return
+	}
+	expiry, err := getTokenExpiry(creds.Credential)
+	if err != nil {
+		ctxLogger.Debug("Unable to read the IAM token expiry", zap.Error(err))
+		return
+	}
+	providerTokenExpiry.Set(time.Until(expiry).Seconds())
+}
+
+// getVPCSession returns the VPC session of the provider session, the IKS sessions hold one too, false for the
+// sessions of other providers
+func getVPCSession(session provider.Session) (*vpcprovider.VPCSession, bool) {
+	if limited, ok := session.(*rateLimitedSession); ok {
+		session = limited.Session
+	}
+	switch s := session.(type) {
+	case *vpcprovider.VPCSession:
+		return s, true
+	case *iksprovider.IksVpcSession:
+		return &s.VPCSession, true
+	}
+	return nil, false
+}
+
+// getSessionCredentials returns the credentials the VPC session was opened with, false for the sessions of other
+// providers
+func getSessionCredentials(session provider.Session) (provider.ContextCredentials, bool) {
+	vpcSession, ok := getVPCSession(session)
+	if !ok {
+		return provider.ContextCredentials{}, false
+	}
+	return vpcSession.ContextCredentials, true
+}
+
+// getTokenExpiry returns the expiry of the JWT access token from its exp claim, the token is not verified
+func getTokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid access token payload: %v", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("invalid access token claims: %v", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("access token has no exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// requestIDMetadataKey returns the gRPC metadata key carrying the request ID of the caller, REQUEST_ID_METADATA_KEY
+// or x-request-id by default
+func requestIDMetadataKey() string {
+	if key := os.Getenv("REQUEST_ID_METADATA_KEY"); key != "" {
+		return key
+	}
+	return defaultRequestIDMetadataKey
+}
+
+// getRequestID returns the request ID supplied in the gRPC metadata of the request, empty if not supplied
+func getRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadataKey()); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// getContextLogger returns the logger and the request ID of a request. The request ID supplied by the caller in the
+// gRPC metadata key set in REQUEST_ID_METADATA_KEY (x-request-id by default) is used if present so the logs can be
+// correlated with the caller, a new request ID is generated otherwise.
+func getContextLogger(ctx context.Context) (*zap.Logger, string) {
+	if requestID := getRequestID(ctx); requestID != "" {
+		return utils.GetContextLoggerWithRequestID(ctx, false, &requestID)
+	}
+	return utils.GetContextLogger(ctx, false)
+}
+
 // normalize the requested capacity(in GiB) to what is supported by the driver
 func getRequestedCapacity(capRange *csi.CapacityRange, profileName string) (int64, error) {
 	// Input is in bytes from csi
@@ -79,6 +211,12 @@ func getRequestedCapacity(capRange *csi.CapacityRange, profileName string) (int6
 
 // Verify that Requested volume capabailites match with what is supported by the driver
 func areVolumeCapabilitiesSupported(volCaps []*csi.VolumeCapability, driverVolumeCaps []*csi.VolumeCapability_AccessMode) bool {
+	return validateVolumeCapabilities(volCaps, driverVolumeCaps) == nil
+}
+
+// validateVolumeCapabilities returns an error describing the first requested access mode not supported by the driver.
+// Multi node access modes are rejected explicitly as a VPC block volume can be attached to a single node only
+func validateVolumeCapabilities(volCaps []*csi.VolumeCapability, driverVolumeCaps []*csi.VolumeCapability_AccessMode) error {
 	isSupport := func(cap *csi.VolumeCapability) bool {
 		for _, c := range driverVolumeCaps {
 			if c.GetMode() == cap.AccessMode.GetMode() {
@@ -88,13 +226,50 @@ func areVolumeCapabilitiesSupported(volCaps []*csi.VolumeCapability, driverVolum
 		return false
 	}
 
-	allSupported := true
 	for _, c := range volCaps {
+		mode := c.GetAccessMode().GetMode()
+		switch mode {
+		case csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER:
+			return fmt.Errorf("access mode %s is not supported, IBM VPC block volumes can only be attached to a single node", mode)
+		}
 		if !isSupport(c) {
-			allSupported = false
+			return fmt.Errorf("access mode %s is not supported", mode)
 		}
 	}
-	return allSupported
+	return nil
+}
+
+// validateVolumeMatch returns an error describing why the volume cannot be used with the capabilities, the volume context
+// and the parameters of the request, nil if the volume matches
+func validateVolumeMatch(volume *provider.Volume, req *csi.ValidateVolumeCapabilitiesRequest, driverVolumeCaps []*csi.VolumeCapability_AccessMode) error {
+	if err := validateVolumeCapabilities(req.GetVolumeCapabilities(), driverVolumeCaps); err != nil {
+		return err
+	}
+	// A VPC block volume can be consumed both as a raw block device and as a file system
+	for _, c := range req.GetVolumeCapabilities() {
+		if fsType := c.GetMount().GetFsType(); len(fsType) != 0 && !isSupportedFS(fsType) {
+			return fmt.Errorf("unsupported fstype <%s>. Supported types: %v", fsType, SupportedFS)
+		}
+	}
+	if volume == nil {
+		return nil
+	}
+	if volume.Status == volumeStatusFailed {
+		return fmt.Errorf("volume %s is in %s state", volume.VolumeID, volume.Status)
+	}
+	volumeContext := req.GetVolumeContext()
+	if id := volumeContext[VolumeIDLabel]; len(id) != 0 && id != volume.VolumeID {
+		return fmt.Errorf("volume context is for volume %s", id)
+	}
+	if zone := volumeContext[utils.NodeZoneLabel]; len(zone) != 0 && len(volume.Az) != 0 && zone != volume.Az {
+		return fmt.Errorf("volume is in zone %s, not %s", volume.Az, zone)
+	}
+	if profile := req.GetParameters()[Profile]; len(profile) != 0 && volume.Profile != nil && profile != volume.Profile.Name {
+		return fmt.Errorf("volume has profile %s, not %s", volume.Profile.Name, profile)
+	}
+	return nil
 }
 
 // getVolumeParameters this function get the parameters from storage class, this also validate
@@ -150,7 +325,9 @@ func getVolumeParameters(logger *zap.Logger, req *csi.CreateVolumeRequest, confi
 				err = fmt.Errorf("%s: exceeds %d bytes", key, EncryptionKeyMaxLen)
 			} else {
 				if len(value) != 0 {
-					volume.VolumeEncryptionKey = &provider.VolumeEncryptionKey{CRN: value}
+					if err = validateEncryptionKeyCRN(value); err == nil {
+						volume.VolumeEncryptionKey = &provider.VolumeEncryptionKey{CRN: value}
+					}
 				}
 			}
 
@@ -177,6 +354,27 @@ func getVolumeParameters(logger *zap.Logger, req *csi.CreateVolumeRequest, confi
 					volume.Bandwidth = int32(bandwidth)
 				}
 			}
+		case IOScheduler:
+			// Applied by the node server while staging the volume, see nodeVolumeContextParams
+			if len(value) == 0 || len(value) > IOSchedulerMaxLen || strings.ContainsAny(value, " /[]") {
+				err = fmt.Errorf("%s:<%v> is not a valid I/O scheduler name", key, value)
+			}
+		case DryRun:
+			if value != TrueStr && value != FalseStr {
+				err = fmt.Errorf("'<%v>' is invalid, value of '%s' should be [true|false]", value, key)
+			} else if value == TrueStr && (len(req.GetParameters()[PVName]) != 0 || len(req.GetParameters()[PVCName]) != 0) {
+				// Set in a StorageClass, the external-provisioner would retry the dry run forever
+				err = fmt.Errorf("'%s' can not be set in a StorageClass", key)
+			}
+		case PVCName, PVCNamespace, PVName:
+			// Added by the external provisioner, the PVC namespace is used for the namespace volume quota
+		case StorageClassName:
+			// Only used as label of the CreateVolume counters
+		case MountOptions:
+			// Applied by the node server while mounting the volume, see nodeVolumeContextParams
+			if len(splitMountOptions(value)) == 0 || strings.ContainsAny(value, " \t") {
+				err = fmt.Errorf("%s:<%v> is not a valid comma separated list of mount options", key, value)
+			}
 		default:
 			err = fmt.Errorf("<%s> is an invalid parameter", key)
 		}
@@ -232,7 +430,7 @@ func getVolumeParameters(logger *zap.Logger, req *csi.CreateVolumeRequest, confi
 			continue
 		}
 		if len(mnt.FsType) == 0 {
-			volume.VolumeType = provider.VolumeType(defaultFsType)
+			volume.VolumeType = provider.VolumeType(getDefaultFsType(logger))
 		} else {
 			if utils.ListContainsSubstr(SupportedFS, mnt.FsType) {
 				volume.VolumeType = provider.VolumeType(mnt.FsType)
@@ -252,6 +450,17 @@ func getVolumeParameters(logger *zap.Logger, req *csi.CreateVolumeRequest, confi
 		volume.Iops = nil
 	}
 
+	if err = validateProfileIops(volume.Profile.Name, volume.Iops); err != nil {
+		logger.Error("getVolumeParameters", zap.NamedError("InvalidParameter", err))
+		return volume, err
+	}
+
+	// If zone is provided in storage class parameters it must be one of the accessible topology zones
+	if err = validateZoneTopology(volume.Az, req.GetAccessibilityRequirements()); err != nil {
+		logger.Error("getVolumeParameters", zap.NamedError("InvalidParameter", err))
+		return volume, err
+	}
+
 	//If  zone not provided in storage class parameters then we pick from the Topology
 	if len(strings.TrimSpace(volume.Az)) == 0 {
 		zones, err := pickTargetTopologyParams(req.GetAccessibilityRequirements())
@@ -296,7 +505,9 @@ func overrideParams(logger *zap.Logger, req *csi.CreateVolumeRequest, config *co
 			} else {
 				if len(value) != 0 {
 					logger.Info("override", zap.String("parameter", EncryptionKey))
-					volume.VolumeEncryptionKey = &provider.VolumeEncryptionKey{CRN: value}
+					if err = validateEncryptionKeyCRN(value); err == nil {
+						volume.VolumeEncryptionKey = &provider.VolumeEncryptionKey{CRN: value}
+					}
 				}
 			}
 		case Tag:
@@ -353,6 +564,28 @@ func overrideParams(logger *zap.Logger, req *csi.CreateVolumeRequest, config *co
 	return nil
 }
 
+// isVolumeNotFoundError returns true if the provider error reports the volume does not exist. The provider reports
+// every deletion failure as FailedToDeleteVolume, the VPC API error it wraps tells a missing volume
+func isVolumeNotFoundError(err error) bool {
+	if providerError.GetErrorType(err) == providerError.EntityNotFound {
+		return true
+	}
+	return isBackendNotFoundError(err)
+}
+
+// isSnapshotNotFoundError returns true if the snapshot lookup failed as the snapshot does not exist. The provider
+// reports every lookup failure as SnapshotIDNotFound, the VPC API error it wraps tells a missing snapshot from e.g an
+// authentication failure
+func isSnapshotNotFoundError(err error) bool {
+	if providerError.GetErrorType(err) != providerError.RetrivalFailed {
+		return false
+	}
+	if msg, ok := err.(providerError.Message); ok && len(msg.BackendError) == 0 {
+		return true
+	}
+	return isBackendNotFoundError(err)
+}
+
 // checkIfVolumeExists ...
 func checkIfVolumeExists(session provider.Session, vol provider.Volume, ctxLogger *zap.Logger) (*provider.Volume, error) {
 	// Check if Requested Volume exists
@@ -389,6 +622,86 @@ func checkIfVolumeExists(session provider.Session, vol provider.Volume, ctxLogge
 	return existingVol, err
 }
 
+// volumeDeletionPollInterval wait between two checks of a volume being deleted
+var volumeDeletionPollInterval = 5 * time.Second
+
+// waitForVolumeDeletion polls the backend until the deleted volume is gone. A retryable DeadlineExceeded error
+// is returned if the volume still exists after the timeout, lookup errors are retried until then.
+func waitForVolumeDeletion(ctx context.Context, ctxLogger *zap.Logger, session provider.Session, volumeID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		existingVol, err := checkIfVolumeExists(session, provider.Volume{VolumeID: volumeID}, ctxLogger)
+		if existingVol == nil && err == nil {
+			ctxLogger.Info("Volume deletion confirmed by the backend", zap.String("VolumeID", volumeID))
+			return nil
+		}
+		if time.Now().After(deadline) {
+			ctxLogger.Warn("Volume deletion not confirmed in time", zap.String("VolumeID", volumeID), zap.Duration("Timeout", timeout), zap.Error(err))
+			return status.Errorf(codes.DeadlineExceeded, "deletion of volume %s is not confirmed by the backend after %v, retry later", volumeID, timeout)
+		}
+		select {
+		case <-time.After(volumeDeletionPollInterval):
+		case <-ctx.Done():
+			return contextError(ctx)
+		}
+	}
+}
+
+// volumeCreationPollInterval first wait between two checks of a volume being created, it is doubled after
+// every check up to volumeCreationMaxPollInterval
+var volumeCreationPollInterval = 2 * time.Second
+
+// volumeCreationMaxPollInterval ...
+const volumeCreationMaxPollInterval = 30 * time.Second
+
+// volumeNotAvailableErrors backend error codes returned when a created volume did not become available in time
+var volumeNotAvailableErrors = []string{"VolumeNotInValidState"}
+
+const (
+	// volumeStatusAvailable status of a volume which can be attached
+	volumeStatusAvailable = "available"
+	// volumeStatusFailed status of a volume whose creation failed
+	volumeStatusFailed = "failed"
+)
+
+// waitForVolumeAvailable polls the backend until the created volume is available. A retryable DeadlineExceeded
+// error is returned if the volume is still not available after the timeout, the volume is not deleted so the
+// retry of the same name finds it and waits again. Lookup errors are retried until then.
+func waitForVolumeAvailable(ctx context.Context, ctxLogger *zap.Logger, session provider.Session, volume *provider.Volume, timeout time.Duration) (*provider.Volume, error) {
+	deadline := time.Now().Add(timeout)
+	interval := volumeCreationPollInterval
+	for {
+		switch volume.Status {
+		case "", volumeStatusAvailable:
+			// Status is not reported by every provider, such volumes are considered available
+			return volume, nil
+		case volumeStatusFailed:
+			ctxLogger.Error("Volume creation failed in the backend", zap.String("VolumeID", volume.VolumeID))
+			return nil, status.Errorf(codes.Internal, "volume %s is in %s state", volume.VolumeID, volume.Status)
+		}
+		if time.Now().After(deadline) {
+			ctxLogger.Warn("Volume not available in time", zap.String("VolumeID", volume.VolumeID), zap.String("Status", volume.Status), zap.Duration("Timeout", timeout))
+			return nil, status.Errorf(codes.DeadlineExceeded, "volume %s is not available after %v, retry later", volume.VolumeID, timeout)
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, contextError(ctx)
+		}
+		if interval *= 2; interval > volumeCreationMaxPollInterval {
+			interval = volumeCreationMaxPollInterval
+		}
+		latest, err := checkIfVolumeExists(session, provider.Volume{VolumeID: volume.VolumeID, Region: volume.Region}, ctxLogger)
+		if err != nil {
+			ctxLogger.Warn("Unable to get the volume being created", zap.String("VolumeID", volume.VolumeID), zap.Error(err))
+			continue
+		}
+		if latest != nil {
+			volume = latest
+		}
+	}
+}
+
 // createCSIVolumeResponse ...
 func createCSIVolumeResponse(vol provider.Volume, capBytes int64, zones []string, clusterID string, region string) *csi.CreateVolumeResponse {
 	var src *csi.VolumeContentSource
@@ -411,6 +724,10 @@ func createCSIVolumeResponse(vol provider.Volume, capBytes int64, zones []string
 	if vol.Iops != nil && len(*vol.Iops) > 0 {
 		labels[IOPSLabel] = *vol.Iops
 	}
+	// Bandwidth is only reported for the profiles which support it
+	if vol.Bandwidth > 0 {
+		labels[BandwidthLabel] = strconv.Itoa(int(vol.Bandwidth))
+	}
 
 	if vol.Region != "" {
 		labels[utils.NodeRegionLabel] = vol.Region
@@ -439,6 +756,73 @@ func createCSIVolumeResponse(vol provider.Volume, capBytes int64, zones []string
 	return volResp
 }
 
+// dryRunError returns the error of a validated dry run CreateVolume. It is an error rather than a response so that
+// no caller mistakes the result for a created volume, its ErrorInfo detail of reason DryRunOKReason tells it from a
+// failed request and has the capacity, zone and profile the volume would get.
+func dryRunError(requestedVolume *provider.Volume, domain string) error {
+	dryRunStatus := status.Newf(codes.FailedPrecondition, "dry run: request valid, volume of %d GiB in zone %s not created", *requestedVolume.Capacity, requestedVolume.Az)
+	metadata := map[string]string{"capacity": fmt.Sprintf("%dGi", *requestedVolume.Capacity), "zone": requestedVolume.Az}
+	if requestedVolume.Profile != nil {
+		metadata["profile"] = requestedVolume.Profile.Name
+	}
+	withDetails, err := dryRunStatus.WithDetails(&errdetails.ErrorInfo{Reason: DryRunOKReason, Domain: domain, Metadata: metadata})
+	if err != nil {
+		return dryRunStatus.Err()
+	}
+	return withDetails.Err()
+}
+
+// dryRunVolumeExistsError returns the error of a dry run CreateVolume for which a volume of the same name exists,
+// the request is not reported as valid since no volume would be created
+func dryRunVolumeExistsError(name string) error {
+	return status.Errorf(codes.AlreadyExists, "dry run: volume with name '%s' already exists, no volume would be created", name)
+}
+
+// nodeVolumeContextParams storage class parameters which are not used by the provider
+// but passed as it is to the node server through the volume context
+var nodeVolumeContextParams = []string{IOScheduler, MountOptions}
+
+// getDefaultedFsType returns the file system type the volume got from DEFAULT_FS_TYPE, empty if the volume
+// capability sets one or the volume is a block volume
+func getDefaultedFsType(volumeCapabilities []*csi.VolumeCapability, volume *provider.Volume) provider.VolumeType {
+	for _, vcap := range volumeCapabilities {
+		if mnt := vcap.GetMount(); mnt != nil {
+			if len(mnt.FsType) == 0 {
+				return volume.VolumeType
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// addNodeVolumeContext copies the node server specific storage class parameters in the volume context, with the
+// default file system type the volume was created for so that the node server formats it with the same one
+func addNodeVolumeContext(volResp *csi.CreateVolumeResponse, params map[string]string, fsType provider.VolumeType) *csi.CreateVolumeResponse {
+	for _, key := range nodeVolumeContextParams {
+		if value, ok := params[key]; ok && len(value) != 0 {
+			volResp.Volume.VolumeContext[key] = value
+		}
+	}
+	if len(fsType) != 0 {
+		volResp.Volume.VolumeContext[FsType] = string(fsType)
+	}
+	return volResp
+}
+
+// getVolumeSourceTag returns the provenance tag of a volume provisioned from a content source,
+// i.e source:snapshot:<snapshotID> or source:clone:<volumeID>, empty for a plain volume
+func getVolumeSourceTag(volumeSource *csi.VolumeContentSource) string {
+	if snapshot := volumeSource.GetSnapshot(); snapshot != nil && len(snapshot.GetSnapshotId()) != 0 {
+		snapshotID, _ := getSnapshotAndAccountIDsFromCRN(strings.ReplaceAll(snapshot.GetSnapshotId(), " ", ""))
+		return sourceSnapshotTagPrefix + snapshotID
+	}
+	if volume := volumeSource.GetVolume(); volume != nil && len(volume.GetVolumeId()) != 0 {
+		return sourceCloneTagPrefix + volume.GetVolumeId()
+	}
+	return ""
+}
+
 // getAccountID ...
 func getAccountID(input string) string {
 	tokens := strings.Split(input, "/")
@@ -463,6 +847,216 @@ func getSnapshotAndAccountIDsFromCRN(crn string) (string, string) {
 	return crn, "" // assuming that crn will contain only snapshotID
 }
 
+// validTagRegexp characters permitted in a tag
+var validTagRegexp = regexp.MustCompile(`^[A-Za-z0-9 _.:-]+$`)
+
+// getClusterNameTag returns the clusterName:<name> tag for the cluster name set in CLUSTER_NAME,
+// empty if the cluster name is unknown or can not be used in a tag
+func getClusterNameTag(ctxLogger *zap.Logger) string {
+	clusterName := strings.TrimSpace(os.Getenv("CLUSTER_NAME"))
+	if len(clusterName) == 0 {
+		return ""
+	}
+	tag := clusterNameTagPrefix + clusterName
+	if len(tag) > maxTagLen || !validTagRegexp.MatchString(tag) {
+		ctxLogger.Warn("Cluster name can not be used as a volume tag, skipping it", zap.String("CLUSTER_NAME", clusterName))
+		return ""
+	}
+	return tag
+}
+
+// addTagWithinLimit appends the tag if the volume stays within maxVolumeTags including the
+// reserved tags added later by the provider library e.g the cluster volume label tags
+func addTagWithinLimit(ctxLogger *zap.Logger, tags []string, tag string, reserved int) []string {
+	if len(tags)+reserved >= maxVolumeTags {
+		ctxLogger.Warn("Volume tag limit reached, skipping tag", zap.String("Tag", tag), zap.Int("Limit", maxVolumeTags))
+		return tags
+	}
+	return append(tags, tag)
+}
+
+// invalidResourceNameChars characters not permitted in a VPC resource name
+var invalidResourceNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// getSnapshotNamePrefix returns the prefix of the backend snapshot names, SNAPSHOT_NAME_PREFIX if set
+// else the cluster ID if SNAPSHOT_NAME_CLUSTER_SCOPED is true. Empty keeps the CSI snapshot name as is.
+func getSnapshotNamePrefix(clusterID string) string {
+	prefix := strings.TrimSpace(os.Getenv("SNAPSHOT_NAME_PREFIX"))
+	if len(prefix) == 0 && strings.ToLower(os.Getenv("SNAPSHOT_NAME_CLUSTER_SCOPED")) == "true" {
+		prefix = clusterID
+	}
+	return strings.Trim(invalidResourceNameChars.ReplaceAllString(strings.ToLower(prefix), "-"), "-")
+}
+
+// getBackendSnapshotName returns the VPC snapshot name of a CSI snapshot name, scoped by the prefix so that
+// the same CSI name in two clusters of an account does not collide. Names longer than the VPC limit are
+// truncated and suffixed with a hash of the full name so that they stay unique and stable across retries.
+func getBackendSnapshotName(prefix string, csiName string) string {
+	if len(prefix) == 0 {
+		return csiName
+	}
+	name := prefix + "-" + csiName
+	if len(name) <= maxResourceNameLen {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	return strings.TrimRight(name[:maxResourceNameLen-snapshotNameHashLen-1], "-") + "-" + hex.EncodeToString(hash[:])[:snapshotNameHashLen]
+}
+
+// getRegionFromCRN returns the region of the resource CRN e.g us-south for
+// crn:v1:bluemix:public:is:us-south:a/c468d8642937fecd8a0860fe0f379bf9::snapshot:r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb
+func getRegionFromCRN(crn string) string {
+	crnTokens := strings.Split(strings.ReplaceAll(crn, " ", ""), ":")
+	if len(crnTokens) > 9 {
+		return crnTokens[5]
+	}
+	return ""
+}
+
+// getRegionFromZone returns the region of a VPC zone e.g us-south for us-south-1, empty if the zone
+// does not follow the <region>-<number> naming
+func getRegionFromZone(zone string) string {
+	i := strings.LastIndex(zone, "-")
+	if i <= 0 {
+		return ""
+	}
+	if _, err := strconv.Atoi(zone[i+1:]); err != nil {
+		return ""
+	}
+	return zone[:i]
+}
+
+// validateSnapshotRegion checks the snapshot can be restored in the zone of the requested volume.
+// A snapshot is restorable only in the region it belongs to, a snapshot copied to another region
+// has its own CRN in the target region so the copy must be used to restore there.
+// Validation is skipped if the snapshot or the volume region can not be determined.
+func validateSnapshotRegion(session provider.Session, volume *provider.Volume, ctxLogger *zap.Logger) error {
+	snapshotCRN := volume.SnapshotCRN
+	if len(snapshotCRN) == 0 && len(volume.SnapshotID) != 0 {
+		snapshot, err := session.GetSnapshot(volume.SnapshotID)
+		if err != nil || snapshot == nil {
+			ctxLogger.Warn("Unable to get snapshot details, skipping snapshot region validation", zap.String("SnapshotID", volume.SnapshotID), zap.Error(err))
+			return nil
+		}
+		snapshotCRN = snapshot.SnapshotCRN
+	}
+	snapshotRegion := getRegionFromCRN(snapshotCRN)
+	volumeRegion := getRegionFromZone(volume.Az)
+	if len(volumeRegion) == 0 {
+		volumeRegion = volume.Region
+	}
+	if len(snapshotRegion) == 0 || len(volumeRegion) == 0 || snapshotRegion == volumeRegion {
+		return nil
+	}
+	return fmt.Errorf("snapshot <%s> belongs to region %s and can not be restored in zone %s of region %s, copy the snapshot to region %s and restore from the copy",
+		snapshotCRN, snapshotRegion, volume.Az, volumeRegion, volumeRegion)
+}
+
+// getSnapshotRestoreSize returns the minimum capacity in bytes of a volume restored from the snapshot, 0 if the
+// snapshot cannot be looked up
+func getSnapshotRestoreSize(session provider.Session, volume *provider.Volume, ctxLogger *zap.Logger) int64 {
+	snapshotID := volume.SnapshotID
+	if len(snapshotID) == 0 {
+		// The snapshot ID is the last token of the snapshot CRN
+		crnTokens := strings.Split(strings.ReplaceAll(volume.SnapshotCRN, " ", ""), ":")
+		snapshotID = crnTokens[len(crnTokens)-1]
+	}
+	if len(snapshotID) == 0 {
+		return 0
+	}
+	snapshot, err := session.GetSnapshot(snapshotID)
+	if err != nil || snapshot == nil {
+		ctxLogger.Warn("Unable to get snapshot details, skipping snapshot restore size validation", zap.String("SnapshotID", snapshotID), zap.Error(err))
+		return 0
+	}
+	return snapshot.SnapshotSize
+}
+
+// checkSnapshotRestoreSize returns an OutOfRange error if the requested capacity in GiB is smaller than the snapshot
+// minimum capacity in bytes, which VPC would reject
+func checkSnapshotRestoreSize(restoreSize int64, capacity int) error {
+	if restoreSize > int64(capacity)*utils.GiB {
+		return status.Errorf(codes.OutOfRange, "requested capacity %d GiB is smaller than the snapshot minimum capacity %d GiB", capacity, utils.BytesToGiB(restoreSize))
+	}
+	return nil
+}
+
+// getSnapshotConsistency returns the validated consistency parameter of the snapshot request, empty if not set
+func getSnapshotConsistency(params map[string]string) (string, error) {
+	consistency, ok := params[SnapshotConsistency]
+	if !ok {
+		return "", nil
+	}
+	consistency = strings.ToLower(strings.TrimSpace(consistency))
+	for _, supported := range supportedSnapshotConsistencies {
+		if consistency == supported {
+			return consistency, nil
+		}
+	}
+	return "", fmt.Errorf("%s:<%v> not supported, supported values are %v", SnapshotConsistency, params[SnapshotConsistency], supportedSnapshotConsistencies)
+}
+
+// snapshotMetadataTags tag keys of the VolumeSnapshot metadata added by the external snapshotter
+var snapshotMetadataTags = map[string]string{
+	VolumeSnapshotNamespace:   "namespace",
+	VolumeSnapshotName:        "volumesnapshot",
+	VolumeSnapshotContentName: "volumesnapshotcontent",
+}
+
+// addSnapshotTag sets the tag if it is valid and the snapshot stays within maxVolumeTags, the tags
+// which can not be set are skipped as the volume tags are
+func addSnapshotTag(ctxLogger *zap.Logger, tags provider.SnapshotTags, key string, value string) {
+	tag := key
+	if len(value) != 0 {
+		tag = key + ":" + value
+	}
+	if len(key) == 0 || len(tag) > maxTagLen || !validTagRegexp.MatchString(tag) {
+		ctxLogger.Warn("Tag can not be used as a snapshot tag, skipping it", zap.String("Tag", tag))
+		return
+	}
+	if _, exists := tags[key]; !exists && len(tags) >= maxVolumeTags {
+		ctxLogger.Warn("Snapshot tag limit reached, skipping tag", zap.String("Tag", tag), zap.Int("Limit", maxVolumeTags))
+		return
+	}
+	tags[key] = value
+}
+
+// getSnapshotTags returns the tags of a snapshot: the user tags of the tags snapshot class parameter e.g
+// "team:storage,env:prod", the namespace and names of the VolumeSnapshot and the ID of the source volume, its
+// CRN can not be used as it contains '/'. The bookkeeping tags take precedence over the user tags with the same key.
+func getSnapshotTags(ctxLogger *zap.Logger, snapshotName string, sourceVolumeID string, params map[string]string) provider.SnapshotTags {
+	tags := provider.SnapshotTags{}
+	for _, tag := range strings.Split(params[Tag], ",") {
+		if tag = strings.TrimSpace(tag); len(tag) == 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(tag, ":")
+		addSnapshotTag(ctxLogger, tags, strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	for param, key := range snapshotMetadataTags {
+		if value := params[param]; len(value) != 0 {
+			addSnapshotTag(ctxLogger, tags, key, value)
+		}
+	}
+	addSnapshotTag(ctxLogger, tags, "source_volume", sourceVolumeID)
+	tags["name"] = snapshotName
+	return tags
+}
+
+// tagSnapshot attaches the tags to the snapshot through the Global Tagging API. A failure is only logged as the
+// snapshot is usable without its tags, they are attached again if CreateSnapshot is called for the snapshot again
+func (csiCS *CSIControllerServer) tagSnapshot(ctx context.Context, ctxLogger *zap.Logger, session provider.Session, snapshot *provider.Snapshot, tags provider.SnapshotTags) {
+	if csiCS.snapshotTagger == nil || len(snapshot.SnapshotCRN) == 0 || len(tags) == 0 {
+		return
+	}
+	span := startProviderSpan(ctx, "AttachSnapshotTags", attrSnapshotID.String(snapshot.SnapshotID))
+	err := csiCS.snapshotTagger.attachTags(ctx, session, snapshot.SnapshotCRN, getTagNames(tags))
+	endProviderSpan(ctx, span, err)
+	if err != nil {
+		ctxLogger.Warn("Failed to tag the snapshot", zap.String("SnapshotCRN", snapshot.SnapshotCRN), zap.Error(err))
+	}
+}
+
 // createCSISnapshotResponse ...
 func createCSISnapshotResponse(snapshot provider.Snapshot) *csi.CreateSnapshotResponse {
 	ts := timestamppb.New(snapshot.SnapshotCreationTime)
@@ -493,9 +1087,96 @@ func createControllerPublishVolumeResponse(volumeAttachmentResponse provider.Vol
 	}
 }
 
+// encryptionKeyServices IBM Cloud services providing the customer root keys of the volumes i.e Key Protect and HPCS
+var encryptionKeyServices = []string{"kms", "hs-crypto"}
+
+// validateEncryptionKeyCRN verifies the encryption key is the CRN of a Key Protect or HPCS root key e.g
+// crn:v1:bluemix:public:kms:us-south:a/<account ID>:<instance ID>:key:<key ID>
+func validateEncryptionKeyCRN(crn string) error {
+	crnTokens := strings.Split(crn, ":")
+	if len(crnTokens) != 10 || crnTokens[0] != "crn" || crnTokens[1] != "v1" || crnTokens[8] != "key" || len(crnTokens[9]) == 0 || len(crnTokens[7]) == 0 {
+		return fmt.Errorf("%s:<%v> is not a valid root key CRN, expecting crn:v1:<cloud>:<type>:<service>:<region>:a/<account>:<instance>:key:<key>", EncryptionKey, crn)
+	}
+	for _, service := range encryptionKeyServices {
+		if crnTokens[4] == service {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s:<%v> is not a key of a supported service, supported services are %v", EncryptionKey, crn, encryptionKeyServices)
+}
+
+// getEncryptionTag returns the tag recording whether the volume is encrypted with a customer root key or by the provider
+func getEncryptionTag(volume *provider.Volume) string {
+	if volume.VolumeEncryptionKey != nil && len(volume.VolumeEncryptionKey.CRN) != 0 {
+		return encryptionTagPrefix + customerManagedEncryption
+	}
+	return encryptionTagPrefix + providerManagedEncryption
+}
+
+// abnormalVolumeStatuses VPC volume statuses reported as abnormal volume conditions
+var abnormalVolumeStatuses = map[string]string{
+	"failed":   "volume is in failed state on the VPC backend",
+	"unusable": "volume is unusable on the VPC backend, e.g its encryption key is disabled or deleted",
+}
+
+// getVPCVolumeCondition returns the condition of the volume from its VPC status
+func getVPCVolumeCondition(vol *provider.Volume) *csi.VolumeCondition {
+	if message, abnormal := abnormalVolumeStatuses[vol.Status]; abnormal {
+		return &csi.VolumeCondition{Abnormal: true, Message: message}
+	}
+	return &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+}
+
+// validateProfileIops verifies the IOPS of a custom or sdp volume are within the range allowed by its profile,
+// the capacity and the IOPS of these profiles are set independently
+func validateProfileIops(profileName string, iops *string) error {
+	iopsRange, ok := profileIopsRanges[profileName]
+	if !ok || iops == nil || len(*iops) == 0 {
+		return nil
+	}
+	value, err := strconv.Atoi(*iops)
+	if err != nil {
+		return fmt.Errorf("%s:<%v> is invalid, value should be an integer", IOPS, *iops)
+	}
+	if value < iopsRange[0] || value > iopsRange[1] {
+		return fmt.Errorf("%s:<%v> is out of the range allowed by the %s profile, value should be between %d and %d", IOPS, *iops, profileName, iopsRange[0], iopsRange[1])
+	}
+	return nil
+}
+
+// validateZoneTopology verifies that the zone parameter is one of the zones of the requisite topologies, or of the
+// preferred ones if none is requisite, it is valid if the zone parameter or the topology requirement is not set
+func validateZoneTopology(zone string, top *csi.TopologyRequirement) error {
+	if len(strings.TrimSpace(zone)) == 0 || top == nil {
+		return nil
+	}
+	topologies := top.GetRequisite()
+	if len(topologies) == 0 {
+		topologies = top.GetPreferred()
+	}
+	zones := []string{}
+	for _, topology := range topologies {
+		if topologyZone, ok := topology.GetSegments()[utils.NodeZoneLabel]; ok {
+			if topologyZone == zone {
+				return nil
+			}
+			zones = append(zones, topologyZone)
+		}
+	}
+	if len(zones) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s:<%v> conflicts with the accessible topology zones %v", Zone, zone, zones)
+}
+
+// pickTargetTopologyParams returns the segments of the first preferred topology with a zone, or of the first
+// requisite one if no preferred topology has a zone
 func pickTargetTopologyParams(top *csi.TopologyRequirement) (map[string]string, error) {
 	prefTopologyParams, err := getPrefedTopologyParams(top.GetPreferred())
 	if err != nil {
+		if reqTopologyParams, reqErr := getPrefedTopologyParams(top.GetRequisite()); reqErr == nil {
+			return reqTopologyParams, nil
+		}
 		return nil, fmt.Errorf("could not get zones from preferred topology: %v", err)
 	}
 
@@ -505,7 +1186,7 @@ func pickTargetTopologyParams(top *csi.TopologyRequirement) (map[string]string,
 func getPrefedTopologyParams(topList []*csi.Topology) (map[string]string, error) {
 	for _, top := range topList {
 		segment := top.GetSegments()
-		if segment != nil {
+		if len(segment[utils.NodeZoneLabel]) != 0 {
 			return segment, nil
 		}
 	}
@@ -535,3 +1216,156 @@ func getMaxDelaySnapshotCreate(ctxLogger *zap.Logger) int {
 
 	return customSnapshotCreateDelay
 }
+
+// getImmutableVolumeAttributes returns the volume attributes which are not allowed to be modified by
+// ControllerModifyVolume, set as comma separated list e.g IMMUTABLE_VOLUME_ATTRIBUTES="iops,throughput"
+func getImmutableVolumeAttributes(ctxLogger *zap.Logger) map[string]bool {
+	immutableAttributes := make(map[string]bool)
+	immutableEnv := os.Getenv("IMMUTABLE_VOLUME_ATTRIBUTES")
+	if immutableEnv == "" {
+		return immutableAttributes
+	}
+	for _, attribute := range strings.Split(immutableEnv, ",") {
+		attribute = strings.TrimSpace(attribute)
+		switch attribute {
+		case IOPS, Throughput:
+			immutableAttributes[attribute] = true
+		case "":
+		default:
+			ctxLogger.Warn("Ignoring unsupported immutable volume attribute", zap.String("IMMUTABLE_VOLUME_ATTRIBUTES", immutableEnv), zap.String("attribute", attribute))
+		}
+	}
+	return immutableAttributes
+}
+
+// validateMutableParameters verifies that none of the immutable attributes is requested to be modified
+func validateMutableParameters(mutableParameters map[string]string, immutableAttributes map[string]bool) error {
+	for key := range mutableParameters {
+		if immutableAttributes[key] {
+			return fmt.Errorf("'%s' is immutable and cannot be modified, immutable attributes are set by IMMUTABLE_VOLUME_ATTRIBUTES", key)
+		}
+	}
+	return nil
+}
+
+// getNamespaceVolumeQuotas returns the max number of volumes per namespace from NAMESPACE_VOLUME_QUOTA
+// e.g "*:50;team-a:10", where "*" applies to the namespaces not listed
+func getNamespaceVolumeQuotas() (map[string]int, error) {
+	quotas := make(map[string]int)
+	for _, entry := range strings.Split(os.Getenv("NAMESPACE_VOLUME_QUOTA"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		ns, value, found := strings.Cut(entry, ":")
+		quota, err := strconv.Atoi(strings.TrimSpace(value))
+		if !found || err != nil || quota < 0 {
+			return nil, fmt.Errorf("<%s> is not a valid entry, expecting <namespace>:<max volumes>", entry)
+		}
+		quotas[strings.TrimSpace(ns)] = quota
+	}
+	return quotas, nil
+}
+
+// getNamespaceVolumeQuota returns the max number of volumes of the namespace, 0 means no quota
+func getNamespaceVolumeQuota(quotas map[string]int, namespace string) int {
+	if quota, ok := quotas[namespace]; ok {
+		return quota
+	}
+	return quotas[defaultNamespaceQuotaKey]
+}
+
+// countNamespaceVolumes returns the number of driver PVs bound to claims of the namespace. Released PVs are not
+// counted, their claim is deleted.
+func countNamespaceVolumes(pvs []*corev1.PersistentVolume, driverName string, namespace string) int {
+	count := 0
+	for _, pv := range pvs {
+		if pv.Status.Phase == corev1.VolumeReleased {
+			continue
+		}
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == driverName && pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.Namespace == namespace {
+			count++
+		}
+	}
+	return count
+}
+
+// checkNamespaceVolumeQuota returns a ResourceExhausted error if the namespace already has its max number of volumes,
+// it is a soft limit, checked only if the PVC namespace is passed by the external provisioner
+func (csiCS *CSIControllerServer) checkNamespaceVolumeQuota(ctxLogger *zap.Logger, namespace string) error {
+	if len(namespace) == 0 || csiCS.kubeCache == nil {
+		return nil
+	}
+	quota := getNamespaceVolumeQuota(csiCS.namespaceQuotas, namespace)
+	if quota == 0 {
+		return nil
+	}
+	if !csiCS.kubeCache.hasSynced() {
+		ctxLogger.Warn("Unable to check the namespace volume quota, kubernetes objects not synced yet", zap.String("Namespace", namespace))
+		return nil
+	}
+	count := countNamespaceVolumes(csiCS.kubeCache.listPersistentVolumes(), csiCS.Driver.name, namespace)
+	ctxLogger.Info("Namespace volume quota", zap.String("Namespace", namespace), zap.Int("Volumes", count), zap.Int("Quota", quota))
+	if count >= quota {
+		return status.Errorf(codes.ResourceExhausted, "namespace %s has reached its limit of %d volumes", namespace, quota)
+	}
+	return nil
+}
+
+// getDeprecatedReplacement returns whether the name is listed in the deprecation env and its suggested replacement,
+// e.g "5iops-tier=general-purpose;custom" where the replacement is optional
+func getDeprecatedReplacement(envName string, name string) (string, bool) {
+	for _, entry := range strings.Split(os.Getenv(envName), ";") {
+		deprecated, replacement, _ := strings.Cut(entry, "=")
+		if len(name) != 0 && strings.TrimSpace(deprecated) == name {
+			return strings.TrimSpace(replacement), true
+		}
+	}
+	return "", false
+}
+
+// rejectDeprecated returns true if the action set in the environment variable for deprecated values is reject,
+// the other values warn
+func rejectDeprecated(envName string) bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv(envName)), "reject")
+}
+
+// checkDeprecatedProfile warns about a volume requested with a deprecated profile, or rejects the request
+// with InvalidArgument if DEPRECATED_PROFILE_ACTION is reject
+func checkDeprecatedProfile(ctxLogger *zap.Logger, profile string) error {
+	replacement, deprecated := getDeprecatedReplacement("DEPRECATED_PROFILES", profile)
+	if !deprecated {
+		return nil
+	}
+	msg := fmt.Sprintf("profile %s is deprecated", profile)
+	if len(replacement) != 0 {
+		msg = fmt.Sprintf("%s, use %s instead", msg, replacement)
+	}
+	if rejectDeprecated("DEPRECATED_PROFILE_ACTION") {
+		ctxLogger.Error("Rejecting volume with deprecated profile", zap.String("Profile", profile), zap.String("Replacement", replacement))
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	ctxLogger.Warn("Creating volume with deprecated profile", zap.String("Profile", profile), zap.String("Replacement", replacement), zap.String("Message", msg))
+	return nil
+}
+
+// checkDeprecatedParameters warns about the storage class parameters listed in DEPRECATED_PARAMETERS, or rejects
+// the request with InvalidArgument if DEPRECATED_PARAMETER_ACTION is reject
+func checkDeprecatedParameters(ctxLogger *zap.Logger, params map[string]string) error {
+	reject := rejectDeprecated("DEPRECATED_PARAMETER_ACTION")
+	for key := range params {
+		replacement, deprecated := getDeprecatedReplacement("DEPRECATED_PARAMETERS", key)
+		if !deprecated {
+			continue
+		}
+		msg := fmt.Sprintf("parameter %s is deprecated", key)
+		if len(replacement) != 0 {
+			msg = fmt.Sprintf("%s, use %s instead", msg, replacement)
+		}
+		if reject {
+			ctxLogger.Error("Rejecting volume with deprecated parameter", zap.String("Parameter", key), zap.String("Replacement", replacement))
+			return status.Error(codes.InvalidArgument, msg)
+		}
+		ctxLogger.Warn("Creating volume with deprecated parameter", zap.String("Parameter", key), zap.String("Replacement", replacement), zap.String("Message", msg))
+	}
+	return nil
+}
@@ -18,22 +18,34 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"github.com/IBM/ibmcloud-volume-interface/config"
 	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	iksprovider "github.com/IBM/ibmcloud-volume-vpc/iks/provider"
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
-	exceededZoneName      = "testzone-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
-	exceededRegionName    = "us-south-test-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
-	exceededResourceGID   = "myresourcegroups-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
-	exceededEncryptionKey = "key-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	exceededZoneName           = "testzone-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	exceededRegionName         = "us-south-test-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	exceededResourceGID        = "myresourcegroups-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	exceededEncryptionKey      = "key-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testEncryptionKeyCRN       = "crn:v1:bluemix:public:kms:us-south:a/c468d8642937fecd8a0860fe0f379bf9:26a7e5f0-8e27-4f2c-a0de-d9e6a7c40c31:key:e1b4a5c2-03d6-4d2a-9a47-4e0f7b5d3c11"
+	testSecretEncryptionKeyCRN = "crn:v1:bluemix:public:hs-crypto:us-south:a/c468d8642937fecd8a0860fe0f379bf9:5c1b3a9e-7f20-4b8d-9e51-0a6c2d4f8e73:key:9d2e6f1a-4b3c-4e8d-a7f5-2c0b1e9d6a84"
 )
 
 func TestGetRequestedCapacity(t *testing.T) {
@@ -139,6 +151,11 @@ func TestAreVolumeCapabilitiesSupported(t *testing.T) {
 			volumeCap:     []*csi.VolumeCapability{{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY}}},
 			expectedValue: false,
 		},
+		{
+			testCaseName:  "Multi node volume capability",
+			volumeCap:     []*csi.VolumeCapability{{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER}}},
+			expectedValue: false,
+		},
 	}
 
 	// Setup test driver
@@ -155,6 +172,83 @@ func TestAreVolumeCapabilitiesSupported(t *testing.T) {
 	}
 }
 
+func TestValidateVolumeMatch(t *testing.T) {
+	volume := &provider.Volume{VolumeID: "vol123", Az: "us-south-1", VPCVolume: provider.VPCVolume{Status: "available", Profile: &provider.Profile{Name: "general-purpose"}}}
+	mountCap := func(fsType string) []*csi.VolumeCapability {
+		return []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: fsType}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}}
+	}
+	testCases := []struct {
+		testCaseName string
+		volume       *provider.Volume
+		req          *csi.ValidateVolumeCapabilitiesRequest
+		expectedErr  string
+	}{
+		{
+			testCaseName: "Mount with matching volume context and parameters",
+			volume:       volume,
+			req: &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap("xfs"),
+				VolumeContext: map[string]string{VolumeIDLabel: "vol123", utils.NodeZoneLabel: "us-south-1"},
+				Parameters:    map[string]string{Profile: "general-purpose"}},
+		},
+		{
+			testCaseName: "Block",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: stdBlockVolCap},
+		},
+		{
+			testCaseName: "Unsupported fstype",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap("ntfs")},
+			expectedErr:  "unsupported fstype <ntfs>",
+		},
+		{
+			testCaseName: "Multi node access mode",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: stdVolCapNotSupported},
+			expectedErr:  "MULTI_NODE_MULTI_WRITER is not supported",
+		},
+		{
+			testCaseName: "Failed volume",
+			volume:       &provider.Volume{VolumeID: "vol123", VPCVolume: provider.VPCVolume{Status: "failed"}},
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap("")},
+			expectedErr:  "failed state",
+		},
+		{
+			testCaseName: "Volume context of another volume",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap(""), VolumeContext: map[string]string{VolumeIDLabel: "vol456"}},
+			expectedErr:  "for volume vol456",
+		},
+		{
+			testCaseName: "Volume in another zone",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap(""), VolumeContext: map[string]string{utils.NodeZoneLabel: "us-south-2"}},
+			expectedErr:  "zone us-south-1, not us-south-2",
+		},
+		{
+			testCaseName: "Volume with another profile",
+			volume:       volume,
+			req:          &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: mountCap(""), Parameters: map[string]string{Profile: "10iops-tier"}},
+			expectedErr:  "profile general-purpose, not 10iops-tier",
+		},
+	}
+
+	icDriver := initIBMCSIDriver(t)
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			err := validateVolumeMatch(testcase.volume, testcase.req, icDriver.vcap)
+			if len(testcase.expectedErr) == 0 {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, testcase.expectedErr)
+			}
+		})
+	}
+}
+
 func isVolumeSame(expected *provider.Volume, actual *provider.Volume) bool {
 	if actual == nil && expected == nil {
 		return true
@@ -190,11 +284,13 @@ func TestGetVolumeParameters(t *testing.T) {
 					Tag:           "test-tag",
 					ResourceGroup: "myresourcegroups",
 					Encrypted:     "false",
-					EncryptionKey: "key",
+					EncryptionKey: testEncryptionKeyCRN,
 					ClassVersion:  "",
 					Generation:    "generation",
 					Throughput:    "1000",
 					IOPS:          noIops,
+					IOScheduler:   "mq-deadline",
+					MountOptions:  "noatime,discard",
 				},
 			},
 			expectedVolume: &provider.Volume{Name: &volumeName,
@@ -219,6 +315,26 @@ func TestGetVolumeParameters(t *testing.T) {
 			expectedStatus: true,
 			expectedError:  fmt.Errorf("%s:<%v> unsupported profile. Supported profiles are: %v", Profile, "wrong-profile", SupportedProfile),
 		},
+		{
+			testCaseName: "Invalid I/O scheduler name",
+			request: &csi.CreateVolumeRequest{Parameters: map[string]string{
+				IOScheduler: "mq deadline",
+			},
+			},
+			expectedVolume: &provider.Volume{},
+			expectedStatus: true,
+			expectedError:  fmt.Errorf("%s:<%v> is not a valid I/O scheduler name", IOScheduler, "mq deadline"),
+		},
+		{
+			testCaseName: "Invalid mount options",
+			request: &csi.CreateVolumeRequest{Parameters: map[string]string{
+				MountOptions: "noatime, nodev",
+			},
+			},
+			expectedVolume: &provider.Volume{},
+			expectedStatus: true,
+			expectedError:  fmt.Errorf("%s:<%v> is not a valid comma separated list of mount options", MountOptions, "noatime, nodev"),
+		},
 		{
 			testCaseName: "Max length exceeded for zone name",
 			request: &csi.CreateVolumeRequest{Parameters: map[string]string{
@@ -319,7 +435,7 @@ func TestGetVolumeParameters(t *testing.T) {
 					Tag:           "test-tag",
 					ResourceGroup: "myresourcegroups",
 					Encrypted:     "false",
-					EncryptionKey: "key",
+					EncryptionKey: testEncryptionKeyCRN,
 					ClassVersion:  "",
 					Generation:    "generation",
 					IOPS:          noIops,
@@ -406,7 +522,7 @@ func TestOverrideParams(t *testing.T) {
 					Tag:           "test",
 					ResourceGroup: "myresourcegroups",
 					Encrypted:     "false",
-					EncryptionKey: "123",
+					EncryptionKey: testEncryptionKeyCRN,
 					IOPS:          noIops,
 				},
 				Secrets: map[string]string{
@@ -415,7 +531,7 @@ func TestOverrideParams(t *testing.T) {
 					Tag:           "secret-tag",
 					ResourceGroup: "secret-rg",
 					Encrypted:     "false",
-					EncryptionKey: "1231",
+					EncryptionKey: testSecretEncryptionKeyCRN,
 					IOPS:          noIops,
 				},
 			},
@@ -497,7 +613,7 @@ func TestOverrideParams(t *testing.T) {
 					Tag:           "test",
 					ResourceGroup: "myresourcegroups",
 					Encrypted:     "false",
-					EncryptionKey: "123",
+					EncryptionKey: testEncryptionKeyCRN,
 					IOPS:          noIops,
 				},
 				Secrets: map[string]string{
@@ -675,6 +791,19 @@ func TestCreateCSIVolumeResponse(t *testing.T) {
 	}
 }
 
+func TestCreateCSIVolumeResponseBandwidth(t *testing.T) {
+	vol := provider.Volume{VolumeID: "volID", Az: "testzone"}
+
+	// volumes without bandwidth e.g. older profiles
+	resp := createCSIVolumeResponse(vol, 20, nil, "1234", "my-region")
+	_, found := resp.Volume.VolumeContext[BandwidthLabel]
+	assert.False(t, found)
+
+	vol.Bandwidth = 8000
+	resp = createCSIVolumeResponse(vol, 20, nil, "1234", "my-region")
+	assert.Equal(t, "8000", resp.Volume.VolumeContext[BandwidthLabel])
+}
+
 func isControllerPublishVolume(expected *csi.ControllerPublishVolumeResponse, actual *csi.ControllerPublishVolumeResponse) bool {
 	if expected == nil && actual == nil {
 		return true
@@ -748,6 +877,23 @@ func TestPickTargetTopologyParams(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			testCaseName: "Preferred topology picked before requisite",
+			requestTopology: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{{Segments: map[string]string{utils.NodeZoneLabel: "zone-1"}}, {Segments: map[string]string{utils.NodeZoneLabel: "zone-2"}}},
+				Preferred: []*csi.Topology{{Segments: map[string]string{utils.NodeZoneLabel: "zone-2"}}},
+			},
+			expectedOutput: map[string]string{utils.NodeZoneLabel: "zone-2"},
+			expectedError:  nil,
+		},
+		{
+			testCaseName: "Requisite topology without preferred",
+			requestTopology: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{{Segments: map[string]string{utils.NodeRegionLabel: "us-south-test"}}, {Segments: map[string]string{utils.NodeZoneLabel: "zone-2"}}},
+			},
+			expectedOutput: map[string]string{utils.NodeZoneLabel: "zone-2"},
+			expectedError:  nil,
+		},
 		{
 			testCaseName:    "Nil pick target for topology",
 			requestTopology: &csi.TopologyRequirement{Preferred: []*csi.Topology{}},
@@ -807,3 +953,240 @@ func TestGetPrefedTopologyParams(t *testing.T) {
 		})
 	}
 }
+
+func TestGetVolumeSourceTag(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		volumeSource *csi.VolumeContentSource
+		expectedTag  string
+	}{
+		{
+			testCaseName: "Snapshot source with snapshot ID",
+			volumeSource: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"}}},
+			expectedTag:  "source:snapshot:r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb",
+		},
+		{
+			testCaseName: "Snapshot source with snapshot CRN",
+			volumeSource: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "crn:v1:service:public:is:us-south:a/c468d8642937fecd8a0860fe0f379bf9::snapshot:r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"}}},
+			expectedTag:  "source:snapshot:r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb",
+		},
+		{
+			testCaseName: "Clone source",
+			volumeSource: &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "r006-5678-volume"}}},
+			expectedTag:  "source:clone:r006-5678-volume",
+		},
+		{
+			testCaseName: "Plain create",
+			volumeSource: nil,
+			expectedTag:  "",
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			assert.Equal(t, testcase.expectedTag, getVolumeSourceTag(testcase.volumeSource))
+		})
+	}
+}
+
+func TestValidateSnapshotRegion(t *testing.T) {
+	usSouthSnapshotCRN := "crn:v1:service:public:is:us-south:a/c468d8642937fecd8a0860fe0f379bf9::snapshot:r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"
+	euDeSnapshotCRN := "crn:v1:service:public:is:eu-de:a/c468d8642937fecd8a0860fe0f379bf9::snapshot:r010-5678fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"
+	testCases := []struct {
+		testCaseName    string
+		volume          *provider.Volume
+		libSnapshot     *provider.Snapshot
+		libSnapshotErr  error
+		expectedSuccess bool
+	}{
+		{
+			testCaseName:    "Snapshot CRN in the zone region",
+			volume:          &provider.Volume{Az: "us-south-1", Snapshot: provider.Snapshot{SnapshotCRN: usSouthSnapshotCRN}},
+			expectedSuccess: true,
+		},
+		{
+			testCaseName:    "Snapshot CRN in another region",
+			volume:          &provider.Volume{Az: "us-south-2", Snapshot: provider.Snapshot{SnapshotCRN: euDeSnapshotCRN}},
+			expectedSuccess: false,
+		},
+		{
+			testCaseName:    "Snapshot copy in the zone region",
+			volume:          &provider.Volume{Az: "eu-de-3", Snapshot: provider.Snapshot{SnapshotID: "r010-5678fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"}},
+			libSnapshot:     &provider.Snapshot{SnapshotCRN: euDeSnapshotCRN},
+			expectedSuccess: true,
+		},
+		{
+			testCaseName:    "Snapshot ID in another region",
+			volume:          &provider.Volume{Az: "eu-de-3", Snapshot: provider.Snapshot{SnapshotID: "r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"}},
+			libSnapshot:     &provider.Snapshot{SnapshotCRN: usSouthSnapshotCRN},
+			expectedSuccess: false,
+		},
+		{
+			testCaseName:    "Snapshot lookup failed",
+			volume:          &provider.Volume{Az: "eu-de-3", Snapshot: provider.Snapshot{SnapshotID: "r006-1234fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb"}},
+			libSnapshotErr:  fmt.Errorf("snapshot not found"),
+			expectedSuccess: true,
+		},
+		{
+			testCaseName:    "Region from parameters for non VPC zone name",
+			volume:          &provider.Volume{Az: "myzone", Region: "eu-de", Snapshot: provider.Snapshot{SnapshotCRN: usSouthSnapshotCRN}},
+			expectedSuccess: false,
+		},
+		{
+			testCaseName:    "Unknown volume region",
+			volume:          &provider.Volume{Az: "myzone", Snapshot: provider.Snapshot{SnapshotCRN: usSouthSnapshotCRN}},
+			expectedSuccess: true,
+		},
+	}
+
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			session := &fake.FakeSession{}
+			session.GetSnapshotReturns(testcase.libSnapshot, testcase.libSnapshotErr)
+			err := validateSnapshotRegion(session, testcase.volume, logger)
+			assert.Equal(t, testcase.expectedSuccess, err == nil)
+		})
+	}
+}
+
+func TestAddTagWithinLimit(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	tags := make([]string, maxVolumeTags-2)
+	assert.Equal(t, maxVolumeTags-1, len(addTagWithinLimit(logger, tags, "clusterName:my-cluster", 0)))
+	// Reserved tags of the provider library count in the limit
+	assert.Equal(t, maxVolumeTags-2, len(addTagWithinLimit(logger, tags, "clusterName:my-cluster", 2)))
+}
+
+func TestGetBackendSnapshotName(t *testing.T) {
+	csiName := "snapshot-8b3a61f2-7a37-4a4b-9f3e-1c2d3e4f5a6b"
+
+	// Disabled by default
+	assert.Equal(t, "", getSnapshotNamePrefix("cluster-a"))
+	assert.Equal(t, csiName, getBackendSnapshotName(getSnapshotNamePrefix("cluster-a"), csiName))
+
+	// Same CSI name in two clusters
+	t.Setenv("SNAPSHOT_NAME_CLUSTER_SCOPED", "true")
+	clusterA := getBackendSnapshotName(getSnapshotNamePrefix("c8k2m3rd0abcd1234efg"), csiName)
+	clusterB := getBackendSnapshotName(getSnapshotNamePrefix("c9x7p1qs0wxyz5678hij"), csiName)
+	assert.NotEqual(t, clusterA, clusterB)
+	assert.LessOrEqual(t, len(clusterA), maxResourceNameLen)
+	assert.LessOrEqual(t, len(clusterB), maxResourceNameLen)
+
+	// Stable within a cluster
+	assert.Equal(t, clusterA, getBackendSnapshotName(getSnapshotNamePrefix("c8k2m3rd0abcd1234efg"), csiName))
+
+	// Names differing only after the truncation point stay distinct
+	otherName := "snapshot-8b3a61f2-7a37-4a4b-9f3e-1c2d3e4f5a6c"
+	assert.NotEqual(t, clusterA, getBackendSnapshotName(getSnapshotNamePrefix("c8k2m3rd0abcd1234efg"), otherName))
+
+	// Short names are not truncated
+	assert.Equal(t, "c8k2m3rd0abcd1234efg-snap1", getBackendSnapshotName(getSnapshotNamePrefix("c8k2m3rd0abcd1234efg"), "snap1"))
+
+	// Configured prefix takes precedence and is sanitized
+	t.Setenv("SNAPSHOT_NAME_PREFIX", "Prod_EU")
+	assert.Equal(t, "prod-eu-snap1", getBackendSnapshotName(getSnapshotNamePrefix("c8k2m3rd0abcd1234efg"), "snap1"))
+}
+
+type failingSessionProvider struct {
+	*cloudProvider.FakeIBMCloudStorageProvider
+	err error
+}
+
+func (f *failingSessionProvider) GetProviderSession(ctx context.Context, logger *zap.Logger) (provider.Session, error) {
+	return nil, f.err
+}
+
+func TestGetProviderSessionFailures(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	reason := "FailedToPlaceOrder"
+	readCounter := func() float64 {
+		m := &dto.Metric{}
+		assert.Nil(t, providerSessionFailures.WithLabelValues(reason).Write(m))
+		return m.GetCounter().GetValue()
+	}
+
+	before := readCounter()
+	session, err := icDriver.cs.getProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotNil(t, session)
+	assert.Equal(t, before, readCounter())
+
+	fakeProvider := icDriver.cs.CSIProvider.(*cloudProvider.FakeIBMCloudStorageProvider)
+	cs := &CSIControllerServer{
+		Driver:      icDriver,
+		CSIProvider: &failingSessionProvider{FakeIBMCloudStorageProvider: fakeProvider, err: providerError.Message{Code: reason, Description: "token generation failed"}},
+	}
+	_, err = cs.getProviderSession(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, readCounter())
+}
+
+func TestRecordProviderTokenExpiry(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	readGauge := func() float64 {
+		m := &dto.Metric{}
+		assert.Nil(t, providerTokenExpiry.Write(m))
+		return m.GetGauge().GetValue()
+	}
+	jwt := func(claims string) string {
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+	}
+	creds := provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: jwt(fmt.Sprintf(`{"iam_id":"iam-ServiceId","exp":%d}`, time.Now().Add(time.Hour).Unix()))}
+
+	recordProviderTokenExpiry(logger, &vpcprovider.VPCSession{ContextCredentials: creds})
+	assert.InDelta(t, time.Hour.Seconds(), readGauge(), 5)
+
+	// IKS session holds the VPC session credentials
+	creds.Credential = jwt(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(10*time.Minute).Unix()))
+	recordProviderTokenExpiry(logger, &iksprovider.IksVpcSession{VPCSession: vpcprovider.VPCSession{ContextCredentials: creds}})
+	assert.InDelta(t, (10 * time.Minute).Seconds(), readGauge(), 5)
+
+	// Not a JWT, or sessions without IAM access token, the gauge keeps the last expiry
+	for _, session := range []provider.Session{
+		&vpcprovider.VPCSession{ContextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: "opaque-token"}},
+		&vpcprovider.VPCSession{ContextCredentials: provider.ContextCredentials{AuthType: provider.IAMAPIKey, Credential: jwt(`{"exp":1}`)}},
+		&fake.FakeSession{},
+	} {
+		recordProviderTokenExpiry(logger, session)
+		assert.InDelta(t, (10 * time.Minute).Seconds(), readGauge(), 5)
+	}
+
+	_, err := getTokenExpiry(jwt(`{"iam_id":"iam-ServiceId"}`))
+	assert.ErrorContains(t, err, "no exp claim")
+	_, err = getTokenExpiry("header.!!!.signature")
+	assert.ErrorContains(t, err, "invalid access token payload")
+}
+
+func TestGetContextLogger(t *testing.T) {
+	// Logger writes to stdout, capture it
+	var requestID string
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(defaultRequestIDMetadataKey, "tooling-req-42"))
+	output := captureStdout(t, func() {
+		var ctxLogger *zap.Logger
+		ctxLogger, requestID = getContextLogger(ctx)
+		ctxLogger.Info("correlated request")
+	})
+	assert.Equal(t, "tooling-req-42 ", requestID)
+	assert.Contains(t, output, `"RequestID":"tooling-req-42"`)
+
+	// Configured metadata key
+	t.Setenv("REQUEST_ID_METADATA_KEY", "x-correlation-id")
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "tooling-req-43"))
+	_, requestID = getContextLogger(ctx)
+	assert.Equal(t, "tooling-req-43 ", requestID)
+
+	// New request ID is generated when not supplied
+	_, requestID = getContextLogger(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", " ")))
+	assert.NotEqual(t, "  ", requestID)
+	assert.Len(t, requestID, 37)
+	_, otherRequestID := getContextLogger(context.Background())
+	assert.NotEqual(t, requestID, otherRequestID)
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,14 +33,19 @@ import (
 	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
 	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 var (
@@ -318,6 +324,23 @@ func TestCreateVolumeArguments(t *testing.T) {
 			expErrCode:        codes.OK,
 			libVolumeError:    nil,
 		},
+		{
+			name: "snapshot crn of another region given in request",
+			req: &csi.CreateVolumeRequest{
+				Name:               volName,
+				CapacityRange:      stdCapRange,
+				VolumeCapabilities: stdVolCap,
+				Parameters:         map[string]string{Profile: "general-purpose", Zone: "us-south-1"},
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{
+						Snapshot: &csi.VolumeContentSource_SnapshotSource{
+							SnapshotId: "crn:v1:service:public:is:eu-de:a/c468d8642937fecd8a0860fe0f379bf9::snapshot:r010-5678fe0c-3d9b-4c95-a6d1-8e0d4bcb6ecb",
+						},
+					},
+				},
+			},
+			expErrCode: codes.InvalidArgument,
+		},
 	}
 
 	// Creating test logger
@@ -374,6 +397,883 @@ func TestCreateVolumeArguments(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeClusterNameTag(t *testing.T) {
+	testCases := []struct {
+		name        string
+		clusterName string
+		expTags     []string
+	}{
+		{
+			name:        "Cluster name configured",
+			clusterName: "my-cluster",
+			expTags:     []string{"tag1", "clusterName:my-cluster", "encryption:provider-managed"},
+		},
+		{
+			name:    "Cluster name unknown",
+			expTags: []string{"tag1", "encryption:provider-managed"},
+		},
+		{
+			name:        "Cluster name not valid in a tag",
+			clusterName: "my/cluster",
+			expTags:     []string{"tag1", "encryption:provider-managed"},
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		t.Setenv("CLUSTER_NAME", tc.clusterName)
+		icDriver := initIBMCSIDriver(t)
+		fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+		assert.Nil(t, err)
+		fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+		assert.Equal(t, true, ok)
+		volName := "test-name"
+		capacity := 20
+		fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+		params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion", Tag: "tag1"}
+		_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakeStructSession.CreateVolumeCallCount())
+		assert.Equal(t, tc.expTags, fakeStructSession.CreateVolumeArgsForCall(0).Tags)
+	}
+}
+
+func TestCreateVolumeDefaultFsType(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("DEFAULT_FS_TYPE", "xfs")
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	volName := "test-name"
+	capacity := 20
+	fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+	params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}
+
+	noFsTypeVolCap := []*csi.VolumeCapability{{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}}
+	resp, err := icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: noFsTypeVolCap, Parameters: params})
+	assert.Nil(t, err)
+	assert.Equal(t, provider.VolumeType("xfs"), fakeStructSession.CreateVolumeArgsForCall(0).VolumeType)
+	// recorded for the node server
+	assert.Equal(t, "xfs", resp.Volume.VolumeContext[FsType])
+
+	// fsType of the storage class takes precedence
+	resp, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+	assert.Nil(t, err)
+	assert.Equal(t, provider.VolumeType("ext2"), fakeStructSession.CreateVolumeArgsForCall(1).VolumeType)
+	assert.NotContains(t, resp.Volume.VolumeContext, FsType)
+}
+
+func TestCreateVolumeTopology(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	volName := "test-name"
+	capacity := 20
+	fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId"}, nil)
+	req := &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap,
+		Parameters: map[string]string{Profile: "general-purpose"},
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{{Segments: map[string]string{utils.NodeZoneLabel: "zone-1"}}, {Segments: map[string]string{utils.NodeZoneLabel: "zone-2"}}},
+		},
+	}
+
+	// requisite topology when no topology is preferred
+	resp, err := icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "zone-1", fakeStructSession.CreateVolumeArgsForCall(0).Az)
+	assert.Equal(t, "zone-1", resp.Volume.AccessibleTopology[0].Segments[utils.NodeZoneLabel])
+
+	// preferred topology first
+	fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId"}, nil)
+	req.AccessibilityRequirements.Preferred = []*csi.Topology{{Segments: map[string]string{utils.NodeZoneLabel: "zone-2"}}}
+	resp, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "zone-2", fakeStructSession.CreateVolumeArgsForCall(1).Az)
+	assert.Equal(t, "zone-2", resp.Volume.AccessibleTopology[0].Segments[utils.NodeZoneLabel])
+
+	// zone without capacity
+	fakeStructSession.CreateVolumeReturns(nil, providerError.Message{Code: "insufficient_capacity", Description: "The zone is out of capacity", Type: providerError.ProvisioningFailed})
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "zone-2")
+}
+
+func TestCreateVolumeWaitForAvailable(t *testing.T) {
+	oldPollInterval := volumeCreationPollInterval
+	volumeCreationPollInterval = 10 * time.Millisecond
+	defer func() { volumeCreationPollInterval = oldPollInterval }()
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("VOLUME_CREATION_TIMEOUT", "1")
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	volName := "test-name"
+	capacity := 20
+	pendingVolume := func() *provider.Volume {
+		return &provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", VPCVolume: provider.VPCVolume{Status: "pending"}}
+	}
+	req := &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap,
+		Parameters: map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}}
+
+	// the backend gave up waiting, the volume becomes available later
+	fakeStructSession.CreateVolumeReturns(nil, providerError.Message{Code: "VolumeNotInValidState", Description: "Volume did not get valid (available) state", Type: providerError.ProvisioningFailed})
+	fakeStructSession.GetVolumeByNameReturnsOnCall(1, pendingVolume(), nil)
+	remaining := 3
+	fakeStructSession.GetVolumeStub = func(id string) (*provider.Volume, error) {
+		vol := pendingVolume()
+		if remaining == 0 {
+			vol.Status = "available"
+		}
+		remaining--
+		return vol, nil
+	}
+	resp, err := icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "testVolumeId", resp.Volume.VolumeId)
+	assert.Equal(t, 4, fakeStructSession.GetVolumeCallCount())
+
+	// volume still pending after the timeout
+	fakeStructSession.GetVolumeByNameReturns(pendingVolume(), nil)
+	fakeStructSession.GetVolumeStub = func(id string) (*provider.Volume, error) {
+		return pendingVolume(), nil
+	}
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, 1, fakeStructSession.CreateVolumeCallCount())
+
+	// failed volume
+	fakeStructSession.GetVolumeStub = func(id string) (*provider.Volume, error) {
+		vol := pendingVolume()
+		vol.Status = "failed"
+		return vol, nil
+	}
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestCreateVolumeDryRun(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	readCounter := func(counter interface{ Write(*dto.Metric) error }) float64 {
+		m := &dto.Metric{}
+		assert.Nil(t, counter.Write(m))
+		return m.GetCounter().GetValue()
+	}
+
+	icDriver := initIBMCSIDriver(t)
+	lookup := &fakeVolumeProfileLookup{exists: true}
+	icDriver.cs.profileLookup = lookup
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	req := &csi.CreateVolumeRequest{Name: "test-name", CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap,
+		Parameters: map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion", DryRun: TrueStr}}
+
+	attempts := createVolumeAttempts.WithLabelValues("other")
+	attemptsBefore := readCounter(attempts)
+	resp, err := icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), "dry run: request valid")
+	details := status.Convert(err).Details()
+	assert.Len(t, details, 1)
+	errorInfo, ok := details[0].(*errdetails.ErrorInfo)
+	assert.True(t, ok)
+	assert.Equal(t, DryRunOKReason, errorInfo.Reason)
+	assert.Equal(t, map[string]string{"capacity": "20Gi", "zone": "myzone", "profile": "general-purpose"}, errorInfo.Metadata)
+	assert.Equal(t, "general-purpose", lookup.name)
+	assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+	// dry runs are not counted as CreateVolume calls
+	assert.Equal(t, attemptsBefore, readCounter(attempts))
+
+	// profile unknown to the VPC API
+	lookup.exists = false
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "volume profile general-purpose does not exist")
+
+	// profile lookup failed
+	lookup.err = errors.New("VPC API returned RC:503 Service Unavailable")
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	lookup.exists, lookup.err = true, nil
+
+	// a volume of the same name exists, no volume would be created
+	capacity := 20
+	volName := "test-name"
+	fakeStructSession.GetVolumeByNameReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone"}, nil)
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	fakeStructSession.GetVolumeByNameReturns(nil, nil)
+
+	// invalid requests fail as they would without dry run
+	req.Parameters[Profile] = "unknown-profile"
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req.Parameters[Profile] = "general-purpose"
+	req.Parameters[DryRun] = "yes"
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// set in a StorageClass, the external-provisioner adds the PV name
+	req.Parameters[DryRun] = TrueStr
+	req.Parameters[PVName] = "pvc-1234"
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "can not be set in a StorageClass")
+	assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+}
+
+func TestCreateVolumeMultiNodeAccessMode(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	req := &csi.CreateVolumeRequest{Name: "test-name", CapacityRange: stdCapRange, VolumeCapabilities: append(stdVolCap, stdVolCapNotSupported...),
+		Parameters: map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}}
+
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "MULTI_NODE_MULTI_WRITER is not supported")
+	assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+}
+
+func TestCreateVolumeSnapshotRestoreSize(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	fakeStructSession.GetSnapshotReturns(&provider.Snapshot{SnapshotID: "snap-id", SnapshotCRN: "snap-crn", SnapshotSize: 20 * utils.GiB, ReadyToUse: true}, nil)
+	restored := 50
+	fakeStructSession.CreateVolumeReturns(&provider.Volume{VolumeID: "vol123", Capacity: &restored, Az: "myzone"}, nil)
+	snapshotSource := &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "snap-id"}}}
+	req := &csi.CreateVolumeRequest{Name: "test-name", CapacityRange: &csi.CapacityRange{RequiredBytes: 50 * utils.GiB}, VolumeCapabilities: stdVolCap,
+		VolumeContentSource: snapshotSource, Parameters: map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}}
+
+	// larger than the snapshot minimum capacity, restored at the requested capacity
+	resp, err := icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50*utils.GiB), resp.Volume.CapacityBytes)
+	assert.Equal(t, 50, *fakeStructSession.CreateVolumeArgsForCall(0).Capacity)
+	assert.Equal(t, 0, fakeStructSession.ExpandVolumeCallCount())
+
+	// same size as the snapshot minimum capacity
+	restored = 20
+	req.CapacityRange.RequiredBytes = 20 * utils.GiB
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, *fakeStructSession.CreateVolumeArgsForCall(1).Capacity)
+
+	// smaller than the snapshot minimum capacity
+	req.CapacityRange.RequiredBytes = 10 * utils.GiB
+	_, err = icDriver.cs.CreateVolume(context.Background(), req)
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+	assert.Equal(t, 2, fakeStructSession.CreateVolumeCallCount())
+}
+
+func TestCreateVolumeEncryptionKey(t *testing.T) {
+	testCases := []struct {
+		name       string
+		params     map[string]string
+		secrets    map[string]string
+		expErrCode codes.Code
+		expKey     string
+		expTag     string
+	}{
+		{
+			name:       "Provider managed encryption",
+			expErrCode: codes.OK,
+			expTag:     "encryption:provider-managed",
+		},
+		{
+			name:       "Key Protect root key",
+			params:     map[string]string{EncryptionKey: testEncryptionKeyCRN},
+			expErrCode: codes.OK,
+			expKey:     testEncryptionKeyCRN,
+			expTag:     "encryption:customer-managed",
+		},
+		{
+			name:       "HPCS root key in secrets",
+			secrets:    map[string]string{EncryptionKey: testSecretEncryptionKeyCRN},
+			expErrCode: codes.OK,
+			expKey:     testSecretEncryptionKeyCRN,
+			expTag:     "encryption:customer-managed",
+		},
+		{
+			name:       "Encryption disabled",
+			params:     map[string]string{EncryptionKey: testEncryptionKeyCRN, Encrypted: "false"},
+			expErrCode: codes.OK,
+			expTag:     "encryption:provider-managed",
+		},
+		{
+			name:       "Malformed key CRN",
+			params:     map[string]string{EncryptionKey: "crn:v1:bluemix:public:kms:us-south:a/account"},
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:       "Key of an unsupported service",
+			params:     map[string]string{EncryptionKey: "crn:v1:bluemix:public:is:us-south:a/account:instance:key:id"},
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:       "Malformed key CRN in secrets",
+			secrets:    map[string]string{EncryptionKey: "my-key"},
+			expErrCode: codes.InvalidArgument,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			volName := "test-name"
+			capacity := 20
+			fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+			params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}
+			for key, value := range tc.params {
+				params[key] = value
+			}
+			_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params, Secrets: tc.secrets})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if tc.expErrCode != codes.OK {
+				assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+				return
+			}
+			requested := fakeStructSession.CreateVolumeArgsForCall(0)
+			if tc.expKey == "" {
+				assert.Nil(t, requested.VolumeEncryptionKey)
+			} else {
+				assert.Equal(t, tc.expKey, requested.VolumeEncryptionKey.CRN)
+			}
+			assert.Contains(t, requested.Tags, tc.expTag)
+		})
+	}
+}
+
+func TestCreateVolumeNamespaceQuota(t *testing.T) {
+	testCases := []struct {
+		name       string
+		quota      string
+		namespace  string
+		expErrCode codes.Code
+	}{
+		{
+			name:       "Namespace under its limit",
+			quota:      "*:1;team-a:3",
+			namespace:  "team-a",
+			expErrCode: codes.OK,
+		},
+		{
+			name:       "Namespace over its limit",
+			quota:      "*:5;team-a:2",
+			namespace:  "team-a",
+			expErrCode: codes.ResourceExhausted,
+		},
+		{
+			name:       "Namespace over the default limit",
+			quota:      "*:1;team-b:10",
+			namespace:  "team-a",
+			expErrCode: codes.ResourceExhausted,
+		},
+		{
+			name:       "No quota",
+			namespace:  "team-a",
+			expErrCode: codes.OK,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		t.Setenv("NAMESPACE_VOLUME_QUOTA", tc.quota)
+		icDriver := initIBMCSIDriver(t)
+		pv := func(name, namespace, driver string) *corev1.PersistentVolume {
+			return &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: name}},
+					ClaimRef:               &corev1.ObjectReference{Namespace: namespace, Name: name},
+				},
+			}
+		}
+		// claim deleted, not counted
+		released := pv("pv-5", "team-a", icDriver.name)
+		released.Status.Phase = corev1.VolumeReleased
+		setKubeClient(t, icDriver, k8sfake.NewSimpleClientset(
+			pv("pv-1", "team-a", icDriver.name),
+			pv("pv-2", "team-a", icDriver.name),
+			pv("pv-3", "team-a", "other.csi.driver"),
+			pv("pv-4", "team-b", icDriver.name),
+			released,
+		))
+		fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+		assert.Nil(t, err)
+		fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+		assert.Equal(t, true, ok)
+		volName := "test-name"
+		capacity := 20
+		fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+		params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion", PVCNamespace: tc.namespace, PVCName: "pvc", PVName: "pv"}
+		_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+		assert.Equal(t, tc.expErrCode, status.Code(err))
+		if tc.expErrCode == codes.OK {
+			assert.Equal(t, 1, fakeStructSession.CreateVolumeCallCount())
+		} else {
+			assert.Contains(t, err.Error(), "limit of")
+			assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+		}
+	}
+}
+
+func TestCreateVolumeStorageClassMetrics(t *testing.T) {
+	testCases := []struct {
+		name         string
+		storageClass string
+		profile      string
+		libError     error
+		expLabel     string
+		expResult    string
+		expErrorNil  bool
+	}{
+		{
+			name:         "Successful create",
+			storageClass: "ibmc-vpc-block-general-purpose",
+			profile:      "general-purpose",
+			expLabel:     "ibmc-vpc-block-general-purpose",
+			expResult:    "success",
+			expErrorNil:  true,
+		},
+		{
+			name:         "Failed create",
+			storageClass: "ibmc-vpc-block-10iops-tier",
+			profile:      "10iops-tier",
+			libError:     providerError.Message{Code: "FailedToPlaceOrder", Description: "Volume creation failed"},
+			expLabel:     "ibmc-vpc-block-10iops-tier",
+			expResult:    "failure",
+		},
+		{
+			name:         "Bad profile of a known class",
+			storageClass: "ibmc-vpc-block-10iops-tier",
+			profile:      "bad-profile",
+			expLabel:     "ibmc-vpc-block-10iops-tier",
+			expResult:    "failure",
+		},
+		{
+			name:         "Class not listed",
+			storageClass: "team-a-block",
+			profile:      "general-purpose",
+			expLabel:     "other",
+			expResult:    "success",
+			expErrorNil:  true,
+		},
+		{
+			name:        "No class parameter",
+			profile:     "general-purpose",
+			expLabel:    "other",
+			expResult:   "success",
+			expErrorNil: true,
+		},
+	}
+	t.Setenv("METRICS_STORAGE_CLASSES", "ibmc-vpc-block-general-purpose, ibmc-vpc-block-10iops-tier")
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	readCounter := func(counter interface{ Write(*dto.Metric) error }) float64 {
+		m := &dto.Metric{}
+		assert.Nil(t, counter.Write(m))
+		return m.GetCounter().GetValue()
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		icDriver := initIBMCSIDriver(t)
+		fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+		assert.Nil(t, err)
+		fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+		assert.Equal(t, true, ok)
+		volName := "test-name"
+		capacity := 20
+		if tc.libError != nil {
+			fakeStructSession.CreateVolumeReturns(nil, tc.libError)
+		} else {
+			fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+		}
+
+		attempts := createVolumeAttempts.WithLabelValues(tc.expLabel)
+		results := createVolumeResults.WithLabelValues(tc.expLabel, tc.expResult)
+		attemptsBefore, resultsBefore := readCounter(attempts), readCounter(results)
+
+		params := map[string]string{Profile: tc.profile, Zone: "myzone", Region: "myregion"}
+		if len(tc.storageClass) != 0 {
+			params[StorageClassName] = tc.storageClass
+		}
+		_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+		assert.Equal(t, tc.expErrorNil, err == nil)
+		assert.Equal(t, attemptsBefore+1, readCounter(attempts))
+		assert.Equal(t, resultsBefore+1, readCounter(results))
+	}
+}
+
+func TestCreateVolumeDeprecatedProfile(t *testing.T) {
+	testCases := []struct {
+		name       string
+		profile    string
+		action     string
+		expErrCode codes.Code
+		expMessage string
+	}{
+		{
+			name:       "Deprecated profile, warn by default",
+			profile:    "5iops-tier",
+			expErrCode: codes.OK,
+		},
+		{
+			name:       "Deprecated profile, reject",
+			profile:    "5iops-tier",
+			action:     "reject",
+			expErrCode: codes.InvalidArgument,
+			expMessage: "profile 5iops-tier is deprecated, use general-purpose instead",
+		},
+		{
+			name:       "Deprecated profile without replacement, reject",
+			profile:    "custom",
+			action:     "reject",
+			expErrCode: codes.InvalidArgument,
+			expMessage: "profile custom is deprecated",
+		},
+		{
+			name:       "Supported profile, reject",
+			profile:    "general-purpose",
+			action:     "reject",
+			expErrCode: codes.OK,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DEPRECATED_PROFILES", "5iops-tier=general-purpose; custom")
+			t.Setenv("DEPRECATED_PROFILE_ACTION", tc.action)
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			volName := "test-name"
+			capacity := 20
+			fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+			params := map[string]string{Profile: tc.profile, Zone: "myzone", Region: "myregion"}
+			if tc.profile == "custom" {
+				params[IOPS] = "1000"
+			}
+			_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if tc.expMessage != "" {
+				assert.Equal(t, tc.expMessage, status.Convert(err).Message())
+				assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+			}
+		})
+	}
+}
+
+func TestCreateVolumeProfileIops(t *testing.T) {
+	testCases := []struct {
+		name        string
+		profile     string
+		iops        string
+		capacity    int64
+		expErrCode  codes.Code
+		expIops     string
+		expCapacity int
+	}{
+		{
+			name:        "sdp profile, small capacity with high IOPS",
+			profile:     "sdp",
+			iops:        "20000",
+			capacity:    1 * utils.GiB,
+			expErrCode:  codes.OK,
+			expIops:     "20000",
+			expCapacity: 1,
+		},
+		{
+			name:       "sdp profile, IOPS below the range",
+			profile:    "sdp",
+			iops:       "1000",
+			capacity:   20 * utils.GiB,
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:       "sdp profile, IOPS above the range",
+			profile:    "sdp",
+			iops:       "70000",
+			capacity:   20 * utils.GiB,
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "custom profile",
+			profile:     "custom",
+			iops:        "3000",
+			capacity:    20 * utils.GiB,
+			expErrCode:  codes.OK,
+			expIops:     "3000",
+			expCapacity: 20,
+		},
+		{
+			name:       "custom profile, IOPS is not an integer",
+			profile:    "custom",
+			iops:       "3k",
+			capacity:   20 * utils.GiB,
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "tiered profile ignores IOPS",
+			profile:     "10iops-tier",
+			iops:        "70000",
+			capacity:    20 * utils.GiB,
+			expErrCode:  codes.OK,
+			expCapacity: 20,
+		},
+		{
+			name:        "general-purpose profile",
+			profile:     "general-purpose",
+			capacity:    20 * utils.GiB,
+			expErrCode:  codes.OK,
+			expCapacity: 20,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			volName := "test-name"
+			fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &tc.expCapacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+			params := map[string]string{Profile: tc.profile, Zone: "myzone", Region: "myregion"}
+			if tc.iops != "" {
+				params[IOPS] = tc.iops
+			}
+			capRange := &csi.CapacityRange{RequiredBytes: tc.capacity}
+			_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: capRange, VolumeCapabilities: stdVolCap, Parameters: params})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if tc.expErrCode != codes.OK {
+				assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+				return
+			}
+			requested := fakeStructSession.CreateVolumeArgsForCall(0)
+			assert.Equal(t, tc.profile, requested.Profile.Name)
+			assert.Equal(t, tc.expCapacity, *requested.Capacity)
+			if tc.expIops == "" {
+				assert.Nil(t, requested.Iops)
+			} else {
+				assert.Equal(t, tc.expIops, *requested.Iops)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeDeprecatedParameters(t *testing.T) {
+	testCases := []struct {
+		name       string
+		action     string
+		params     map[string]string
+		expErrCode codes.Code
+		expMessage string
+	}{
+		{
+			name:       "Deprecated parameter, warn",
+			params:     map[string]string{ClassVersion: "2"},
+			expErrCode: codes.OK,
+		},
+		{
+			name:       "Deprecated parameter, reject",
+			action:     "reject",
+			params:     map[string]string{ClassVersion: "2"},
+			expErrCode: codes.InvalidArgument,
+			expMessage: "parameter classVersion is deprecated, use profile instead",
+		},
+		{
+			name:       "No deprecated parameter, reject",
+			action:     "reject",
+			params:     map[string]string{},
+			expErrCode: codes.OK,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DEPRECATED_PARAMETERS", "classVersion=profile;generation")
+			t.Setenv("DEPRECATED_PARAMETER_ACTION", tc.action)
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+			volName := "test-name"
+			capacity := 20
+			fakeStructSession.CreateVolumeReturns(&provider.Volume{Capacity: &capacity, Name: &volName, VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"}, nil)
+
+			params := map[string]string{Profile: "general-purpose", Zone: "myzone", Region: "myregion"}
+			for key, value := range tc.params {
+				params[key] = value
+			}
+			_, err = icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: volName, CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if tc.expMessage != "" {
+				assert.Equal(t, tc.expMessage, status.Convert(err).Message())
+			}
+		})
+	}
+}
+
+func TestCreateVolumeZoneTopology(t *testing.T) {
+	zoneTopology := func(zone string) *csi.Topology {
+		return &csi.Topology{Segments: map[string]string{utils.NodeRegionLabel: "myregion", utils.NodeZoneLabel: zone}}
+	}
+	testCases := []struct {
+		name       string
+		zone       string
+		topology   *csi.TopologyRequirement
+		expZone    string
+		expErrCode codes.Code
+	}{
+		{
+			name:       "Zone parameter only",
+			zone:       "myzone-2",
+			expZone:    "myzone-2",
+			expErrCode: codes.OK,
+		},
+		{
+			name: "Topology only",
+			topology: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{zoneTopology("myzone-1"), zoneTopology("myzone-3")},
+				Preferred: []*csi.Topology{zoneTopology("myzone-3"), zoneTopology("myzone-1")},
+			},
+			expZone:    "myzone-3",
+			expErrCode: codes.OK,
+		},
+		{
+			name: "Zone parameter within the topology",
+			zone: "myzone-1",
+			topology: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{zoneTopology("myzone-1"), zoneTopology("myzone-3")},
+				Preferred: []*csi.Topology{zoneTopology("myzone-3"), zoneTopology("myzone-1")},
+			},
+			expZone:    "myzone-1",
+			expErrCode: codes.OK,
+		},
+		{
+			name: "Zone parameter conflicting with the topology",
+			zone: "myzone-2",
+			topology: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{zoneTopology("myzone-1"), zoneTopology("myzone-3")},
+				Preferred: []*csi.Topology{zoneTopology("myzone-3"), zoneTopology("myzone-1")},
+			},
+			expErrCode: codes.InvalidArgument,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		icDriver := initIBMCSIDriver(t)
+		fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+		assert.Nil(t, err)
+		fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+		assert.Equal(t, true, ok)
+		// Provisioned volume without zone in the response, the requested one is expected to be returned
+		fakeStructSession.CreateVolumeStub = func(volume provider.Volume) (*provider.Volume, error) {
+			capacity := 20
+			return &provider.Volume{Capacity: &capacity, Name: volume.Name, VolumeID: "testVolumeId", Region: "myregion"}, nil
+		}
+
+		params := map[string]string{Profile: "general-purpose", Region: "myregion"}
+		if len(tc.zone) != 0 {
+			params[Zone] = tc.zone
+		}
+		resp, err := icDriver.cs.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: "test-name", CapacityRange: stdCapRange, VolumeCapabilities: stdVolCap, Parameters: params, AccessibilityRequirements: tc.topology})
+		assert.Equal(t, tc.expErrCode, status.Code(err))
+		if tc.expErrCode != codes.OK {
+			assert.Contains(t, err.Error(), "conflicts with the accessible topology zones")
+			assert.Equal(t, 0, fakeStructSession.CreateVolumeCallCount())
+			continue
+		}
+		assert.Equal(t, tc.expZone, fakeStructSession.CreateVolumeArgsForCall(0).Az)
+		assert.Equal(t, tc.expZone, resp.Volume.AccessibleTopology[0].Segments[utils.NodeZoneLabel])
+	}
+}
+
 func TestDeleteVolume(t *testing.T) {
 	// test cases
 	testCases := []struct {
@@ -411,6 +1311,32 @@ func TestDeleteVolume(t *testing.T) {
 			libVolumeRespError: providerError.Message{Code: "FailedToDeleteVolume", Description: "Volume deletion failed", Type: providerError.DeletionFailed},
 			libVolumeResponse:  &provider.Volume{VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"},
 		},
+		{
+			name:        "Success volume delete in case lib volume delete returns not found",
+			req:         &csi.DeleteVolumeRequest{VolumeId: "testVolumeId"},
+			expResponse: &csi.DeleteVolumeResponse{},
+			expErrCode:  codes.OK,
+			libVolumeRespError: providerError.Message{Code: "FailedToDeleteVolume", Description: "Volume deletion failed", Type: providerError.DeletionFailed,
+				BackendError: "Trace Code:1, Code:not_found, Description:Volume not found, RC:404 Not Found"},
+			libVolumeResponse: &provider.Volume{VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"},
+		},
+		{
+			name:        "Failed from lib volume delete with backend conflict",
+			req:         &csi.DeleteVolumeRequest{VolumeId: "testVolumeId"},
+			expResponse: nil,
+			expErrCode:  codes.FailedPrecondition,
+			libVolumeRespError: providerError.Message{Code: "FailedToDeleteVolume", Description: "Volume deletion failed", Type: providerError.DeletionFailed,
+				BackendError: "Trace Code:1, Code:volume_in_use, Description:Volume is attached, RC:409 Conflict"},
+			libVolumeResponse: &provider.Volume{VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"},
+		},
+		{
+			name:               "Failed from lib volume delete with permission error",
+			req:                &csi.DeleteVolumeRequest{VolumeId: "testVolumeId"},
+			expResponse:        nil,
+			expErrCode:         codes.InvalidArgument,
+			libVolumeRespError: providerError.Message{Code: "AuthenticationFailed", Description: "Not authorized", Type: providerError.Unauthenticated},
+			libVolumeResponse:  &provider.Volume{VolumeID: "testVolumeId", Az: "myzone", Region: "myregion"},
+		},
 	}
 
 	// Creating test logger
@@ -436,11 +1362,78 @@ func TestDeleteVolume(t *testing.T) {
 		response, err := icDriver.cs.DeleteVolume(context.Background(), tc.req)
 		if tc.expErrCode != codes.OK {
 			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
 		}
 		assert.Equal(t, tc.expResponse, response)
 	}
 }
 
+func TestDeleteVolumeConfirmation(t *testing.T) {
+	testCases := []struct {
+		name            string
+		confirmTimeout  string
+		remainingChecks int
+		expErrCode      codes.Code
+		expGetCalls     int
+	}{
+		{
+			name:        "Immediate delete without confirmation",
+			expErrCode:  codes.OK,
+			expGetCalls: 1,
+		},
+		{
+			name:            "Delete confirmed after polling",
+			confirmTimeout:  "60",
+			remainingChecks: 3,
+			expErrCode:      codes.OK,
+			expGetCalls:     5,
+		},
+		{
+			name:            "Delete not confirmed in time",
+			confirmTimeout:  "1",
+			remainingChecks: 1000,
+			expErrCode:      codes.DeadlineExceeded,
+		},
+	}
+
+	oldPollInterval := volumeDeletionPollInterval
+	volumeDeletionPollInterval = 10 * time.Millisecond
+	defer func() { volumeDeletionPollInterval = oldPollInterval }()
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("VOLUME_DELETION_CONFIRM_TIMEOUT", tc.confirmTimeout)
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+			assert.True(t, ok)
+
+			// the first lookup finds the volume to delete, the next ones find it until the backend removed it
+			remaining := tc.remainingChecks + 1
+			fakeStructSession.GetVolumeStub = func(id string) (*provider.Volume, error) {
+				if remaining == 0 {
+					return nil, providerError.Message{Code: "StorageFindFailedWithVolumeId", Description: "Volume not found", Type: providerError.EntityNotFound}
+				}
+				remaining--
+				return &provider.Volume{VolumeID: id, Az: "myzone", Region: "myregion"}, nil
+			}
+
+			_, err = icDriver.cs.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "testVolumeId"})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			assert.Equal(t, 1, fakeStructSession.DeleteVolumeCallCount())
+			if tc.expGetCalls > 0 {
+				assert.Equal(t, tc.expGetCalls, fakeStructSession.GetVolumeCallCount())
+			}
+		})
+	}
+}
+
 func isPublishVolumeresponseEqual(expected *csi.ControllerPublishVolumeResponse, actual *csi.ControllerPublishVolumeResponse) bool {
 	if expected == nil && actual == nil {
 		return true
@@ -577,6 +1570,10 @@ func TestControllerPublishVolume(t *testing.T) {
 		if tc.expErrCode != codes.OK {
 			assert.NotNil(t, err)
 		}
+		// node_id from NodeGetInfo is the VPC instance ID, used for the attachment as is
+		if fakeStructSession.AttachVolumeCallCount() > 0 {
+			assert.Equal(t, tc.req.NodeId, fakeStructSession.AttachVolumeArgsForCall(0).InstanceID)
+		}
 		// This is because csi.ControllerPublishVolumeResponse contains request ID which is always different
 		// hence better to compair all fields
 		assert.Equal(t, true, isPublishVolumeresponseEqual(tc.expResponse, response))
@@ -707,6 +1704,17 @@ func TestValidateVolumeCapabilities(t *testing.T) {
 			expErrCode:        codes.InvalidArgument,
 			libGetVolumeError: nil,
 		},
+		{
+			name: "Multi node access mode not confirmed",
+			req: &csi.ValidateVolumeCapabilitiesRequest{VolumeId: "volumeid",
+				VolumeCapabilities: []*csi.VolumeCapability{{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER}}},
+			},
+			expResponse: &csi.ValidateVolumeCapabilitiesResponse{
+				Message: "access mode MULTI_NODE_MULTI_WRITER is not supported, IBM VPC block volumes can only be attached to a single node",
+			},
+			expErrCode:        codes.OK,
+			libGetVolumeError: nil,
+		},
 		{
 			name: "Passing nil volume ID",
 			req: &csi.ValidateVolumeCapabilitiesRequest{VolumeId: "",
@@ -882,6 +1890,110 @@ func TestListVolumes(t *testing.T) {
 	}
 }
 
+func TestListVolumesPagination(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	icDriver.cs.CSIProvider.GetConfig().VPC.G2ResourceGroupID = "cluster-rg"
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+
+	// First page, the next token is the start of the next page
+	firstPage := createVolume(10)
+	firstPage.Next = "volume-10"
+	fakeStructSession.ListVolumesReturnsOnCall(0, firstPage, nil)
+	resp, err := icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 10})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 10)
+	assert.Equal(t, "volume-10", resp.NextToken)
+	limit, start, tags := fakeStructSession.ListVolumesArgsForCall(0)
+	assert.Equal(t, 10, limit)
+	assert.Equal(t, "", start)
+	assert.Empty(t, tags)
+
+	// Last page, filtered on the resource group of the driver
+	t.Setenv("LIST_VOLUMES_RESOURCE_GROUP_FILTER", "true")
+	lastPage := createVolume(3)
+	lastPage.Next = ""
+	fakeStructSession.ListVolumesReturnsOnCall(1, lastPage, nil)
+	resp, err = icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 10, StartingToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 3)
+	assert.Equal(t, "", resp.NextToken)
+	limit, start, tags = fakeStructSession.ListVolumesArgsForCall(1)
+	assert.Equal(t, 10, limit)
+	assert.Equal(t, "volume-10", start)
+	assert.Equal(t, map[string]string{"resource_group.id": "cluster-rg"}, tags)
+
+	// Expired starting token
+	fakeStructSession.ListVolumesReturnsOnCall(2, nil, providerError.Message{Code: "StartVolumeIDNotFound", Description: "The volume ID specified in the start parameter of the list volume call could not be found.", Type: providerError.InvalidRequest})
+	_, err = icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 10, StartingToken: "deleted-volume"})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// Backend error which is not a provider message
+	fakeStructSession.ListVolumesReturnsOnCall(3, nil, errors.New("connection reset by peer"))
+	_, err = icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{MaxEntries: 10})
+	assert.NotNil(t, err)
+}
+
+func TestListVolumesVolumeCondition(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	volumeList := func() *provider.VolumeList {
+		capacity := 10
+		volumes := &provider.VolumeList{}
+		for _, status := range []string{"available", "failed", "unusable"} {
+			vol := &provider.Volume{VolumeID: "vol-" + status, Capacity: &capacity}
+			vol.Status = status
+			volumes.Volumes = append(volumes.Volumes, vol)
+		}
+		return volumes
+	}
+
+	// Not reported by default
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	fakeStructSession.ListVolumesReturns(volumeList(), nil)
+	resp, err := icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+	assert.Nil(t, err)
+	for _, entry := range resp.Entries {
+		assert.Nil(t, entry.Status)
+	}
+	for _, capability := range icDriver.cscap {
+		assert.NotEqual(t, csi.ControllerServiceCapability_RPC_VOLUME_CONDITION, capability.GetRpc().GetType())
+	}
+
+	t.Setenv("CONTROLLER_VOLUME_CONDITION", "true")
+	icDriver = initIBMCSIDriver(t)
+	fakeSession, err = icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok = fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	fakeStructSession.ListVolumesReturns(volumeList(), nil)
+	resp, err = icDriver.cs.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 3)
+	assert.False(t, resp.Entries[0].Status.VolumeCondition.Abnormal)
+	assert.True(t, resp.Entries[1].Status.VolumeCondition.Abnormal)
+	assert.Contains(t, resp.Entries[1].Status.VolumeCondition.Message, "failed")
+	assert.True(t, resp.Entries[2].Status.VolumeCondition.Abnormal)
+	assert.Contains(t, resp.Entries[2].Status.VolumeCondition.Message, "unusable")
+	advertised := false
+	for _, capability := range icDriver.cscap {
+		advertised = advertised || capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_VOLUME_CONDITION
+	}
+	assert.True(t, advertised)
+}
+
 func TestGetCapacity(t *testing.T) {
 	// test cases
 	testCases := []struct {
@@ -1116,6 +2228,91 @@ func TestCreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestCreateSnapshotConsistency(t *testing.T) {
+	testCases := []struct {
+		name        string
+		params      map[string]string
+		expErrCode  codes.Code
+		expTags     []string
+		expCreation bool
+	}{
+		{name: "No consistency", params: nil, expErrCode: codes.OK, expTags: []string{"name:snap", "source_volume:vol-id"}, expCreation: true},
+		{name: "Crash consistent", params: map[string]string{SnapshotConsistency: "crash"}, expErrCode: codes.OK, expTags: []string{"consistency:crash", "name:snap", "source_volume:vol-id"}, expCreation: true},
+		{name: "Application consistent", params: map[string]string{SnapshotConsistency: "Application"}, expErrCode: codes.OK, expTags: []string{"consistency:application", "name:snap", "source_volume:vol-id"}, expCreation: true},
+		{name: "Consistency user tag", params: map[string]string{SnapshotConsistency: "crash", Tag: "consistency:application"}, expErrCode: codes.OK, expTags: []string{"consistency:crash", "name:snap", "source_volume:vol-id"}, expCreation: true},
+		{name: "Invalid consistency", params: map[string]string{SnapshotConsistency: "filesystem"}, expErrCode: codes.InvalidArgument},
+		{name: "Empty consistency", params: map[string]string{SnapshotConsistency: ""}, expErrCode: codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			icDriver := initIBMCSIDriver(t)
+			fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), icDriver.logger)
+			assert.Nil(t, err)
+			fakeStructSession := fakeSession.(*fake.FakeSession)
+			fakeStructSession.GetSnapshotByNameReturns(nil, nil)
+			fakeStructSession.CreateSnapshotReturns(&provider.Snapshot{VolumeID: "vol-id", SnapshotID: "snap-id", SnapshotCRN: "snap-crn"}, nil)
+			tagger := &fakeResourceTagger{}
+			icDriver.cs.snapshotTagger = tagger
+
+			_, err = icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id", Parameters: tc.params})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+			if !tc.expCreation {
+				assert.Equal(t, 0, fakeStructSession.CreateSnapshotCallCount())
+				assert.Equal(t, 0, tagger.calls)
+				return
+			}
+			assert.Equal(t, 1, fakeStructSession.CreateSnapshotCallCount())
+			assert.Equal(t, "snap-crn", tagger.crn)
+			assert.Equal(t, tc.expTags, tagger.tags)
+		})
+	}
+}
+
+func TestCreateSnapshotTags(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), icDriver.logger)
+	assert.Nil(t, err)
+	fakeStructSession := fakeSession.(*fake.FakeSession)
+	fakeStructSession.GetSnapshotByNameReturns(nil, nil)
+	fakeStructSession.CreateSnapshotReturns(&provider.Snapshot{VolumeID: "vol-id", SnapshotID: "snap-id", SnapshotCRN: "snap-crn"}, nil)
+	tagger := &fakeResourceTagger{}
+	icDriver.cs.snapshotTagger = tagger
+
+	params := map[string]string{
+		Tag:                       "team:storage, env:prod,costcenter,bad/tag," + strings.Repeat("x", maxTagLen+1) + ",namespace:spoofed",
+		VolumeSnapshotNamespace:   "app-ns",
+		VolumeSnapshotName:        "db-snap",
+		VolumeSnapshotContentName: "snapcontent-1234",
+	}
+	_, err = icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id", Parameters: params})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tagger.calls)
+	assert.Equal(t, "snap-crn", tagger.crn)
+	assert.Equal(t, []string{
+		"costcenter",
+		"env:prod",
+		"name:snap",
+		"namespace:app-ns",
+		"source_volume:vol-id",
+		"team:storage",
+		"volumesnapshot:db-snap",
+		"volumesnapshotcontent:snapcontent-1234",
+	}, tagger.tags)
+
+	// Existing snapshot is tagged again, tagging may have failed on the previous attempt
+	fakeStructSession.GetSnapshotByNameReturns(&provider.Snapshot{VolumeID: "vol-id", SnapshotID: "snap-id", SnapshotCRN: "snap-crn"}, nil)
+	_, err = icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id", Parameters: params})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, tagger.calls)
+
+	// Tagging failure does not fail the snapshot creation
+	tagger.err = errors.New("global tagging API returned RC:403")
+	_, err = icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id", Parameters: params})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakeStructSession.CreateSnapshotCallCount())
+}
+
 func TestDeleteSnapshot(t *testing.T) {
 	// test cases
 	testCases := []struct {
@@ -1363,6 +2560,144 @@ func TestControllerExpandVolume(t *testing.T) {
 	}
 }
 
+func TestControllerExpandVolumeBackendLarger(t *testing.T) {
+	cap := 30
+	volName := "test-name"
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), icDriver.logger)
+	assert.Nil(t, err)
+	fakeStructSession := fakeSession.(*fake.FakeSession)
+	fakeStructSession.GetVolumeReturns(&provider.Volume{Capacity: &cap, Name: &volName, VolumeID: "volumeid", Az: "myzone", Region: "myregion"}, nil)
+
+	// Backend volume resized to 30GB outside of Kubernetes, PV requests 20GB
+	response, err := icDriver.cs.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{VolumeId: "volumeid", CapacityRange: stdCapRange})
+	assert.Nil(t, err)
+	assert.Equal(t, &csi.ControllerExpandVolumeResponse{CapacityBytes: 30 * 1024 * 1024 * 1024, NodeExpansionRequired: true}, response)
+	assert.Equal(t, 0, fakeStructSession.ExpandVolumeCallCount())
+}
+
+func TestControllerExpandVolumeBlock(t *testing.T) {
+	cap := 10
+	volName := "test-name"
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), icDriver.logger)
+	assert.Nil(t, err)
+	fakeStructSession := fakeSession.(*fake.FakeSession)
+	fakeStructSession.GetVolumeReturns(&provider.Volume{Capacity: &cap, Name: &volName, VolumeID: "volumeid"}, nil)
+	fakeStructSession.ExpandVolumeReturns(stdCapRange.RequiredBytes, nil)
+
+	// Raw block volumes have no file system to grow on the node
+	response, err := icDriver.cs.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{VolumeId: "volumeid", CapacityRange: stdCapRange, VolumeCapability: stdBlockVolCap[0]})
+	assert.Nil(t, err)
+	assert.Equal(t, &csi.ControllerExpandVolumeResponse{CapacityBytes: stdCapRange.RequiredBytes, NodeExpansionRequired: false}, response)
+	assert.Equal(t, 1, fakeStructSession.ExpandVolumeCallCount())
+
+	response, err = icDriver.cs.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{VolumeId: "volumeid", CapacityRange: stdCapRange, VolumeCapability: stdVolCap[0]})
+	assert.Nil(t, err)
+	assert.True(t, response.NodeExpansionRequired)
+}
+
+func TestControllerModifyVolume(t *testing.T) {
+	cap := 20
+	volName := "test-name"
+	sdpVolume := &provider.Volume{VolumeID: "volumeid", VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: SDPProfile}}}
+	// test cases
+	testCases := []struct {
+		name         string
+		req          *csi.ControllerModifyVolumeRequest
+		libVolume    *provider.Volume
+		libVolumeErr error
+		modifierErr  error
+		expErrCode   codes.Code
+		expModified  bool
+		expBandwidth int32
+	}{
+		{
+			name:       "Empty volume ID",
+			req:        &csi.ControllerModifyVolumeRequest{VolumeId: "", MutableParameters: map[string]string{Throughput: "1000"}},
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:       "Immutable IOPS modify rejected",
+			req:        &csi.ControllerModifyVolumeRequest{VolumeId: "volumeid", MutableParameters: map[string]string{IOPS: "5000"}},
+			libVolume:  sdpVolume,
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Mutable throughput modify",
+			req:          &csi.ControllerModifyVolumeRequest{VolumeId: "volumeid", MutableParameters: map[string]string{Throughput: "1000"}},
+			libVolume:    sdpVolume,
+			expErrCode:   codes.OK,
+			expModified:  true,
+			expBandwidth: 1000,
+		},
+		{
+			name:       "Throughput modify of a custom volume",
+			req:        &csi.ControllerModifyVolumeRequest{VolumeId: "volumeid", MutableParameters: map[string]string{Throughput: "1000"}},
+			libVolume:  &provider.Volume{VolumeID: "volumeid", VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: CustomProfile}}},
+			expErrCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Volume not found",
+			req:          &csi.ControllerModifyVolumeRequest{VolumeId: "volumeid", MutableParameters: map[string]string{Throughput: "1000"}},
+			libVolumeErr: providerError.Message{Code: "StorageFindFailedWithVolumeId", Description: "Volume not found", Type: providerError.EntityNotFound},
+			expErrCode:   codes.NotFound,
+		},
+		{
+			name:         "Modify failed in the backend",
+			req:          &csi.ControllerModifyVolumeRequest{VolumeId: "volumeid", MutableParameters: map[string]string{Throughput: "1000"}},
+			libVolume:    sdpVolume,
+			modifierErr:  errors.New("Trace Code:1, Code:volume_in_use, Description:Volume is busy, RC:409 Conflict"),
+			expErrCode:   codes.Aborted,
+			expModified:  true,
+			expBandwidth: 1000,
+		},
+	}
+
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("IMMUTABLE_VOLUME_ATTRIBUTES", "iops, unknown")
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.Equal(t, true, ok)
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		modifier := &fakeVolumeModifier{err: tc.modifierErr}
+		icDriver.cs.volumeModifier = modifier
+		fakeStructSession.GetVolumeReturns(tc.libVolume, tc.libVolumeErr)
+		_, err := icDriver.cs.ControllerModifyVolume(context.Background(), tc.req)
+		serverError, ok := status.FromError(err)
+		assert.True(t, ok)
+		assert.Equal(t, tc.expErrCode, serverError.Code())
+		assert.Equal(t, tc.expModified, modifier.calls == 1)
+		if tc.expModified {
+			assert.Equal(t, "volumeid", modifier.volumeID)
+			assert.Equal(t, tc.expBandwidth, modifier.bandwidth)
+		}
+	}
+
+	for _, capability := range icDriver.cscap {
+		assert.NotEqual(t, csi.ControllerServiceCapability_RPC_MODIFY_VOLUME, capability.GetRpc().GetType())
+	}
+	t.Setenv("CONTROLLER_MODIFY_VOLUME", "true")
+	advertised := false
+	for _, capability := range initIBMCSIDriver(t).cscap {
+		advertised = advertised || capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_MODIFY_VOLUME
+	}
+	assert.True(t, advertised)
+
+	// Size expansion is still allowed when IOPS is immutable
+	fakeStructSession.ExpandVolumeReturns(stdCapRange.RequiredBytes, nil)
+	fakeStructSession.GetVolumeReturns(&provider.Volume{Capacity: &cap, Name: &volName, VolumeID: "volumeid"}, nil)
+	response, err := icDriver.cs.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{VolumeId: "volumeid", CapacityRange: stdCapRange})
+	assert.Nil(t, err)
+	assert.Equal(t, &csi.ControllerExpandVolumeResponse{CapacityBytes: stdCapRange.RequiredBytes, NodeExpansionRequired: true}, response)
+}
+
 func createVolume(maxEntries int) *provider.VolumeList {
 	volList := &provider.VolumeList{}
 	cap := 10
@@ -1555,3 +2890,65 @@ func TestListSnapshots(t *testing.T) {
 		}
 	}
 }
+
+func TestListSnapshotsFilters(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	createdAt := time.Now()
+	fakeStructSession.GetSnapshotReturns(&provider.Snapshot{SnapshotID: "snap-id", SnapshotCRN: "snap-crn", VolumeID: "test-vol", SnapshotSize: stdCapRange.RequiredBytes, ReadyToUse: true, SnapshotCreationTime: createdAt}, nil)
+
+	// Snapshot and source volume match
+	resp, err := icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SnapshotId: "snap-id", SourceVolumeId: "test-vol"})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 1)
+	snapshot := resp.Entries[0].Snapshot
+	assert.Equal(t, "snap-crn", snapshot.SnapshotId)
+	assert.Equal(t, "test-vol", snapshot.SourceVolumeId)
+	assert.Equal(t, stdCapRange.RequiredBytes, snapshot.SizeBytes)
+	assert.True(t, snapshot.ReadyToUse)
+	assert.True(t, createdAt.Equal(snapshot.CreationTime.AsTime()))
+
+	// Snapshot of another source volume
+	resp, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SnapshotId: "snap-id", SourceVolumeId: "other-vol"})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Entries)
+
+	// Failure other than not found is returned
+	fakeStructSession.GetSnapshotReturns(nil, providerError.Message{Code: "AuthenticationFailed", Description: "Failed to authenticate.", Type: providerError.Unauthenticated})
+	_, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SnapshotId: "snap-id"})
+	assert.NotNil(t, err)
+
+	// Snapshot does not exist, the provider wraps the VPC API error
+	fakeStructSession.GetSnapshotReturns(nil, providerError.Message{Code: "SnapshotIDNotFound", Type: providerError.RetrivalFailed, RC: 404,
+		BackendError: "Trace Code:1, Code:not_found, Description:Snapshot not found, RC:404 Not Found"})
+	resp, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SnapshotId: "snap-id"})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Entries)
+
+	// Other lookup failures wrapped the same way are returned
+	fakeStructSession.GetSnapshotReturns(nil, providerError.Message{Code: "SnapshotIDNotFound", Type: providerError.RetrivalFailed, RC: 404,
+		BackendError: "Trace Code:1, Code:internal_error, Description:Service unavailable, RC:503 Service Unavailable"})
+	_, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SnapshotId: "snap-id"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// Source volume filter
+	fakeStructSession.ListSnapshotsReturns(createSnapshot(2), nil)
+	resp, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{SourceVolumeId: "test-vol", MaxEntries: 2})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Entries, 2)
+	assert.Equal(t, "unit-test-Snapshot2", resp.NextToken)
+	_, _, tags := fakeStructSession.ListSnapshotsArgsForCall(0)
+	assert.Equal(t, map[string]string{"source_volume.id": "test-vol"}, tags)
+
+	// Errors which are not provider errors
+	fakeStructSession.ListSnapshotsReturns(nil, errors.New("connection reset"))
+	_, err = icDriver.cs.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// sysDevBlockPath is the sysfs directory which links the block device numbers to the devices
+var sysDevBlockPath = "/sys/dev/block"
+
+// deviceErrorCounters sysfs device attributes counting the failed and timed out I/O requests,
+// they are exposed by SCSI devices only, e.g not by virtio-blk
+var deviceErrorCounters = []string{"ioerr_cnt", "iotmo_cnt"}
+
+const (
+	// defaultDeviceErrorThreshold I/O errors between two NodeGetVolumeStats calls which make the volume abnormal
+	defaultDeviceErrorThreshold = 10
+)
+
+// deviceHealthProbe reports a volume abnormal when the I/O error counters of its device climb
+type deviceHealthProbe struct {
+	threshold uint64
+	mutex     sync.Mutex
+	// errorCounts last error count seen per volume
+	errorCounts map[string]uint64
+}
+
+// newDeviceHealthProbe returns the device health probe with the threshold set in VOLUME_DEVICE_ERROR_THRESHOLD,
+// 0 disables the probe
+func newDeviceHealthProbe(logger *zap.Logger) *deviceHealthProbe {
+	threshold := getNonNegativeIntEnv(logger, "VOLUME_DEVICE_ERROR_THRESHOLD", defaultDeviceErrorThreshold)
+	return &deviceHealthProbe{threshold: uint64(threshold), errorCounts: make(map[string]uint64)} // #nosec G115: threshold is not negative.
+}
+
+// sysfsDevicePath returns the sysfs device directory of the block device backing the volume path,
+// the device of the file system for a mount point or the device itself for a raw block volume
+func sysfsDevicePath(volumePath string, isBlock bool) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(volumePath, &stat); err != nil {
+		return "", err
+	}
+	dev := uint64(stat.Dev) // #nosec G115: device numbers are unsigned.
+	if isBlock {
+		dev = uint64(stat.Rdev) // #nosec G115: device numbers are unsigned.
+	}
+	return filepath.Join(sysDevBlockPath, fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev)), "device"), nil
+}
+
+// readDeviceErrorCount returns the sum of the device error counters, false if the device exposes none of them
+func readDeviceErrorCount(deviceDir string) (uint64, bool) {
+	var total uint64
+	found := false
+	for _, counter := range deviceErrorCounters {
+		value, err := os.ReadFile(filepath.Join(deviceDir, counter)) // #nosec G304: path is derived from the volume device number.
+		if err != nil {
+			continue
+		}
+		// counters are reported in hex e.g 0x1a
+		count, err := strconv.ParseUint(strings.TrimSpace(string(value)), 0, 64)
+		if err != nil {
+			continue
+		}
+		total += count
+		found = true
+	}
+	return total, found
+}
+
+// check returns the condition of the volume from the increase of the device error counters since the previous check,
+// the volume is healthy if the probe is disabled, the counters are not exposed or on the first check
+func (p *deviceHealthProbe) check(volumeID string, deviceDir string) *csi.VolumeCondition {
+	healthy := &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+	if p.threshold == 0 {
+		return healthy
+	}
+	count, found := readDeviceErrorCount(deviceDir)
+	if !found {
+		return healthy
+	}
+
+	p.mutex.Lock()
+	previous, seen := p.errorCounts[volumeID]
+	p.errorCounts[volumeID] = count
+	p.mutex.Unlock()
+
+	if seen && count >= previous+p.threshold {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("device reported %d I/O errors since the last check, threshold is %d", count-previous, p.threshold),
+		}
+	}
+	return healthy
+}
+
+// forget drops the error count of the volume e.g once it is unstaged
+func (p *deviceHealthProbe) forget(volumeID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.errorCounts, volumeID)
+}
+
+// inaccessibleMountErrors errors returned by the file system of a volume whose device is gone or failing
+var inaccessibleMountErrors = []error{unix.EIO, unix.ENOTCONN, unix.ESTALE, unix.ENODEV, unix.ENXIO}
+
+// isInaccessibleMountError returns true if the error means the mounted volume can not be accessed anymore
+func isInaccessibleMountError(err error) bool {
+	for _, inaccessible := range inaccessibleMountErrors {
+		if errors.Is(err, inaccessible) {
+			return true
+		}
+	}
+	return false
+}
+
+// getVolumeCondition returns the condition of the volume from its device error counters
+func (csiNS *CSINodeServer) getVolumeCondition(ctxLogger *zap.Logger, volumeID string, volumePath string, isBlock bool) *csi.VolumeCondition {
+	deviceDir, err := sysfsDevicePath(volumePath, isBlock)
+	if err != nil {
+		ctxLogger.Warn("Unable to find the device of the volume, reporting it healthy", zap.String("VolumePath", volumePath), zap.Error(err))
+		return &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+	}
+	condition := csiNS.deviceHealth.check(volumeID, deviceDir)
+	if condition.Abnormal {
+		ctxLogger.Warn("Volume is abnormal", zap.String("VolumeID", volumeID), zap.String("Device", deviceDir), zap.String("Message", condition.Message))
+	}
+	return condition
+}
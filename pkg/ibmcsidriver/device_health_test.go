@@ -0,0 +1,168 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+func writeDeviceErrorCounters(t *testing.T, deviceDir string, ioErrors string, timeouts string) {
+	assert.Nil(t, os.MkdirAll(deviceDir, 0750))
+	assert.Nil(t, os.WriteFile(filepath.Join(deviceDir, "ioerr_cnt"), []byte(ioErrors+"\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(deviceDir, "iotmo_cnt"), []byte(timeouts+"\n"), 0600))
+}
+
+func TestReadDeviceErrorCount(t *testing.T) {
+	deviceDir := filepath.Join(t.TempDir(), "device")
+	_, found := readDeviceErrorCount(deviceDir)
+	assert.False(t, found)
+
+	writeDeviceErrorCounters(t, deviceDir, "0x1a", "0x2")
+	count, found := readDeviceErrorCount(deviceDir)
+	assert.True(t, found)
+	assert.Equal(t, uint64(28), count)
+}
+
+func TestDeviceHealthProbe(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	t.Setenv("VOLUME_DEVICE_ERROR_THRESHOLD", "5")
+	probe := newDeviceHealthProbe(logger)
+	deviceDir := filepath.Join(t.TempDir(), "device")
+
+	// no counters exposed e.g virtio-blk
+	assert.False(t, probe.check("vol1", deviceDir).Abnormal)
+
+	// first check records the count
+	writeDeviceErrorCounters(t, deviceDir, "0x10", "0x0")
+	assert.False(t, probe.check("vol1", deviceDir).Abnormal)
+
+	// below the threshold
+	writeDeviceErrorCounters(t, deviceDir, "0x14", "0x0")
+	assert.False(t, probe.check("vol1", deviceDir).Abnormal)
+
+	// crossing the threshold
+	writeDeviceErrorCounters(t, deviceDir, "0x18", "0x3")
+	condition := probe.check("vol1", deviceDir)
+	assert.True(t, condition.Abnormal)
+	assert.Contains(t, condition.Message, "7 I/O errors")
+
+	// errors stopped climbing
+	assert.False(t, probe.check("vol1", deviceDir).Abnormal)
+
+	// forgotten volume starts over
+	probe.forget("vol1")
+	writeDeviceErrorCounters(t, deviceDir, "0x40", "0x3")
+	assert.False(t, probe.check("vol1", deviceDir).Abnormal)
+
+	// disabled probe
+	t.Setenv("VOLUME_DEVICE_ERROR_THRESHOLD", "0")
+	disabled := newDeviceHealthProbe(logger)
+	assert.False(t, disabled.check("vol1", deviceDir).Abnormal)
+	writeDeviceErrorCounters(t, deviceDir, "0x80", "0x3")
+	assert.False(t, disabled.check("vol1", deviceDir).Abnormal)
+}
+
+func TestDeviceHealthProbeConcurrentAccess(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	probe := newDeviceHealthProbe(logger)
+	deviceDir := filepath.Join(t.TempDir(), "device")
+	writeDeviceErrorCounters(t, deviceDir, "0x0", "0x0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			volumeID := "vol" + strconv.Itoa(i%5)
+			for j := 0; j < 50; j++ {
+				assert.False(t, probe.check(volumeID, deviceDir).Abnormal)
+				if j%10 == 0 {
+					probe.forget(volumeID)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, len(probe.errorCounts), 5)
+}
+
+func TestNodeGetVolumeStatsVolumeCondition(t *testing.T) {
+	oldSysDevBlockPath := sysDevBlockPath
+	sysDevBlockPath = t.TempDir()
+	defer func() { sysDevBlockPath = oldSysDevBlockPath }()
+
+	icDriver := initIBMCSIDriver(t)
+	volumePath := filepath.Join(t.TempDir(), "notblock")
+	assert.Nil(t, os.Mkdir(volumePath, 0750))
+	deviceDir, err := sysfsDevicePath(volumePath, false)
+	assert.Nil(t, err)
+	assert.Equal(t, sysDevBlockPath, filepath.Dir(filepath.Dir(deviceDir)))
+
+	req := &csi.NodeGetVolumeStatsRequest{VolumeId: defaultVolumeID, VolumePath: volumePath}
+	writeDeviceErrorCounters(t, deviceDir, "0x0", "0x0")
+	resp, err := icDriver.ns.NodeGetVolumeStats(context.Background(), req)
+	assert.Nil(t, err)
+	assert.False(t, resp.VolumeCondition.Abnormal)
+
+	writeDeviceErrorCounters(t, deviceDir, "0x20", "0x0")
+	resp, err = icDriver.ns.NodeGetVolumeStats(context.Background(), req)
+	assert.Nil(t, err)
+	assert.True(t, resp.VolumeCondition.Abnormal)
+	assert.Contains(t, resp.VolumeCondition.Message, "32 I/O errors")
+}
+
+// fsInfoErrorStats returns the error for the file system stats of any volume
+type fsInfoErrorStats struct {
+	MockStatUtils
+	err error
+}
+
+func (su *fsInfoErrorStats) FSInfo(path string) (int64, int64, int64, int64, int64, int64, error) {
+	return 0, 0, 0, 0, 0, 0, su.err
+}
+
+func TestNodeGetVolumeStatsInaccessibleMount(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	req := &csi.NodeGetVolumeStatsRequest{VolumeId: defaultVolumeID, VolumePath: notBlockDevice}
+
+	// I/O error on a mounted volume whose device is gone
+	icDriver.ns.Stats = &fsInfoErrorStats{err: unix.EIO}
+	resp, err := icDriver.ns.NodeGetVolumeStats(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Usage)
+	assert.True(t, resp.VolumeCondition.Abnormal)
+	assert.Contains(t, resp.VolumeCondition.Message, "is not accessible")
+
+	// other errors are still failures
+	icDriver.ns.Stats = &fsInfoErrorStats{err: errors.New("statfs failed")}
+	_, err = icDriver.ns.NodeGetVolumeStats(context.Background(), req)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/IBM/ibmcloud-volume-interface/config"
+)
+
+// redactedValue replaces the credentials found in the endpoint URLs
+const redactedValue = "REDACTED"
+
+// ProviderEndpoints are the effective endpoints used by the provider, with credentials redacted
+type ProviderEndpoints struct {
+	IAM           string `json:"iam"`
+	TokenExchange string `json:"tokenExchange"`
+	VPCIaaS       string `json:"vpcIaaS"`
+	GlobalTagging string `json:"globalTagging"`
+}
+
+// getProviderEndpoints resolves the endpoints the same way the provider library does i.e
+// the private VPC endpoint takes precedence over the public one if configured
+func getProviderEndpoints(conf *config.Config) ProviderEndpoints {
+	endpoints := ProviderEndpoints{
+		GlobalTagging: redactEndpoint(os.Getenv("IBMCLOUD_GT_API_ENDPOINT")),
+	}
+	if conf == nil {
+		return endpoints
+	}
+	if conf.Bluemix != nil {
+		endpoints.IAM = redactEndpoint(conf.Bluemix.IamURL)
+	}
+	if conf.VPC != nil {
+		vpcEndpoint := conf.VPC.G2EndpointURL
+		if len(conf.VPC.G2EndpointPrivateURL) != 0 {
+			vpcEndpoint = conf.VPC.G2EndpointPrivateURL
+		}
+		endpoints.VPCIaaS = redactEndpoint(vpcEndpoint)
+
+		tokenExchange := conf.VPC.G2TokenExchangeURL
+		if len(conf.VPC.IKSTokenExchangePrivateURL) != 0 {
+			tokenExchange = conf.VPC.IKSTokenExchangePrivateURL
+		}
+		endpoints.TokenExchange = redactEndpoint(tokenExchange)
+	}
+	return endpoints
+}
+
+// redactEndpoint removes the user info password and the query parameter values of the endpoint URL
+func redactEndpoint(endpoint string) string {
+	if len(endpoint) == 0 {
+		return ""
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return redactedValue
+	}
+	if u.User != nil {
+		u.User = url.User(redactedValue)
+	}
+	if len(u.RawQuery) != 0 {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, redactedValue)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// ServeConfig serves the effective provider endpoints
+func (icDriver *IBMCSIDriver) ServeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoints": getProviderEndpoints(icDriver.cs.CSIProvider.GetConfig()),
+	})
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// otherFSType metric label of the file system types which are not known
+	otherFSType = "other"
+)
+
+// fsTypeMagics file system types by statfs f_type magic number, types not listed are reported as other
+// to keep the cardinality of the fstype metric label bounded
+var fsTypeMagics = map[int64]string{
+	0xEF53:     "ext4", // shared by ext2, ext3 and ext4
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x01021994: "tmpfs",
+	0x794C7630: "overlay",
+	0x6969:     "nfs",
+}
+
+// getDefaultFsType returns the file system type of the volumes whose capability does not set one, DEFAULT_FS_TYPE
+// if it is one of SupportedFS, ext4 otherwise
+func getDefaultFsType(logger *zap.Logger) string {
+	fsType := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_FS_TYPE")))
+	if len(fsType) == 0 {
+		return defaultFsType
+	}
+	for _, supported := range SupportedFS {
+		if fsType == supported {
+			return fsType
+		}
+	}
+	if logger != nil {
+		logger.Warn("Unsupported default file system type", zap.String("DEFAULT_FS_TYPE", fsType), zap.Strings("Supported", SupportedFS), zap.String("Considered value", defaultFsType))
+	}
+	return defaultFsType
+}
+
+// fsTypeFromMagic returns the file system type of the statfs f_type magic number
+func fsTypeFromMagic(magic int64) string {
+	if fsType, ok := fsTypeMagics[magic]; ok {
+		return fsType
+	}
+	return otherFSType
+}
+
+// filesystemType returns the type of the file system mounted at the path
+func filesystemType(path string) (string, error) {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return "", err
+	}
+	return fsTypeFromMagic(int64(statfs.Type)), nil // #nosec G115: f_type magic numbers fit in int64.
+}
+
+// filesystemTracker counts the mounted volumes of the node per file system type
+type filesystemTracker struct {
+	mutex sync.Mutex
+	// fsTypes file system type per volume
+	fsTypes map[string]string
+}
+
+// newFilesystemTracker ...
+func newFilesystemTracker() *filesystemTracker {
+	return &filesystemTracker{fsTypes: make(map[string]string)}
+}
+
+// record sets the file system type of the volume
+func (t *filesystemTracker) record(volumeID string, fsType string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, seen := t.fsTypes[volumeID]
+	if seen && previous == fsType {
+		return
+	}
+	if seen {
+		mountedVolumeFilesystems.WithLabelValues(previous).Dec()
+	}
+	t.fsTypes[volumeID] = fsType
+	mountedVolumeFilesystems.WithLabelValues(fsType).Inc()
+}
+
+// forget drops the volume e.g once it is unstaged
+func (t *filesystemTracker) forget(volumeID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if fsType, seen := t.fsTypes[volumeID]; seen {
+		mountedVolumeFilesystems.WithLabelValues(fsType).Dec()
+		delete(t.fsTypes, volumeID)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func readMountedVolumeFilesystems(t *testing.T, fsType string) float64 {
+	m := &dto.Metric{}
+	assert.Nil(t, mountedVolumeFilesystems.WithLabelValues(fsType).Write(m))
+	return m.GetGauge().GetValue()
+}
+
+func TestGetDefaultFsType(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	assert.Equal(t, "ext4", getDefaultFsType(logger))
+	t.Setenv("DEFAULT_FS_TYPE", " XFS ")
+	assert.Equal(t, "xfs", getDefaultFsType(logger))
+	t.Setenv("DEFAULT_FS_TYPE", "btrfs")
+	assert.Equal(t, "ext4", getDefaultFsType(logger))
+}
+
+func TestFSTypeFromMagic(t *testing.T) {
+	testCases := []struct {
+		magic     int64
+		expFSType string
+	}{
+		{magic: 0xEF53, expFSType: "ext4"},
+		{magic: 0x58465342, expFSType: "xfs"},
+		{magic: 0x9123683E, expFSType: "btrfs"},
+		{magic: 0x01021994, expFSType: "tmpfs"},
+		{magic: 0x12345678, expFSType: otherFSType},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expFSType, fsTypeFromMagic(tc.magic))
+	}
+
+	fsType, err := filesystemType(t.TempDir())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, fsType)
+	_, err = filesystemType("/invalid/path")
+	assert.NotNil(t, err)
+}
+
+func TestFilesystemTracker(t *testing.T) {
+	mountedVolumeFilesystems.Reset()
+	tracker := newFilesystemTracker()
+
+	tracker.record("vol1", "ext4")
+	tracker.record("vol1", "ext4")
+	tracker.record("vol2", "ext4")
+	assert.Equal(t, float64(2), readMountedVolumeFilesystems(t, "ext4"))
+
+	// volume reformatted
+	tracker.record("vol2", "xfs")
+	assert.Equal(t, float64(1), readMountedVolumeFilesystems(t, "ext4"))
+	assert.Equal(t, float64(1), readMountedVolumeFilesystems(t, "xfs"))
+
+	tracker.forget("vol1")
+	tracker.forget("vol3")
+	assert.Equal(t, float64(0), readMountedVolumeFilesystems(t, "ext4"))
+	assert.Equal(t, float64(1), readMountedVolumeFilesystems(t, "xfs"))
+}
+
+func TestFilesystemTrackerConcurrentAccess(t *testing.T) {
+	mountedVolumeFilesystems.Reset()
+	tracker := newFilesystemTracker()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			volumeID := "vol" + strconv.Itoa(i)
+			for j := 0; j < 50; j++ {
+				tracker.record(volumeID, []string{"ext4", "xfs"}[j%2])
+			}
+			if i%2 == 0 {
+				tracker.forget(volumeID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Gauges match the volumes still tracked, the last type recorded is xfs
+	assert.Equal(t, float64(0), readMountedVolumeFilesystems(t, "ext4"))
+	assert.Equal(t, float64(10), readMountedVolumeFilesystems(t, "xfs"))
+	assert.Equal(t, 10, len(tracker.fsTypes))
+}
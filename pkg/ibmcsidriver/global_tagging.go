@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"golang.org/x/net/context"
+)
+
+// defaultGlobalTaggingEndpoint public Global Tagging API endpoint, IBMCLOUD_GT_API_ENDPOINT sets the private one
+const defaultGlobalTaggingEndpoint = "https://tags.global-search-tagging.cloud.ibm.com"
+
+// resourceTagger attaches user tags to a resource by CRN
+type resourceTagger interface {
+	attachTags(ctx context.Context, session provider.Session, crn string, tags []string) error
+}
+
+// globalTaggingClient attaches user tags through the Global Tagging API with the IAM access token of the provider
+// session. The VPC provider does not send the snapshot tags, so the snapshots are tagged this way.
+type globalTaggingClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// newGlobalTaggingClient returns the Global Tagging client of the IBMCLOUD_GT_API_ENDPOINT endpoint, the public
+// endpoint if not set
+func newGlobalTaggingClient() *globalTaggingClient {
+	endpoint := strings.TrimSpace(os.Getenv("IBMCLOUD_GT_API_ENDPOINT"))
+	if len(endpoint) == 0 {
+		endpoint = defaultGlobalTaggingEndpoint
+	}
+	return &globalTaggingClient{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// attachTagsRequest body of the Global Tagging attach request
+type attachTagsRequest struct {
+	Resources []attachTagsResource `json:"resources"`
+	TagNames  []string             `json:"tag_names"`
+}
+
+type attachTagsResource struct {
+	ResourceID string `json:"resource_id"`
+}
+
+// attachTagsResponse body of the Global Tagging attach response, the request succeeds even if a resource fails
+type attachTagsResponse struct {
+	Results []struct {
+		ResourceID string `json:"resource_id"`
+		IsError    bool   `json:"is_error"`
+	} `json:"results"`
+}
+
+// attachTags attaches the user tags to the resource, the tags already attached are kept
+func (c *globalTaggingClient) attachTags(ctx context.Context, session provider.Session, crn string, tags []string) error {
+	creds, ok := getSessionCredentials(session)
+	if !ok || creds.AuthType != provider.IAMAccessToken || len(creds.Credential) == 0 {
+		return fmt.Errorf("no IAM access token in the provider session")
+	}
+	body, err := json.Marshal(attachTagsRequest{Resources: []attachTagsResource{{ResourceID: crn}}, TagNames: tags})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/v3/tags/attach?tag_type=user", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.Credential)
+	req.Header.Set("Content-Type", "application/json")
+	if requestID := ctx.Value(provider.RequestID); requestID != nil {
+		req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("global tagging API returned RC:%d %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var result attachTagsResponse
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("invalid global tagging API response: %v", err)
+	}
+	for _, r := range result.Results {
+		if r.IsError {
+			return fmt.Errorf("global tagging API failed to tag %s", r.ResourceID)
+		}
+	}
+	return nil
+}
+
+// getTagNames returns the tags as the sorted key:value tag names, or key if the tag has no value
+func getTagNames(tags map[string]string) []string {
+	names := make([]string, 0, len(tags))
+	for key, value := range tags {
+		name := key
+		if len(value) != 0 {
+			name = key + ":" + value
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
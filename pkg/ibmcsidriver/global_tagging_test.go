@@ -0,0 +1,109 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeResourceTagger records the tags attached
+type fakeResourceTagger struct {
+	calls int
+	crn   string
+	tags  []string
+	err   error
+}
+
+func (f *fakeResourceTagger) attachTags(ctx context.Context, session provider.Session, crn string, tags []string) error {
+	f.calls++
+	f.crn = crn
+	f.tags = tags
+	return f.err
+}
+
+func TestNewGlobalTaggingClient(t *testing.T) {
+	assert.Equal(t, defaultGlobalTaggingEndpoint, newGlobalTaggingClient().endpoint)
+
+	t.Setenv("IBMCLOUD_GT_API_ENDPOINT", "https://tags.private.global-search-tagging.cloud.ibm.com/")
+	assert.Equal(t, "https://tags.private.global-search-tagging.cloud.ibm.com", newGlobalTaggingClient().endpoint)
+}
+
+func TestGlobalTaggingAttachTags(t *testing.T) {
+	var received attachTagsRequest
+	isError := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v3/tags/attach", r.URL.Path)
+		assert.Equal(t, "user", r.URL.Query().Get("tag_type"))
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "req-42", r.Header.Get("X-Request-ID"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{"resource_id": "snap-crn", "is_error": isError}},
+		})
+	}))
+	defer server.Close()
+
+	client := &globalTaggingClient{endpoint: server.URL, httpClient: server.Client()}
+	session := &vpcprovider.VPCSession{ContextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: "test-token"}}
+	ctx := context.WithValue(context.Background(), provider.RequestID, "req-42")
+
+	err := client.attachTags(ctx, session, "snap-crn", []string{"consistency:crash", "name:snap"})
+	assert.Nil(t, err)
+	assert.Equal(t, []attachTagsResource{{ResourceID: "snap-crn"}}, received.Resources)
+	assert.Equal(t, []string{"consistency:crash", "name:snap"}, received.TagNames)
+
+	// Rate limited sessions hold the VPC session
+	err = client.attachTags(ctx, &rateLimitedSession{Session: session}, "snap-crn", []string{"name:snap"})
+	assert.Nil(t, err)
+
+	// Resource not tagged
+	isError = true
+	err = client.attachTags(ctx, session, "snap-crn", []string{"name:snap"})
+	assert.ErrorContains(t, err, "failed to tag snap-crn")
+
+	// No IAM access token
+	err = client.attachTags(ctx, &fake.FakeSession{}, "snap-crn", []string{"name:snap"})
+	assert.ErrorContains(t, err, "no IAM access token")
+}
+
+func TestGlobalTaggingAttachTagsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"message":"forbidden"}]}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := &globalTaggingClient{endpoint: server.URL, httpClient: server.Client()}
+	session := &vpcprovider.VPCSession{ContextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: "test-token"}}
+	err := client.attachTags(context.Background(), session, "snap-crn", []string{"name:snap"})
+	assert.ErrorContains(t, err, "RC:403")
+}
+
+func TestGetTagNames(t *testing.T) {
+	assert.Equal(t, []string{"costcenter", "name:snap", "team:storage"}, getTagNames(map[string]string{"team": "storage", "name": "snap", "costcenter": ""}))
+	assert.Empty(t, getTagNames(nil))
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
+	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+)
+
+// nsenterArgs returns the nsenter arguments running the command in the mount namespace
+func nsenterArgs(mountNamespace string, cmd string, args ...string) []string {
+	return append([]string{"--mount=" + mountNamespace, "--", cmd}, args...)
+}
+
+// nsenterExec runs the commands e.g mkfs, fsck, blkid or resize2fs in the host mount namespace
+type nsenterExec struct {
+	utilexec.Interface
+	mountNamespace string
+}
+
+// Command ...
+func (e *nsenterExec) Command(cmd string, args ...string) utilexec.Cmd {
+	return e.Interface.Command("nsenter", nsenterArgs(e.mountNamespace, cmd, args...)...)
+}
+
+// CommandContext ...
+func (e *nsenterExec) CommandContext(ctx context.Context, cmd string, args ...string) utilexec.Cmd {
+	return e.Interface.CommandContext(ctx, "nsenter", nsenterArgs(e.mountNamespace, cmd, args...)...)
+}
+
+// hostNamespaceMounter mounts and unmounts in the host mount namespace, so that the stage and publish mounts are
+// visible to kubelet and the pods whatever the mount propagation of the driver container. Mount points are read
+// from the mountinfo of the host mount namespace, so that the stage and publish checks see the mounts made there.
+type hostNamespaceMounter struct {
+	mount.Interface
+	exec          utilexec.Interface
+	mountInfoPath string
+}
+
+// List returns the mount points of the host mount namespace
+func (m *hostNamespaceMounter) List() ([]mount.MountPoint, error) {
+	infos, err := mount.ParseMountInfo(m.mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	mountPoints := make([]mount.MountPoint, 0, len(infos))
+	for _, info := range infos {
+		mountPoints = append(mountPoints, mount.MountPoint{
+			Device: info.Source,
+			Path:   info.MountPoint,
+			Type:   info.FsType,
+			Opts:   info.MountOptions,
+		})
+	}
+	return mountPoints, nil
+}
+
+// IsLikelyNotMountPoint returns false if the file is a mount point of the host mount namespace. As with the
+// default mounter the error of a file which does not exist is returned. If the host mountinfo cannot be read
+// the mount point is checked in the driver mount namespace.
+func (m *hostNamespaceMounter) IsLikelyNotMountPoint(file string) (bool, error) {
+	if _, err := os.Stat(file); err != nil {
+		return true, err
+	}
+	mountPoints, err := m.List()
+	if err != nil {
+		return m.Interface.IsLikelyNotMountPoint(file)
+	}
+	file = filepath.Clean(file)
+	for _, mp := range mountPoints {
+		if mp.Path == file {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Mount ...
+func (m *hostNamespaceMounter) Mount(source string, target string, fstype string, options []string) error {
+	return m.MountSensitive(source, target, fstype, options, nil)
+}
+
+// MountSensitive ...
+func (m *hostNamespaceMounter) MountSensitive(source string, target string, fstype string, options []string, sensitiveOptions []string) error {
+	return m.MountSensitiveWithoutSystemdWithMountFlags(source, target, fstype, options, sensitiveOptions, nil)
+}
+
+// MountSensitiveWithoutSystemd ...
+func (m *hostNamespaceMounter) MountSensitiveWithoutSystemd(source string, target string, fstype string, options []string, sensitiveOptions []string) error {
+	return m.MountSensitiveWithoutSystemdWithMountFlags(source, target, fstype, options, sensitiveOptions, nil)
+}
+
+// MountSensitiveWithoutSystemdWithMountFlags ...
+func (m *hostNamespaceMounter) MountSensitiveWithoutSystemdWithMountFlags(source string, target string, fstype string, options []string, sensitiveOptions []string, mountFlags []string) error {
+	args, logArgs := mount.MakeMountArgsSensitiveWithMountFlags(source, target, fstype, options, sensitiveOptions, mountFlags)
+	if out, err := m.exec.Command("mount", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("mount failed in the host mount namespace: %v, mounting arguments: %s, output: %s", err, logArgs, string(out))
+	}
+	return nil
+}
+
+// Unmount ...
+func (m *hostNamespaceMounter) Unmount(target string) error {
+	if out, err := m.exec.Command("umount", target).CombinedOutput(); err != nil {
+		return fmt.Errorf("unmount failed in the host mount namespace: %v, unmounting arguments: %s, output: %s", err, target, string(out))
+	}
+	return nil
+}
+
+// isSameMountNamespace returns true if the driver already runs in the mount namespace e.g not containerized
+func isSameMountNamespace(mountNamespace string) bool {
+	own, err := os.Readlink("/proc/self/ns/mnt")
+	if err != nil {
+		return false
+	}
+	other, err := os.Readlink(mountNamespace)
+	return err == nil && own == other
+}
+
+// newHostNamespaceNodeMounter returns the node mounter running the mount, unmount and file system commands
+// in the mountNamespace with nsenter. The mount points are read from the mountinfo of the same process
+// e.g /host/proc/1/mountinfo for /host/proc/1/ns/mnt.
+func newHostNamespaceNodeMounter(mountNamespace string, exec utilexec.Interface) mountManager.Mounter {
+	nsExec := &nsenterExec{Interface: exec, mountNamespace: mountNamespace}
+	mountInfoPath := filepath.Join(filepath.Dir(filepath.Dir(mountNamespace)), "mountinfo")
+	return &mountManager.NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{
+		Interface: &hostNamespaceMounter{Interface: mount.New(""), exec: nsExec, mountInfoPath: mountInfoPath},
+		Exec:      nsExec,
+	}}
+}
+
+// NewNodeMounter returns the node mounter. If hostMountPath, the host mount namespace e.g /host/proc/1/ns/mnt,
+// is set and the driver runs in another mount namespace the mounts are performed in the host mount namespace.
+func NewNodeMounter(hostMountPath string) (mountManager.Mounter, bool) {
+	if len(hostMountPath) == 0 || isSameMountNamespace(hostMountPath) {
+		return mountManager.NewNodeMounter(), false
+	}
+	return newHostNamespaceNodeMounter(hostMountPath, utilexec.New()), true
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestHostNamespaceNodeMounter(t *testing.T) {
+	var commands [][]string
+	recordCommand := func(cmd string, args ...string) exec.Cmd {
+		commands = append(commands, append([]string{cmd}, args...))
+		return &testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+		}}
+	}
+	fakeExec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{recordCommand, recordCommand, recordCommand}}
+
+	mounter := newHostNamespaceNodeMounter("/host/proc/1/ns/mnt", fakeExec)
+	assert.Nil(t, mounter.Mount("/dev/vdb", "/staging", "ext4", []string{"defaults"}))
+	assert.Nil(t, mounter.Unmount("/staging"))
+	_, err := mounter.GetSafeFormatAndMount().Exec.CommandContext(context.Background(), "blkid", "/dev/vdb").CombinedOutput()
+	assert.Nil(t, err)
+
+	assert.Equal(t, [][]string{
+		{"nsenter", "--mount=/host/proc/1/ns/mnt", "--", "mount", "-t", "ext4", "-o", "defaults", "/dev/vdb", "/staging"},
+		{"nsenter", "--mount=/host/proc/1/ns/mnt", "--", "umount", "/staging"},
+		{"nsenter", "--mount=/host/proc/1/ns/mnt", "--", "blkid", "/dev/vdb"},
+	}, commands)
+}
+
+func TestHostNamespaceMountPoints(t *testing.T) {
+	hostProc := filepath.Join(t.TempDir(), "proc", "1")
+	staging := filepath.Join(t.TempDir(), "staging")
+	publish := filepath.Join(t.TempDir(), "publish")
+	assert.Nil(t, os.MkdirAll(filepath.Join(hostProc, "ns"), 0750))
+	assert.Nil(t, os.Mkdir(staging, 0750))
+	assert.Nil(t, os.Mkdir(publish, 0750))
+
+	mounter := newHostNamespaceNodeMounter(filepath.Join(hostProc, "ns", "mnt"), &testingexec.FakeExec{})
+
+	// Host mountinfo not readable, checked in the driver mount namespace
+	notMounted, err := mounter.IsLikelyNotMountPoint(staging)
+	assert.Nil(t, err)
+	assert.True(t, notMounted)
+
+	// Staged in the host mount namespace only, NodeStageVolume must not mount again and NodeUnstageVolume must unmount
+	mountInfo := "22 1 252:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw\n" +
+		"520 22 252:16 / " + staging + " rw,relatime shared:300 - ext4 /dev/vdb rw\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(hostProc, "mountinfo"), []byte(mountInfo), 0600))
+	notMounted, err = mounter.IsLikelyNotMountPoint(staging)
+	assert.Nil(t, err)
+	assert.False(t, notMounted)
+	notMounted, err = mounter.IsLikelyNotMountPoint(staging + "/")
+	assert.Nil(t, err)
+	assert.False(t, notMounted)
+
+	// Not published yet
+	notMounted, err = mounter.IsLikelyNotMountPoint(publish)
+	assert.Nil(t, err)
+	assert.True(t, notMounted)
+
+	// Already unpublished
+	_, err = mounter.IsLikelyNotMountPoint(filepath.Join(publish, "missing"))
+	assert.True(t, os.IsNotExist(err))
+
+	mountPoints, err := mounter.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mountPoints))
+	assert.Equal(t, "/dev/vdb", mountPoints[1].Device)
+	assert.Equal(t, staging, mountPoints[1].Path)
+	assert.Equal(t, "ext4", mountPoints[1].Type)
+}
+
+func TestNewNodeMounter(t *testing.T) {
+	// Not configured
+	mounter, hostNamespaceMounts := NewNodeMounter("")
+	assert.False(t, hostNamespaceMounts)
+	assert.IsType(t, &mountManager.NodeMounter{}, mounter)
+	_, isHostNamespaceMounter := mounter.GetSafeFormatAndMount().Interface.(*hostNamespaceMounter)
+	assert.False(t, isHostNamespaceMounter)
+
+	// Driver already in the host mount namespace
+	_, hostNamespaceMounts = NewNodeMounter("/proc/self/ns/mnt")
+	assert.False(t, hostNamespaceMounts)
+
+	// Containerized driver
+	_, hostNamespaceMounts = NewNodeMounter("/host/proc/1/ns/mnt")
+	assert.True(t, hostNamespaceMounts)
+}
@@ -18,7 +18,9 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	commonError "github.com/IBM/ibm-csi-common/pkg/messages"
 	nodeMetadata "github.com/IBM/ibm-csi-common/pkg/metadata"
@@ -27,6 +29,10 @@ import (
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 // IBMCSIDriver ...
@@ -39,6 +45,7 @@ type IBMCSIDriver struct {
 	ids           *CSIIdentityServer
 	ns            *CSINodeServer
 	cs            *CSIControllerServer
+	server        NonBlockingGRPCServer
 
 	vcap  []*csi.VolumeCapability_AccessMode
 	cscap []*csi.ControllerServiceCapability
@@ -90,27 +97,70 @@ func (icDriver *IBMCSIDriver) SetupIBMCSIDriver(provider cloudProvider.CloudProv
 		// csi.ControllerServiceCapability_RPC_PUBLISH_READONLY,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 	}
+	// Opt-in as ListVolumes then reports the volume status, which older COs may not expect
+	volumeCondition := os.Getenv("CONTROLLER_VOLUME_CONDITION") == TrueStr
+	if volumeCondition {
+		csc = append(csc, csi.ControllerServiceCapability_RPC_VOLUME_CONDITION)
+	}
+	// Opt-in as the COs and the csi-sanity built against older CSI specs reject the unknown MODIFY_VOLUME capability
+	if os.Getenv("CONTROLLER_MODIFY_VOLUME") == TrueStr {
+		csc = append(csc, csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	}
+	// Capacity tracking needs the zone quotas, which the VPC API does not report. The scheduler only uses it once
+	// the csi-provisioner runs with --enable-capacity and the CSIDriver sets storageCapacity
+	if len(os.Getenv("ZONE_VOLUME_CAPACITY_QUOTA")) != 0 {
+		csc = append(csc, csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+	}
 	_ = icDriver.AddControllerServiceCapabilities(csc) // #nosec G104: Attempt to AddControllerServiceCapabilities only on best-effort basis.Error cannot be usefully handled.
 
 	ns := []csi.NodeServiceCapability_RPC_Type{
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 	_ = icDriver.AddNodeServiceCapabilities(ns) // #nosec G104: Attempt to AddNodeServiceCapabilities only on best-effort basis.Error cannot be usefully handled.
 
+	// Validate the default mount options before serving any request
+	defaultMountOptions, err := getDefaultMountOptions()
+	if err != nil {
+		return fmt.Errorf("invalid DEFAULT_MOUNT_OPTIONS: %v", err)
+	}
+	mountOptionsAllowlist, err := getMountOptionsAllowlist()
+	if err != nil {
+		return fmt.Errorf("invalid MOUNT_OPTIONS_ALLOWLIST: %v", err)
+	}
+	backendErrorOverrides, err := getBackendErrorOverrides()
+	if err != nil {
+		return fmt.Errorf("invalid BACKEND_ERROR_CODE_OVERRIDES: %v", err)
+	}
+	namespaceQuotas, err := getNamespaceVolumeQuotas()
+	if err != nil {
+		return fmt.Errorf("invalid NAMESPACE_VOLUME_QUOTA: %v", err)
+	}
+
 	// Set up CSI RPC Servers
 	icDriver.ids = NewIdentityServer(icDriver)
 	icDriver.ns = NewNodeServer(icDriver, mounter, statsUtil, metadata)
+	icDriver.ns.defaultMountOptions = defaultMountOptions
+	icDriver.ns.mountOptionsAllowlist = mountOptionsAllowlist
 	icDriver.cs = NewControllerServer(icDriver, provider)
+	icDriver.cs.backendErrorOverrides = backendErrorOverrides
+	icDriver.cs.namespaceQuotas = namespaceQuotas
+	icDriver.cs.volumeCondition = volumeCondition
+	icDriver.server = NewNonBlockingGRPCServer(icDriver.logger)
 
 	icDriver.logger.Info("Successfully setup IBM CSI driver")
 
 	// Set up Region
-	regionMetadata, err := nodeInfo.NewNodeMetadata(lgr)
+	regionMetadata, err := newNodeMetadataWithRetry(lgr, nodeInfo)
 	if err != nil {
 		return fmt.Errorf("Controller_Helper: Failed to initialize node metadata: error: %v", err)
 	}
+	if icDriver.ns.Metadata == nil {
+		// Reuse the fetched metadata so that NodeGetInfo does not depend on the metadata service again
+		icDriver.ns.Metadata = regionMetadata
+	}
 	icDriver.region = regionMetadata.GetRegion()
 	icDriver.accountID = regionMetadata.GetAccountID()
 
@@ -156,6 +206,32 @@ func (icDriver *IBMCSIDriver) AddNodeServiceCapabilities(nl []csi.NodeServiceCap
 	return nil
 }
 
+// LogStartupSummary logs once the effective driver setup i.e version, capabilities, access modes, region,
+// provider endpoints and the optional features enabled by the caller
+func (icDriver *IBMCSIDriver) LogStartupSummary(features map[string]bool) {
+	controllerCapabilities := make([]string, 0, len(icDriver.cscap))
+	for _, c := range icDriver.cscap {
+		controllerCapabilities = append(controllerCapabilities, c.GetRpc().GetType().String())
+	}
+	nodeCapabilities := make([]string, 0, len(icDriver.nscap))
+	for _, c := range icDriver.nscap {
+		nodeCapabilities = append(nodeCapabilities, c.GetRpc().GetType().String())
+	}
+	accessModes := make([]string, 0, len(icDriver.vcap))
+	for _, m := range icDriver.vcap {
+		accessModes = append(accessModes, m.GetMode().String())
+	}
+	icDriver.logger.Info("IBM CSI driver startup summary",
+		zap.String("DriverName", icDriver.name),
+		zap.String("DriverVersion", icDriver.vendorVersion),
+		zap.String("Region", icDriver.region),
+		zap.Strings("ControllerCapabilities", controllerCapabilities),
+		zap.Strings("NodeCapabilities", nodeCapabilities),
+		zap.Strings("AccessModes", accessModes),
+		zap.Reflect("Endpoints", getProviderEndpoints(icDriver.cs.CSIProvider.GetConfig())),
+		zap.Reflect("Features", features))
+}
+
 // ValidateControllerServiceRequest ...
 /*func (icDriver *IBMCSIDriver) ValidateControllerServiceRequest(c csi.ControllerServiceCapability_RPC_Type) error {
 	icDriver.logger.Info("In Driver's ValidateControllerServiceRequest ...", zap.Reflect("ControllerServiceRequest", c))
@@ -182,18 +258,29 @@ func NewIdentityServer(icDriver *IBMCSIDriver) *CSIIdentityServer {
 // NewNodeServer ...
 func NewNodeServer(icDriver *IBMCSIDriver, mounter mountManager.Mounter, statsUtil StatsUtils, nodeMetadata nodeMetadata.NodeMetadata) *CSINodeServer {
 	return &CSINodeServer{
-		Driver:   icDriver,
-		Mounter:  mounter,
-		Stats:    statsUtil,
-		Metadata: nodeMetadata,
+		Driver:        icDriver,
+		Mounter:       mounter,
+		Stats:         statsUtil,
+		Metadata:      nodeMetadata,
+		resizeLimiter: newFSResizeLimiter(icDriver.logger),
+		deviceHealth:  newDeviceHealthProbe(icDriver.logger),
+		filesystems:   newFilesystemTracker(),
 	}
 }
 
 // NewControllerServer ...
 func NewControllerServer(icDriver *IBMCSIDriver, provider cloudProvider.CloudProviderInterface) *CSIControllerServer {
 	return &CSIControllerServer{
-		Driver:      icDriver,
-		CSIProvider: provider,
+		Driver:          icDriver,
+		CSIProvider:     provider,
+		snapshotLimiter: newSnapshotOperationLimiter(icDriver.logger),
+		expandLimiter:   newVolumeExpansionLimiter(icDriver.logger),
+		opHistory:       newVolumeOperationHistory(icDriver.logger),
+		apiLimiter:      newVPCAPIRateLimiter(icDriver.logger),
+		providerHealth:  newProviderHealthCheck(icDriver.logger),
+		snapshotTagger:  newGlobalTaggingClient(),
+		volumeModifier:  &vpcVolumeModifier{},
+		profileLookup:   newVPCProfileClient(),
 	}
 }
 
@@ -203,7 +290,7 @@ func (icDriver *IBMCSIDriver) Run(endpoint string) {
 	icDriver.logger.Info("CSI Driver Name", zap.Reflect("Name", icDriver.name))
 
 	//Start the nonblocking GRPC
-	s := NewNonBlockingGRPCServer(icDriver.logger)
+	s := icDriver.server
 	// TODO(#34): Only start specific servers based on a flag.
 	// In the future have this only run specific combinations of servers depending on which version this is.
 	// The schema for that was in util. basically it was just s.start but with some nil servers.
@@ -211,3 +298,93 @@ func (icDriver *IBMCSIDriver) Run(endpoint string) {
 	s.Start(endpoint, icDriver.ids, icDriver.cs, icDriver.ns)
 	s.Wait()
 }
+
+// IsReady reports if the driver is accepting connections on the CSI socket
+func (icDriver *IBMCSIDriver) IsReady() bool {
+	return icDriver.server != nil && icDriver.server.IsReady()
+}
+
+// SetKubeClient sets the kubernetes client used by the controller server e.g for the namespace volume quota,
+// and by the node server for the instance profile of the node. The controller server also starts watching the
+// objects of its checks until stopCh is closed.
+func (icDriver *IBMCSIDriver) SetKubeClient(clientset kubernetes.Interface, stopCh <-chan struct{}) {
+	icDriver.cs.kubeClient = clientset
+	icDriver.ns.kubeClient = clientset
+	if os.Getenv("IS_NODE_SERVER") != "true" {
+		icDriver.cs.kubeCache = newKubeObjectCache(clientset)
+		icDriver.cs.kubeCache.start(stopCh)
+	}
+}
+
+// CheckOrphanedStagingMounts reports the staging mounts of the node which have no VolumeAttachment,
+// e.g left behind by a kubelet or driver crash, and unmounts them if cleanup is true
+func (icDriver *IBMCSIDriver) CheckOrphanedStagingMounts(clientset kubernetes.Interface, nodeName string, cleanup bool) error {
+	icDriver.logger.Info("IBMCSIDriver-CheckOrphanedStagingMounts...", zap.String("NodeName", nodeName), zap.Bool("Cleanup", cleanup))
+	attachedVolumes, err := getAttachedVolumes(context.Background(), clientset, icDriver.name, nodeName)
+	if err != nil {
+		return err
+	}
+
+	mountPoints, err := icDriver.ns.Mounter.List()
+	if err != nil {
+		return fmt.Errorf("failed to list mount points: %v", err)
+	}
+
+	orphans := icDriver.ns.findOrphanedStagingMounts(icDriver.logger, mountPoints, attachedVolumes)
+	updateOrphanedStagingMounts(len(orphans))
+	icDriver.logger.Info("Orphaned staging mounts", zap.Int("Count", len(orphans)))
+	if cleanup && len(orphans) != 0 {
+		icDriver.ns.cleanupOrphanedStagingMounts(icDriver.logger, mountPoints, orphans)
+	}
+	return nil
+}
+
+// getAttachedVolumes returns the volume IDs of the driver VolumeAttachments for the node
+func getAttachedVolumes(ctx context.Context, clientset kubernetes.Interface, driverName string, nodeName string) (map[string]bool, error) {
+	vaList, err := clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume attachments: %v", err)
+	}
+	pvList, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+	vas := make([]*storagev1.VolumeAttachment, 0, len(vaList.Items))
+	for i := range vaList.Items {
+		vas = append(vas, &vaList.Items[i])
+	}
+	pvs := make([]*corev1.PersistentVolume, 0, len(pvList.Items))
+	for i := range pvList.Items {
+		pvs = append(pvs, &pvList.Items[i])
+	}
+	return nodeAttachedVolumes(vas, pvs, driverName, nodeName, false), nil
+}
+
+// nodeAttachedVolumes returns the volume IDs of the driver VolumeAttachments for the node. If attachedOnly the
+// VolumeAttachments being deleted or not attached yet are skipped.
+func nodeAttachedVolumes(vas []*storagev1.VolumeAttachment, pvs []*corev1.PersistentVolume, driverName string, nodeName string, attachedOnly bool) map[string]bool {
+	volumeHandles := make(map[string]string)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == driverName {
+			volumeHandles[pv.Name] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+
+	attachedVolumes := make(map[string]bool)
+	for _, va := range vas {
+		if va.Spec.Attacher != driverName || va.Spec.NodeName != nodeName {
+			continue
+		}
+		if attachedOnly && (va.DeletionTimestamp != nil || !va.Status.Attached) {
+			continue
+		}
+		if pvName := va.Spec.Source.PersistentVolumeName; pvName != nil {
+			if volumeHandle, ok := volumeHandles[*pvName]; ok {
+				attachedVolumes[volumeHandle] = true
+			}
+		} else if inline := va.Spec.Source.InlineVolumeSpec; inline != nil && inline.CSI != nil {
+			attachedVolumes[inline.CSI.VolumeHandle] = true
+		}
+	}
+	return attachedVolumes
+}
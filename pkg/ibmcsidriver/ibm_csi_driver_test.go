@@ -18,8 +18,15 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	mount "k8s.io/mount-utils"
 	testingexec "k8s.io/utils/exec/testing"
 
 	nodeMetadata "github.com/IBM/ibm-csi-common/pkg/metadata"
@@ -27,6 +34,8 @@ import (
 	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func initIBMCSIDriver(t *testing.T, fakeActions ...testingexec.FakeCommandAction) *IBMCSIDriver {
@@ -100,4 +109,74 @@ func TestSetupIBMCSIDriver(t *testing.T) {
 	// Failed setting up driver, name empty
 	err = icDriver.SetupIBMCSIDriver(provider, mounter, statsUtil, &fakeNodeData, &fakeNodeInfo, logger, "", vendorVersion)
 	assert.NotNil(t, err)
+
+	// Failed setting up driver, invalid namespace volume quota
+	t.Setenv("NAMESPACE_VOLUME_QUOTA", "team-a=2")
+	err = icDriver.SetupIBMCSIDriver(provider, mounter, statsUtil, &fakeNodeData, &fakeNodeInfo, logger, name, vendorVersion)
+	assert.ErrorContains(t, err, "NAMESPACE_VOLUME_QUOTA")
+	t.Setenv("NAMESPACE_VOLUME_QUOTA", "")
+
+	// Failed setting up driver, invalid default mount options
+	t.Setenv("DEFAULT_MOUNT_OPTIONS", "ext4:ro")
+	err = icDriver.SetupIBMCSIDriver(provider, mounter, statsUtil, &fakeNodeData, &fakeNodeInfo, logger, name, vendorVersion)
+	assert.NotNil(t, err)
+}
+
+func TestCheckOrphanedStagingMounts(t *testing.T) {
+	oldStagingMountsRoot := stagingMountsRoot
+	defer func() { stagingMountsRoot = oldStagingMountsRoot }()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeMounter := setupFakeStagingMounts(t, icDriver.name)
+	icDriver.ns.Mounter = &mountManager.FakeNodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: fakeMounter}}
+
+	pvName := "pv-live"
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pvName},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: icDriver.name, VolumeHandle: "vol-live"},
+			}},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-live"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: icDriver.name,
+				NodeName: "testnode",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+		},
+	)
+
+	// Report only, nothing is unmounted
+	err := icDriver.CheckOrphanedStagingMounts(clientset, "testnode", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(fakeMounter.MountPoints))
+
+	// Cleanup skips the orphaned staging mount in use by a pod
+	err = icDriver.CheckOrphanedStagingMounts(clientset, "testnode", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(fakeMounter.MountPoints))
+
+	// Volume attachment of another node, live staging mount is orphaned as well
+	err = icDriver.CheckOrphanedStagingMounts(clientset, "othernode", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(fakeMounter.MountPoints))
+}
+
+func TestLogStartupSummary(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	buf := &bytes.Buffer{}
+	icDriver.logger = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.InfoLevel))
+	icDriver.LogStartupSummary(map[string]bool{"tracing": true, "pvWatcher": false})
+
+	logs := buf.String()
+	assert.Equal(t, 1, strings.Count(logs, "\n"))
+	assert.Contains(t, logs, "IBM CSI driver startup summary")
+	assert.Contains(t, logs, `"DriverVersion":"test-vendor-version-1.1.2"`)
+	assert.Contains(t, logs, `"Region":"testregion"`)
+	assert.Contains(t, logs, "CREATE_DELETE_VOLUME")
+	assert.Contains(t, logs, "STAGE_UNSTAGE_VOLUME")
+	assert.Contains(t, logs, "SINGLE_NODE_WRITER")
+	assert.Contains(t, logs, `"tracing":true`)
 }
@@ -19,10 +19,10 @@ package ibmcsidriver
 
 import (
 	commonError "github.com/IBM/ibm-csi-common/pkg/messages"
-	"github.com/IBM/ibm-csi-common/pkg/utils"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // CSIIdentityServer ...
@@ -33,7 +33,7 @@ type CSIIdentityServer struct {
 
 // GetPluginInfo ...
 func (csiIdentity *CSIIdentityServer) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	ctxLogger.Info("CSIIdentityServer-GetPluginInfo...", zap.Reflect("Request", req))
 
 	if csiIdentity.Driver == nil {
@@ -48,7 +48,7 @@ func (csiIdentity *CSIIdentityServer) GetPluginInfo(ctx context.Context, req *cs
 
 // GetPluginCapabilities ...
 func (csiIdentity *CSIIdentityServer) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
-	ctxLogger, _ := utils.GetContextLogger(ctx, false)
+	ctxLogger, _ := getContextLogger(ctx)
 	ctxLogger.Info("CSIIdentityServer-GetPluginCapabilities...", zap.Reflect("Request", req))
 
 	return &csi.GetPluginCapabilitiesResponse{
@@ -78,7 +78,12 @@ func (csiIdentity *CSIIdentityServer) GetPluginCapabilities(ctx context.Context,
 	}, nil
 }
 
-// Probe ...
+// Probe reports ready once the CSI socket is served and, for the controller, while the VPC API is reachable
 func (csiIdentity *CSIIdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	return &csi.ProbeResponse{}, nil
+	ready := csiIdentity.Driver != nil && csiIdentity.Driver.IsReady()
+	if ready && csiIdentity.Driver.cs != nil {
+		ctxLogger, _ := getContextLogger(ctx)
+		ready = csiIdentity.Driver.cs.providerHealth.check(ctxLogger, csiIdentity.Driver.cs) == nil
+	}
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(ready)}, nil
 }
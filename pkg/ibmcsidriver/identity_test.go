@@ -83,8 +83,12 @@ func TestProbe(t *testing.T) {
 		t.Fatalf("Failed to setup IBM CSI Driver")
 	}
 
-	_, err := icDriver.ids.Probe(context.Background(), &csi.ProbeRequest{})
+	resp, err := icDriver.ids.Probe(context.Background(), &csi.ProbeRequest{})
 	if err != nil {
 		t.Fatalf("Probe returned unexpected error: %v", err)
 	}
+	// CSI socket is not served yet
+	if resp.GetReady().GetValue() {
+		t.Fatalf("Probe returned ready before the server started")
+	}
 }
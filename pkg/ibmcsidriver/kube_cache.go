@@ -0,0 +1,105 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// kubeObjectCache watches the VolumeAttachments, PersistentVolumes and CSINodes for the controller server, so that
+// the checks before attaching or creating a volume read them from memory rather than listing them on every call
+type kubeObjectCache struct {
+	volumeAttachments cache.SharedIndexInformer
+	persistentVolumes cache.SharedIndexInformer
+	csiNodes          cache.SharedIndexInformer
+}
+
+// newKubeObjectCache returns the informers of the objects, started with start
+func newKubeObjectCache(clientset kubernetes.Interface) *kubeObjectCache {
+	vaClient := clientset.StorageV1().VolumeAttachments()
+	pvClient := clientset.CoreV1().PersistentVolumes()
+	csiNodeClient := clientset.StorageV1().CSINodes()
+	return &kubeObjectCache{
+		volumeAttachments: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc:  func(o metav1.ListOptions) (runtime.Object, error) { return vaClient.List(context.Background(), o) },
+			WatchFunc: func(o metav1.ListOptions) (watch.Interface, error) { return vaClient.Watch(context.Background(), o) },
+		}, &storagev1.VolumeAttachment{}, 0, cache.Indexers{}),
+		persistentVolumes: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc:  func(o metav1.ListOptions) (runtime.Object, error) { return pvClient.List(context.Background(), o) },
+			WatchFunc: func(o metav1.ListOptions) (watch.Interface, error) { return pvClient.Watch(context.Background(), o) },
+		}, &corev1.PersistentVolume{}, 0, cache.Indexers{}),
+		csiNodes: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(o metav1.ListOptions) (runtime.Object, error) { return csiNodeClient.List(context.Background(), o) },
+			WatchFunc: func(o metav1.ListOptions) (watch.Interface, error) {
+				return csiNodeClient.Watch(context.Background(), o)
+			},
+		}, &storagev1.CSINode{}, 0, cache.Indexers{}),
+	}
+}
+
+// start runs the informers until stopCh is closed, without waiting for them to sync
+func (c *kubeObjectCache) start(stopCh <-chan struct{}) {
+	go c.volumeAttachments.Run(stopCh)
+	go c.persistentVolumes.Run(stopCh)
+	go c.csiNodes.Run(stopCh)
+}
+
+// hasSynced returns true once the informers listed the objects, the lists are incomplete until then
+func (c *kubeObjectCache) hasSynced() bool {
+	return c.volumeAttachments.HasSynced() && c.persistentVolumes.HasSynced() && c.csiNodes.HasSynced()
+}
+
+// listVolumeAttachments returns the cached VolumeAttachments
+func (c *kubeObjectCache) listVolumeAttachments() []*storagev1.VolumeAttachment {
+	var vas []*storagev1.VolumeAttachment
+	for _, obj := range c.volumeAttachments.GetStore().List() {
+		if va, ok := obj.(*storagev1.VolumeAttachment); ok {
+			vas = append(vas, va)
+		}
+	}
+	return vas
+}
+
+// listPersistentVolumes returns the cached PersistentVolumes
+func (c *kubeObjectCache) listPersistentVolumes() []*corev1.PersistentVolume {
+	var pvs []*corev1.PersistentVolume
+	for _, obj := range c.persistentVolumes.GetStore().List() {
+		if pv, ok := obj.(*corev1.PersistentVolume); ok {
+			pvs = append(pvs, pv)
+		}
+	}
+	return pvs
+}
+
+// listCSINodes returns the cached CSINodes
+func (c *kubeObjectCache) listCSINodes() []*storagev1.CSINode {
+	var csiNodes []*storagev1.CSINode
+	for _, obj := range c.csiNodes.GetStore().List() {
+		if csiNode, ok := obj.(*storagev1.CSINode); ok {
+			csiNodes = append(csiNodes, csiNode)
+		}
+	}
+	return csiNodes
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// setKubeClient sets the kubernetes client of the driver and waits for the controller object cache to sync
+func setKubeClient(t *testing.T, icDriver *IBMCSIDriver, clientset kubernetes.Interface) {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	icDriver.SetKubeClient(clientset, stopCh)
+	if icDriver.cs.kubeCache != nil {
+		assert.True(t, cache.WaitForCacheSync(stopCh, icDriver.cs.kubeCache.hasSynced))
+	}
+}
+
+func TestKubeObjectCache(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-1"}},
+		&storagev1.VolumeAttachment{ObjectMeta: metav1.ObjectMeta{Name: "va-1"}},
+		&storagev1.CSINode{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+	)
+	kubeCache := newKubeObjectCache(clientset)
+	assert.False(t, kubeCache.hasSynced())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	kubeCache.start(stopCh)
+	assert.True(t, cache.WaitForCacheSync(stopCh, kubeCache.hasSynced))
+	assert.Equal(t, 1, len(kubeCache.listPersistentVolumes()))
+	assert.Equal(t, 1, len(kubeCache.listVolumeAttachments()))
+	assert.Equal(t, "node-1", kubeCache.listCSINodes()[0].Name)
+
+	// Changes are watched
+	_, err := clientset.CoreV1().PersistentVolumes().Create(context.Background(), &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-2"}}, metav1.CreateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(kubeCache.listPersistentVolumes()) == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSetKubeClient(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	setKubeClient(t, icDriver, k8sfake.NewSimpleClientset())
+	assert.NotNil(t, icDriver.cs.kubeCache)
+
+	// Node servers do not watch the objects
+	t.Setenv("IS_NODE_SERVER", "true")
+	icDriver = initIBMCSIDriver(t)
+	setKubeClient(t, icDriver, k8sfake.NewSimpleClientset())
+	assert.Nil(t, icDriver.cs.kubeCache)
+	assert.NotNil(t, icDriver.ns.kubeClient)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// maskedValue replaces the value of a sensitive parameter in the logs
+	maskedValue = "********"
+
+	// maxLoggedParameters max entries of a parameters map logged, the remaining ones are summarized
+	maxLoggedParameters = 32
+
+	// secretsField name of the CSI request field holding the secrets, all its values are redacted
+	secretsField = "secrets"
+)
+
+// getSensitiveParameterKeys returns the lower cased parameter keys redacted in the logs, encryptionKey
+// and the comma separated keys set in SENSITIVE_PARAMETER_KEYS
+func getSensitiveParameterKeys() map[string]bool {
+	keys := map[string]bool{strings.ToLower(EncryptionKey): true}
+	for _, key := range strings.Split(os.Getenv("SENSITIVE_PARAMETER_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[strings.ToLower(key)] = true
+		}
+	}
+	return keys
+}
+
+// sanitizeParameters returns a copy of the parameters for logging with the sensitive values redacted,
+// maps larger than maxLoggedParameters are truncated in key order
+func sanitizeParameters(params map[string]string, sensitiveKeys map[string]bool) map[string]string {
+	if params == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sanitized := make(map[string]string, len(params))
+	for i, key := range keys {
+		if i == maxLoggedParameters {
+			sanitized["..."] = fmt.Sprintf("%d more", len(keys)-maxLoggedParameters)
+			break
+		}
+		if sensitiveKeys[strings.ToLower(key)] {
+			sanitized[key] = maskedValue
+			continue
+		}
+		sanitized[key] = params[key]
+	}
+	return sanitized
+}
+
+// sanitizeRequest returns a copy of the CSI request for logging with the sensitive values of its
+// parameters, volume context and secrets redacted and large maps truncated
+func sanitizeRequest(req proto.Message) proto.Message {
+	if req == nil {
+		return nil
+	}
+	sanitized := proto.Clone(req)
+	msg := sanitized.ProtoReflect()
+	if !msg.IsValid() {
+		return sanitized
+	}
+	sensitiveKeys := getSensitiveParameterKeys()
+
+	var stringMaps []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fd.IsMap() && fd.MapKey().Kind() == protoreflect.StringKind && fd.MapValue().Kind() == protoreflect.StringKind {
+			stringMaps = append(stringMaps, fd)
+		}
+		return true
+	})
+	for _, fd := range stringMaps {
+		params := map[string]string{}
+		msg.Get(fd).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			params[k.String()] = v.String()
+			return true
+		})
+		keys := sensitiveKeys
+		if fd.Name() == secretsField {
+			keys = map[string]bool{}
+			for key := range params {
+				keys[strings.ToLower(key)] = true
+			}
+		}
+		sanitizedMap := msg.NewField(fd).Map()
+		for key, value := range sanitizeParameters(params, keys) {
+			sanitizedMap.Set(protoreflect.ValueOfString(key).MapKey(), protoreflect.ValueOfString(value))
+		}
+		msg.Set(fd, protoreflect.ValueOfMap(sanitizedMap))
+	}
+	return sanitized
+}
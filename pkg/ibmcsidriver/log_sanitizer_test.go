@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/context"
+)
+
+func TestSanitizeRequest(t *testing.T) {
+	t.Setenv("SENSITIVE_PARAMETER_KEYS", "customTag")
+	encryptionKeyCRN := "crn:v1:bluemix:public:kms:us-south:a/abc:key:secret-root-key"
+	req := &csi.CreateVolumeRequest{
+		Name: "test-volume",
+		Parameters: map[string]string{
+			Profile:       "general-purpose",
+			EncryptionKey: encryptionKeyCRN,
+			"customTag":   "team:secret-team",
+		},
+		Secrets: map[string]string{"iam_api_key": "secret-api-key"},
+	}
+
+	buf := &bytes.Buffer{}
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.InfoLevel))
+	logger.Info("CSIControllerServer-CreateVolume... ", zap.Reflect("Request", sanitizeRequest(req)))
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"profile":"general-purpose"`)
+	assert.Contains(t, logs, `"encryptionKey":"********"`)
+	assert.Contains(t, logs, `"customTag":"********"`)
+	assert.Contains(t, logs, `"iam_api_key":"********"`)
+	assert.NotContains(t, logs, "secret-")
+
+	// Request itself is not modified
+	assert.Equal(t, encryptionKeyCRN, req.Parameters[EncryptionKey])
+	assert.Equal(t, "secret-api-key", req.Secrets["iam_api_key"])
+}
+
+func TestSanitizeParameters(t *testing.T) {
+	assert.Nil(t, sanitizeParameters(nil, nil))
+
+	params := map[string]string{}
+	for i := 0; i < maxLoggedParameters+5; i++ {
+		params[fmt.Sprintf("key%03d", i)] = "value"
+	}
+	sanitized := sanitizeParameters(params, map[string]bool{"key000": true})
+	assert.Equal(t, maxLoggedParameters+1, len(sanitized))
+	assert.Equal(t, maskedValue, sanitized["key000"])
+	assert.Equal(t, "value", sanitized["key001"])
+	assert.Equal(t, "5 more", sanitized["..."])
+}
+
+func TestControllerRequestLogsSanitized(t *testing.T) {
+	icDriver := initIBMCSIDriver(t)
+	secrets := map[string]string{"iam_api_key": "secret-api-key"}
+	params := map[string]string{Profile: "general-purpose", EncryptionKey: "crn:v1:bluemix:public:kms:us-south:a/abc:key:secret-root-key"}
+
+	output := captureStdout(t, func() {
+		_, _ = icDriver.cs.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId: "vol123", VolumeCapabilities: stdVolCap, Secrets: secrets, Parameters: params,
+		})
+		_, _ = icDriver.cs.GetCapacity(context.Background(), &csi.GetCapacityRequest{Parameters: params})
+	})
+	assert.Contains(t, output, "CSIControllerServer-ValidateVolumeCapabilities")
+	assert.Contains(t, output, "CSIControllerServer-GetCapacity")
+	assert.NotContains(t, output, "secret-")
+}
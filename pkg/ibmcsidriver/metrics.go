@@ -0,0 +1,165 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace namespace of the metrics exposed by the driver
+const metricsNamespace = "ibm_vpc_block_csi_driver"
+
+var (
+	/**** Metrics related to node ****/
+	orphanedStagingMounts = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "orphaned_staging_mounts",
+			Help:      "Number of staging mounts found on the node without a VolumeAttachment.",
+		},
+	)
+	fsResizesInflight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "fs_resizes_inflight",
+			Help:      "Number of NodeExpandVolume file system resizes being processed.",
+		},
+	)
+	fsResizesQueued = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "fs_resizes_queued",
+			Help:      "Number of NodeExpandVolume file system resizes waiting for a free slot.",
+		},
+	)
+
+	mountedVolumeFilesystems = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "mounted_volume_filesystems",
+			Help:      "Number of mounted volumes of the node by file system type, as reported by NodeGetVolumeStats.",
+		},
+		[]string{"fstype"},
+	)
+
+	/**** Metrics related to controller ****/
+	snapshotOperationsInflight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "snapshot_operations_inflight",
+			Help:      "Number of CreateSnapshot/DeleteSnapshot operations being processed.",
+		},
+	)
+	providerSessionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "provider_session_failures_total",
+			Help:      "Number of failures to open a VPC provider session e.g IAM token generation failures, by reason code.",
+		},
+		[]string{"reason"},
+	)
+	providerTokenExpiry = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "provider_token_expiry_seconds",
+			Help:      "Seconds until the IAM access token of the last opened VPC provider session expires.",
+		},
+	)
+	snapshotOperationsQueued = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "snapshot_operations_queued",
+			Help:      "Number of CreateSnapshot/DeleteSnapshot operations waiting for a free slot.",
+		},
+	)
+	createVolumeAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "create_volume_attempts_total",
+			Help:      "Number of CreateVolume calls by storage class, the classes not listed in METRICS_STORAGE_CLASSES are reported as other.",
+		},
+		[]string{"storage_class"},
+	)
+	createVolumeResults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "create_volume_results_total",
+			Help:      "Number of completed CreateVolume calls by storage class and result, success or failure.",
+		},
+		[]string{"storage_class", "result"},
+	)
+	volumeExpansionsInflight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "volume_expansions_inflight",
+			Help:      "Number of ControllerExpandVolume backend expansions being processed.",
+		},
+	)
+	volumeExpansionsQueued = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "volume_expansions_queued",
+			Help:      "Number of ControllerExpandVolume backend expansions waiting for a free slot.",
+		},
+	)
+	vpcAPIRateLimiterSaturation = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vpc_api_rate_limiter_saturation",
+			Help:      "Share of the VPC API rate limiter burst in use, 1 when the VPC API calls wait for the rate limiter.",
+		},
+	)
+)
+
+// RegisterMetrics registers all the driver metrics
+func RegisterMetrics() {
+	prometheus.MustRegister(orphanedStagingMounts, fsResizesInflight, fsResizesQueued, providerSessionFailures, providerTokenExpiry, snapshotOperationsInflight, snapshotOperationsQueued, createVolumeAttempts, createVolumeResults, volumeExpansionsInflight, volumeExpansionsQueued, mountedVolumeFilesystems, vpcAPIRateLimiterSaturation)
+}
+
+// updateOrphanedStagingMounts records number of orphaned staging mounts found on the node
+func updateOrphanedStagingMounts(count int) {
+	orphanedStagingMounts.Set(float64(count))
+}
+
+// getStorageClassMetricLabel returns the storage class as metric label, the classes which are not listed in the
+// comma separated METRICS_STORAGE_CLASSES are reported as "other" to bound the cardinality
+func getStorageClassMetricLabel(storageClass string) string {
+	for _, known := range strings.Split(os.Getenv("METRICS_STORAGE_CLASSES"), ",") {
+		if known = strings.TrimSpace(known); len(known) != 0 && known == storageClass {
+			return storageClass
+		}
+	}
+	return "other"
+}
+
+// recordCreateVolumeAttempt counts a CreateVolume call for the storage class
+func recordCreateVolumeAttempt(storageClass string) {
+	createVolumeAttempts.WithLabelValues(getStorageClassMetricLabel(storageClass)).Inc()
+}
+
+// recordCreateVolumeResult counts the result of a CreateVolume call for the storage class
+func recordCreateVolumeResult(storageClass string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	createVolumeResults.WithLabelValues(getStorageClassMetricLabel(storageClass), result).Inc()
+}
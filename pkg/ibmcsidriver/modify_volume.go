@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-vpc/common/vpcclient/models"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// volumeModifier changes the IOPS and the throughput of a volume, zero keeps the current value
+type volumeModifier interface {
+	modifyVolume(ctx context.Context, session provider.Session, volumeID string, iops int64, bandwidth int32) error
+}
+
+// vpcVolumeModifier patches the volume through the VPC API client of the provider session. The provider UpdateVolume
+// only sends the user tags, so the IOPS and the throughput are changed this way.
+type vpcVolumeModifier struct{}
+
+// modifyVolume patches the IOPS and the throughput of the volume, the volume is not patched if they are unchanged
+func (m *vpcVolumeModifier) modifyVolume(ctx context.Context, session provider.Session, volumeID string, iops int64, bandwidth int32) error {
+	vpcSession, ok := getVPCSession(session)
+	if !ok || vpcSession.Apiclient == nil {
+		return fmt.Errorf("no VPC API client in the provider session")
+	}
+	existVolume, etag, err := vpcSession.Apiclient.VolumeService().GetVolumeEtag(volumeID, vpcSession.Logger)
+	if err != nil {
+		return err
+	}
+	template := &models.Volume{}
+	if iops != 0 && iops != existVolume.Iops {
+		template.Iops = iops
+	}
+	if bandwidth != 0 && bandwidth != existVolume.Bandwidth {
+		template.Bandwidth = bandwidth
+	}
+	if template.Iops == 0 && template.Bandwidth == 0 {
+		vpcSession.Logger.Info("Volume IOPS and throughput are unchanged, skipping the volume update", zap.String("VolumeID", volumeID))
+		return nil
+	}
+	return vpcSession.Apiclient.VolumeService().UpdateVolumeWithEtag(volumeID, etag, template, vpcSession.Logger)
+}
+
+// getModifyVolumeParameters returns the IOPS and the throughput of the ControllerModifyVolume mutable parameters,
+// zero if not requested. The IOPS are validated against the range of the volume profile, the throughput can only
+// be set for the sdp profile.
+func getModifyVolumeParameters(params map[string]string, profileName string) (iops int64, bandwidth int32, err error) {
+	for key, value := range params {
+		switch key {
+		case IOPS:
+			if _, ok := profileIopsRanges[profileName]; !ok {
+				return 0, 0, fmt.Errorf("'%s' can only be modified for the %s and %s profiles, the volume profile is %s", IOPS, CustomProfile, SDPProfile, profileName)
+			}
+			if err = validateProfileIops(profileName, &value); err != nil {
+				return 0, 0, err
+			}
+			iops, _ = strconv.ParseInt(value, 10, 64)
+		case Throughput:
+			if profileName != SDPProfile {
+				return 0, 0, fmt.Errorf("'%s' can only be modified for the %s profile, the volume profile is %s", Throughput, SDPProfile, profileName)
+			}
+			throughput, errParse := strconv.ParseInt(value, 10, 32)
+			if errParse != nil || throughput <= 0 {
+				return 0, 0, fmt.Errorf("'<%v>' is invalid, value of '%s' should be a positive int32 type", value, key)
+			}
+			bandwidth = int32(throughput)
+		default:
+			return 0, 0, fmt.Errorf("'%s' cannot be modified, only %s and %s are mutable", key, IOPS, Throughput)
+		}
+	}
+	return iops, bandwidth, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	"github.com/IBM/ibmcloud-volume-vpc/common/vpcclient/riaas"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeVolumeModifier records the volume modifications
+type fakeVolumeModifier struct {
+	calls     int
+	volumeID  string
+	iops      int64
+	bandwidth int32
+	err       error
+}
+
+func (f *fakeVolumeModifier) modifyVolume(ctx context.Context, session provider.Session, volumeID string, iops int64, bandwidth int32) error {
+	f.calls++
+	f.volumeID = volumeID
+	f.iops = iops
+	f.bandwidth = bandwidth
+	return f.err
+}
+
+func TestVPCVolumeModifier(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	var patched map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/volumes/vol-id"))
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Etag", "etag-1")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "vol-id", "iops": 3000, "bandwidth": 1000})
+		case http.MethodPatch:
+			assert.Equal(t, "etag-1", r.Header.Get("If-Match"))
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&patched))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "vol-id"})
+		}
+	}))
+	defer server.Close()
+
+	client, err := riaas.New(riaas.Config{BaseURL: server.URL, HTTPClient: server.Client()})
+	assert.Nil(t, err)
+	_ = client.Login("test-token")
+	session := &vpcprovider.VPCSession{Apiclient: client, Logger: logger}
+	modifier := &vpcVolumeModifier{}
+
+	err = modifier.modifyVolume(context.Background(), session, "vol-id", 5000, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"iops": float64(5000)}, patched)
+
+	// Unchanged IOPS and throughput, the volume is not patched
+	patched = nil
+	err = modifier.modifyVolume(context.Background(), &rateLimitedSession{Session: session}, "vol-id", 3000, 1000)
+	assert.Nil(t, err)
+	assert.Nil(t, patched)
+
+	err = modifier.modifyVolume(context.Background(), &fake.FakeSession{}, "vol-id", 5000, 0)
+	assert.ErrorContains(t, err, "no VPC API client")
+}
+
+func TestGetModifyVolumeParameters(t *testing.T) {
+	testCases := []struct {
+		name         string
+		params       map[string]string
+		profile      string
+		expIops      int64
+		expBandwidth int32
+		expErr       bool
+	}{
+		{name: "Custom IOPS", params: map[string]string{IOPS: "4000"}, profile: CustomProfile, expIops: 4000},
+		{name: "SDP IOPS and throughput", params: map[string]string{IOPS: "6000", Throughput: "1000"}, profile: SDPProfile, expIops: 6000, expBandwidth: 1000},
+		{name: "IOPS out of the profile range", params: map[string]string{IOPS: "50"}, profile: CustomProfile, expErr: true},
+		{name: "IOPS of a tiered profile", params: map[string]string{IOPS: "4000"}, profile: "10iops-tier", expErr: true},
+		{name: "Throughput of a custom profile", params: map[string]string{Throughput: "1000"}, profile: CustomProfile, expErr: true},
+		{name: "Invalid throughput", params: map[string]string{Throughput: "fast"}, profile: SDPProfile, expErr: true},
+		{name: "Unsupported parameter", params: map[string]string{"profile": "sdp"}, profile: CustomProfile, expErr: true},
+		{name: "No parameters", params: nil, profile: CustomProfile},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			iops, bandwidth, err := getModifyVolumeParameters(tc.params, tc.profile)
+			if tc.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expIops, iops)
+			assert.Equal(t, tc.expBandwidth, bandwidth)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// devMapperPath is the directory of the device mapper devices
+var devMapperPath = "/dev/mapper"
+
+// multipathUUIDPrefix prefix of the device mapper uuid of the multipath devices
+const multipathUUIDPrefix = "mpath-"
+
+// getMultipathDevice returns the /dev/mapper path of the multipath device holding the device, false if the device
+// is not a path of a multipath device. The holders of the device are listed in /sys/block/<device>/holders.
+func getMultipathDevice(devicePath string) (string, bool) {
+	device, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", false
+	}
+	holders, err := os.ReadDir(filepath.Join(sysBlockPath, filepath.Base(device), "holders"))
+	if err != nil {
+		return "", false
+	}
+	for _, holder := range holders {
+		dmDir := filepath.Join(sysBlockPath, holder.Name(), "dm")
+		uuid, err := os.ReadFile(filepath.Join(dmDir, "uuid")) // #nosec G304: path is derived from the attached device name.
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(uuid)), multipathUUIDPrefix) {
+			continue
+		}
+		name, err := os.ReadFile(filepath.Join(dmDir, "name")) // #nosec G304: path is derived from the attached device name.
+		if err != nil || len(strings.TrimSpace(string(name))) == 0 {
+			continue
+		}
+		return filepath.Join(devMapperPath, strings.TrimSpace(string(name))), true
+	}
+	return "", false
+}
+
+// resolveMultipathDevice returns the multipath device holding the device so the volume is mounted with all
+// its paths, the device itself if it is not part of a multipath device, the multipath device is not found
+// or DEVICE_MULTIPATH is false
+func (csiNS *CSINodeServer) resolveMultipathDevice(ctxLogger *zap.Logger, devicePath string) string {
+	if os.Getenv("DEVICE_MULTIPATH") == "false" {
+		return devicePath
+	}
+	multipathDevice, found := getMultipathDevice(devicePath)
+	if !found {
+		return devicePath
+	}
+	if exists, err := csiNS.Mounter.PathExists(multipathDevice); err != nil || !exists {
+		ctxLogger.Warn("Multipath device not found, using the device path", zap.String("DevicePath", devicePath), zap.String("MultipathDevice", multipathDevice), zap.Error(err))
+		return devicePath
+	}
+	ctxLogger.Info("Device is a path of a multipath device, using the multipath device", zap.String("DevicePath", devicePath), zap.String("MultipathDevice", multipathDevice))
+	return multipathDevice
+}
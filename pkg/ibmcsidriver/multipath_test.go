@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeMultipathTopology creates the device link /dev/disk/by-id/<link> to the device, and the device mapper
+// holder of the device in sysfs with its uuid and name. It returns the device link.
+func fakeMultipathTopology(t *testing.T, devDir string, device string, link string, holder string, uuid string, name string) string {
+	devicePath := filepath.Join(devDir, device)
+	assert.Nil(t, os.WriteFile(devicePath, nil, 0600))
+	linkPath := filepath.Join(devDir, "disk", "by-id", link)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(linkPath), 0750))
+	assert.Nil(t, os.Symlink(devicePath, linkPath))
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(sysBlockPath, device, "holders", holder), 0750))
+	dmDir := filepath.Join(sysBlockPath, holder, "dm")
+	assert.Nil(t, os.MkdirAll(dmDir, 0750))
+	assert.Nil(t, os.WriteFile(filepath.Join(dmDir, "uuid"), []byte(uuid+"\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dmDir, "name"), []byte(name+"\n"), 0600))
+	return linkPath
+}
+
+func TestGetMultipathDevice(t *testing.T) {
+	oldSysBlockPath, oldDevMapperPath := sysBlockPath, devMapperPath
+	sysBlockPath, devMapperPath = t.TempDir(), "/dev/mapper"
+	defer func() { sysBlockPath, devMapperPath = oldSysBlockPath, oldDevMapperPath }()
+	devDir := t.TempDir()
+
+	multipathLink := fakeMultipathTopology(t, devDir, "sdb", "virtio-mpath", "dm-0", "mpath-3600a098038303053", "mpatha")
+	device, found := getMultipathDevice(multipathLink)
+	assert.True(t, found)
+	assert.Equal(t, "/dev/mapper/mpatha", device)
+
+	// device mapper holder which is not a multipath device e.g LVM
+	lvmLink := fakeMultipathTopology(t, devDir, "sdc", "virtio-lvm", "dm-1", "LVM-Ux3k9", "vg-data")
+	_, found = getMultipathDevice(lvmLink)
+	assert.False(t, found)
+
+	// device without holders
+	plainDevice := filepath.Join(devDir, "vdd")
+	assert.Nil(t, os.WriteFile(plainDevice, nil, 0600))
+	_, found = getMultipathDevice(plainDevice)
+	assert.False(t, found)
+
+	// device not found
+	_, found = getMultipathDevice(filepath.Join(devDir, "missing"))
+	assert.False(t, found)
+}
+
+func TestFindDevicePathSourceMultipath(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	oldSysBlockPath, oldDevMapperPath := sysBlockPath, devMapperPath
+	sysBlockPath, devMapperPath = t.TempDir(), t.TempDir()
+	defer func() { sysBlockPath, devMapperPath = oldSysBlockPath, oldDevMapperPath }()
+	devicePath := fakeMultipathTopology(t, t.TempDir(), "sdb", "virtio-vol", "dm-0", "mpath-3600a098038303053", "mpatha")
+	multipathDevice := filepath.Join(devMapperPath, "mpatha")
+
+	icDriver := initIBMCSIDriver(t)
+	icDriver.ns.Mounter = &pathExistsMounter{Mounter: icDriver.ns.Mounter, pathExists: func(pathname string) (bool, error) {
+		_, err := os.Stat(pathname)
+		return err == nil, nil
+	}}
+
+	// multipath device not created yet, the device itself is used
+	source, err := icDriver.ns.findDevicePathSource(context.Background(), logger, devicePath, "")
+	assert.Nil(t, err)
+	assert.Equal(t, devicePath, source)
+
+	assert.Nil(t, os.WriteFile(multipathDevice, nil, 0600))
+	source, err = icDriver.ns.findDevicePathSource(context.Background(), logger, devicePath, "")
+	assert.Nil(t, err)
+	assert.Equal(t, multipathDevice, source)
+
+	// multipath detection disabled
+	t.Setenv("DEVICE_MULTIPATH", "false")
+	source, err = icDriver.ns.findDevicePathSource(context.Background(), logger, devicePath, "")
+	assert.Nil(t, err)
+	assert.Equal(t, devicePath, source)
+}
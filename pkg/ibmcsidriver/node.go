@@ -41,6 +41,7 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"golang.org/x/sys/unix"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/pkg/volume/util/fs"
 	mount "k8s.io/mount-utils"
 )
@@ -51,6 +52,22 @@ type CSINodeServer struct {
 	Mounter  mountmanager.Mounter
 	Metadata nodeMetadata.NodeMetadata
 	Stats    StatsUtils
+	// defaultMountOptions configured default mount options per file system type
+	defaultMountOptions map[string][]string
+	// mountOptionsAllowlist mount options users are allowed to set per file system type
+	mountOptionsAllowlist map[string][]string
+	// volumeLocks serializes the file system resizes of a volume
+	volumeLocks utils.LockStore
+	// resizeLimiter limits the concurrent file system resizes of the node
+	resizeLimiter *operationLimiter
+	// deviceHealth reports the volume condition from the device I/O error counters
+	deviceHealth *deviceHealthProbe
+	// filesystems file system type of the mounted volumes
+	filesystems *filesystemTracker
+	// stagedAccessTypes block (true) or mount (false) access type the volumes are staged with
+	stagedAccessTypes map[string]bool
+	// kubeClient used to get the instance profile of the node for its attach limit
+	kubeClient kubernetes.Interface
 	// TODO: Only lock mutually exclusive calls and make locking more fine grained
 	mux sync.Mutex
 	csi.UnimplementedNodeServer
@@ -96,7 +113,7 @@ const (
 	// FSTypeXfs represents te xfs filesystem type
 	FSTypeXfs = "xfs"
 
-	// default file system type to be used when it is not provided
+	// default file system type to be used when it is not provided, DEFAULT_FS_TYPE if set is recorded by the controller
 	defaultFsType = FSTypeExt4
 )
 
@@ -106,8 +123,11 @@ var _ csi.NodeServer = &CSINodeServer{}
 func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	publishContext := req.GetPublishContext()
 	controlleRequestID := publishContext[PublishInfoRequestID]
-	ctxLogger, requestID := utils.GetContextLoggerWithRequestID(ctx, false, &controlleRequestID)
-	ctxLogger.Info("CSINodeServer-NodePublishVolume...", zap.Reflect("Request", req))
+	ctxLogger, requestID := getContextLogger(ctx)
+	if controlleRequestID != "" {
+		ctxLogger, requestID = utils.GetContextLoggerWithRequestID(ctx, false, &controlleRequestID)
+	}
+	ctxLogger.Info("CSINodeServer-NodePublishVolume...", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "NodePublishVolume", time.Now())
 	csiNS.mux.Lock()
 	defer csiNS.mux.Unlock()
@@ -127,6 +147,11 @@ func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.Node
 		return nil, commonError.GetCSIError(ctxLogger, commonError.NoTargetPath, requestID, nil)
 	}
 
+	if err := validateTargetPath(target); err != nil {
+		ctxLogger.Error("Refusing to publish the volume on a suspicious target path", zap.String("targetPath", target), zap.Error(err))
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target path %s: %v", target, err)
+	}
+
 	volumeCapability := req.GetVolumeCapability()
 	if volumeCapability == nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.NoVolumeCapabilities, requestID, nil)
@@ -138,6 +163,11 @@ func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.Node
 		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeCapabilitiesNotSupported, requestID, nil)
 	}
 
+	if err := csiNS.validateAccessType(volumeID, volumeCapability.GetBlock() != nil); err != nil {
+		ctxLogger.Error("Volume capability does not match the staged volume", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	// Check if targetPath is already mounted. If it already moounted return OK
 	notMounted, err := csiNS.Mounter.IsLikelyNotMountPoint(target)
 	if err != nil && !os.IsNotExist(err) {
@@ -161,6 +191,10 @@ func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.Node
 	if readOnly {
 		options = append(options, "ro")
 	}
+	if mnt := volumeCapability.GetMount(); mnt != nil {
+		// readonly of the request takes precedence over the volume mount options
+		options = mergeMountOptions(options, mnt.MountFlags, splitMountOptions(req.GetVolumeContext()[MountOptions]))
+	}
 	fsType := "" // Let the fsType be derived from global mount(NodeStageVolume)
 
 	var nodePublishResponse *csi.NodePublishVolumeResponse
@@ -168,7 +202,7 @@ func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.Node
 
 	switch volumeCapability.GetAccessType().(type) {
 	case *csi.VolumeCapability_Block:
-		nodePublishResponse, mountErr = csiNS.processMountForBlock(ctxLogger, requestID, publishContext[PublishInfoDevicePath], target, volumeID, options)
+		nodePublishResponse, mountErr = csiNS.processMountForBlock(ctx, ctxLogger, requestID, publishContext[PublishInfoDevicePath], target, volumeID, options)
 
 	case *csi.VolumeCapability_Mount:
 		nodePublishResponse, mountErr = csiNS.processMount(ctxLogger, requestID, source, target, fsType, options)
@@ -180,7 +214,7 @@ func (csiNS *CSINodeServer) NodePublishVolume(ctx context.Context, req *csi.Node
 
 // NodeUnpublishVolume ...
 func (csiNS *CSINodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	ctxLogger.Info("CSINodeServer-NodeUnpublishVolume...", zap.Reflect("Request", req))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "NodeUnpublishVolume", time.Now())
 	csiNS.mux.Lock()
@@ -196,7 +230,7 @@ func (csiNS *CSINodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.No
 	}
 
 	ctxLogger.Info("Unmounting  target path", zap.String("targetPath", targetPath))
-	err := mount.CleanupMountPoint(targetPath, csiNS.Mounter, false /* bind mount */)
+	err := csiNS.cleanupTargetPath(ctxLogger, targetPath)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.UnmountFailed, requestID, err, targetPath)
 	}
@@ -210,8 +244,11 @@ func (csiNS *CSINodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.No
 func (csiNS *CSINodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	publishContext := req.GetPublishContext()
 	controlleRequestID := publishContext[PublishInfoRequestID]
-	ctxLogger, requestID := utils.GetContextLoggerWithRequestID(ctx, false, &controlleRequestID)
-	ctxLogger.Info("CSINodeServer-NodeStageVolume...", zap.Reflect("Request", req))
+	ctxLogger, requestID := getContextLogger(ctx)
+	if controlleRequestID != "" {
+		ctxLogger, requestID = utils.GetContextLoggerWithRequestID(ctx, false, &controlleRequestID)
+	}
+	ctxLogger.Info("CSINodeServer-NodeStageVolume...", zap.Reflect("Request", sanitizeRequest(req)))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "NodeStageVolume", time.Now())
 
 	csiNS.mux.Lock()
@@ -236,12 +273,18 @@ func (csiNS *CSINodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeSt
 		return nil, commonError.GetCSIError(ctxLogger, commonError.VolumeCapabilitiesNotSupported, requestID, nil)
 	}
 
-	// If the access type is block, do nothing for stage.
-	if volumeCapability != nil {
-		if blk := volumeCapability.GetBlock(); blk != nil {
-			klog.V(4).InfoS("NodeStageVolume: called. Since it is a block device, ignoring...", "volumeID", volumeID)
-			return &csi.NodeStageVolumeResponse{}, nil
-		}
+	isBlock := volumeCapability.GetBlock() != nil
+	if err := csiNS.validateAccessType(volumeID, isBlock); err != nil {
+		ctxLogger.Error("Volume capability does not match the staged volume", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// If the access type is block, do nothing for stage. No file system is created or mounted,
+	// NodePublishVolume bind mounts the raw device of the publish context to the target path.
+	if isBlock {
+		klog.V(4).InfoS("NodeStageVolume: called. Since it is a block device, ignoring...", "volumeID", volumeID)
+		csiNS.recordAccessType(volumeID, true)
+		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
 	// Check devicePath is available in the publish context
@@ -250,8 +293,11 @@ func (csiNS *CSINodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeSt
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyDevicePath, requestID, nil)
 	}
 	// Check source Path
-	source, err := csiNS.findDevicePathSource(ctxLogger, devicePath, volumeID)
+	source, err := csiNS.findDevicePathSource(ctx, ctxLogger, devicePath, volumeID)
 	if err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.DevicePathFindFailed, requestID, nil, devicePath)
 	}
 	ctxLogger.Info("Found device path ", zap.String("devicePath", devicePath), zap.String("source", source))
@@ -282,35 +328,56 @@ func (csiNS *CSINodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeSt
 	target, err := filepath.EvalSymlinks(source)
 	if err == nil && device == target {
 		ctxLogger.Info("volume already staged", zap.String("volumeID", volumeID))
+		csiNS.recordAccessType(volumeID, false)
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
 	mnt := volumeCapability.GetMount()
-	// find  FS type
-	fsType := defaultFsType
-	if mnt.FsType != "" {
-		fsType = mnt.FsType
+	fsType := csiNS.getStageFsType(ctx, ctxLogger, mnt, req.GetVolumeContext(), source)
+	// Only the options set by the user are validated, the driver and configured defaults are trusted
+	userOptions := mergeMountOptions(mnt.MountFlags, splitMountOptions(req.GetVolumeContext()[MountOptions]))
+	if err = validateMountOptions(fsType, csiNS.mountOptionsAllowlist, userOptions); err != nil {
+		ctxLogger.Error("Invalid mount options", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	options := collectMountOptions(fsType, mnt.MountFlags)
+	options := collectMountOptions(fsType, mnt.MountFlags, req.GetVolumeContext(), csiNS.defaultMountOptions[fsType])
 
 	// FormatAndMount will format only if needed
 	ctxLogger.Info("Formating and mounting ", zap.String("source", source), zap.String("stagingTargetPath", stagingTargetPath), zap.String("fsType", fsType), zap.Reflect("options", options))
-	err = csiNS.Mounter.GetSafeFormatAndMount().FormatAndMount(source, stagingTargetPath, fsType, options)
+	err = retryOnDeviceBusy(ctx, ctxLogger, func() error {
+		return csiNS.formatAndMount(ctx, source, stagingTargetPath, fsType, options)
+	})
 	if err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			ctxLogger.Error("Format and mount aborted", zap.Error(err))
+			return nil, ctxErr
+		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.FormatAndMountFailed, requestID, err, source, stagingTargetPath)
 	}
 
-	if _, err := csiNS.Mounter.Resize(devicePath, stagingTargetPath); err != nil {
+	if _, err := csiNS.resize(ctx, devicePath, stagingTargetPath); err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			ctxLogger.Error("File system resize aborted", zap.Error(err))
+			return nil, ctxErr
+		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.FileSystemResizeFailed, requestID, err)
 	}
 
+	// I/O scheduler is best effort, volume is usable even if the scheduler could not be set
+	if scheduler := req.GetVolumeContext()[IOScheduler]; len(scheduler) != 0 {
+		if err := applyIOScheduler(ctxLogger, source, scheduler); err != nil {
+			ctxLogger.Warn("Skipping I/O scheduler setting for the volume", zap.String("volumeID", volumeID), zap.String(IOScheduler, scheduler), zap.Error(err))
+		}
+	}
+
+	csiNS.recordAccessType(volumeID, false)
 	nodeStageVolumeResponse := &csi.NodeStageVolumeResponse{}
 	return nodeStageVolumeResponse, err
 }
 
 // NodeUnstageVolume ...
 func (csiNS *CSINodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	ctxLogger.Info("CSINodeServer-NodeUnstageVolume ... ", zap.Reflect("Request", req))
 	defer metrics.UpdateDurationFromStart(ctxLogger, "NodeUnstageVolume", time.Now())
 	csiNS.mux.Lock()
@@ -333,13 +400,16 @@ func (csiNS *CSINodeServer) NodeUnstageVolume(ctx context.Context, req *csi.Node
 	}
 
 	ctxLogger.Info("Successfully Unmounted staging target path", zap.String("stagingTargetPath", stagingTargetPath))
+	csiNS.deviceHealth.forget(volumeID)
+	csiNS.filesystems.forget(volumeID)
+	delete(csiNS.stagedAccessTypes, volumeID)
 	nodeUnstageVolumeResponse := &csi.NodeUnstageVolumeResponse{}
 	return nodeUnstageVolumeResponse, err
 }
 
 // NodeGetCapabilities ...
 func (csiNS *CSINodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
-	ctxLogger, _ := utils.GetContextLogger(ctx, false)
+	ctxLogger, _ := getContextLogger(ctx)
 	ctxLogger.Info("CSINodeServer-NodeGetCapabilities... ", zap.Reflect("Request", req))
 
 	return &csi.NodeGetCapabilitiesResponse{
@@ -349,7 +419,7 @@ func (csiNS *CSINodeServer) NodeGetCapabilities(ctx context.Context, req *csi.No
 
 // NodeGetInfo ...
 func (csiNS *CSINodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
+	ctxLogger, requestID := getContextLogger(ctx)
 	ctxLogger.Info("CSINodeServer-NodeGetInfo... ", zap.Reflect("Request", req))
 
 	// maxVolumesPerNode is the maximum number of volumes attachable to a node
@@ -377,6 +447,15 @@ func (csiNS *CSINodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInf
 		},
 	}
 
+	// Instance profile of the node, if known, for the attach limit and the profile family topology
+	profile := csiNS.getInstanceProfile(ctx, ctxLogger, nodeName)
+	if family := getInstanceProfileFamily(profile); len(family) != 0 {
+		top.Segments[InstanceProfileFamilyLabel] = family
+	}
+	if profileLimit := getInstanceProfileVolumeLimit(ctxLogger, profile); profileLimit > 0 {
+		maxVolumesPerNode = profileLimit
+	}
+
 	// If environment variable is set, use this value as maxVolumesPerNode
 	value, ok := os.LookupEnv("VOLUME_ATTACHMENT_LIMIT")
 	if !ok {
@@ -404,8 +483,9 @@ func (csiNS *CSINodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInf
 // NodeGetVolumeStats ...
 func (csiNS *CSINodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
 	var resp *csi.NodeGetVolumeStatsResponse
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
-	ctxLogger.Info("CSINodeServer-NodeGetVolumeStats... ", zap.Reflect("Request", req)) //nolint:staticcheck
+	ctxLogger, requestID := getContextLogger(ctx)
+	// Polled by kubelet for every volume, not logged at info level
+	ctxLogger.Debug("CSINodeServer-NodeGetVolumeStats... ", zap.Reflect("Request", req)) //nolint:staticcheck
 	defer metrics.UpdateDurationFromStart(ctxLogger, "NodeGetVolumeStats", time.Now())
 	if req == nil || req.VolumeId == "" { //nolint:staticcheck
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyVolumeID, requestID, nil)
@@ -440,6 +520,7 @@ func (csiNS *CSINodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.Nod
 					Unit:  csi.VolumeUsage_BYTES,
 				},
 			},
+			VolumeCondition: csiNS.getVolumeCondition(ctxLogger, req.VolumeId, volumePath, true),
 		}
 
 		ctxLogger.Info("Response for Volume stats", zap.Reflect("Response", resp))
@@ -449,8 +530,21 @@ func (csiNS *CSINodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.Nod
 	// else get the file system stats
 	available, capacity, usage, inodes, inodesFree, inodesUsed, err := csiNS.Stats.FSInfo(volumePath)
 	if err != nil {
+		// The mount is still there but its file system can not be accessed, report the volume abnormal
+		if isInaccessibleMountError(err) {
+			ctxLogger.Warn("Volume is not accessible", zap.String("VolumeID", req.VolumeId), zap.String("VolumePath", volumePath), zap.Error(err))
+			return &csi.NodeGetVolumeStatsResponse{
+				VolumeCondition: &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("volume path %s is not accessible: %v", volumePath, err)},
+			}, nil
+		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.GetFSInfoFailed, requestID, err)
 	}
+	if fsType, err := filesystemType(volumePath); err != nil {
+		ctxLogger.Warn("Unable to detect the file system type", zap.String("VolumePath", volumePath), zap.Error(err))
+	} else {
+		ctxLogger.Info("Detected file system type", zap.String("VolumeID", req.VolumeId), zap.String("FSType", fsType))
+		csiNS.filesystems.record(req.VolumeId, fsType)
+	}
 	resp = &csi.NodeGetVolumeStatsResponse{
 		Usage: []*csi.VolumeUsage{
 			{
@@ -466,6 +560,7 @@ func (csiNS *CSINodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.Nod
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
+		VolumeCondition: csiNS.getVolumeCondition(ctxLogger, req.VolumeId, volumePath, false),
 	}
 
 	ctxLogger.Info("Response for Volume stats", zap.Reflect("Response", resp))
@@ -474,8 +569,8 @@ func (csiNS *CSINodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.Nod
 
 // NodeExpandVolume ...
 func (csiNS *CSINodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	ctxLogger, requestID := utils.GetContextLogger(ctx, false)
-	ctxLogger.Info("CSINodeServer-NodeExpandVolume", zap.Reflect("Request", req))
+	ctxLogger, requestID := getContextLogger(ctx)
+	ctxLogger.Info("CSINodeServer-NodeExpandVolume", zap.Reflect("Request", sanitizeRequest(req)))
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyVolumeID, requestID, nil)
@@ -530,10 +625,30 @@ func (csiNS *CSINodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeE
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyDevicePath, requestID, err)
 	}
 
-	if _, err := csiNS.Mounter.Resize(devicePath, volumePath); err != nil {
+	// Pre-flight check, the block device must have been expanded before the file system can grow
+	requiredBytes := req.GetCapacityRange().GetRequiredBytes()
+	deviceSize, err := csiNS.Stats.DeviceInfo(devicePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get block device size of %s: %v", devicePath, err)
+	}
+	if deviceSize < requiredBytes {
+		ctxLogger.Warn("Block device is not expanded yet", zap.String("devicePath", devicePath), zap.Int64("deviceSize", deviceSize), zap.Int64("requiredBytes", requiredBytes))
+		return nil, status.Errorf(codes.FailedPrecondition, "block device %s size %d bytes is smaller than the requested %d bytes, the volume expansion is not visible on the node yet", devicePath, deviceSize, requiredBytes)
+	}
+
+	if err := csiNS.acquireResizeSlot(ctx, ctxLogger, volumeID); err != nil {
+		return nil, err
+	}
+	defer csiNS.releaseResizeSlot(volumeID)
+
+	if _, err := csiNS.resize(ctx, devicePath, volumePath); err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			ctxLogger.Error("File system resize aborted", zap.Error(err))
+			return nil, ctxErr
+		}
 		return nil, commonError.GetCSIError(ctxLogger, commonError.FileSystemResizeFailed, requestID, err)
 	}
-	return &csi.NodeExpandVolumeResponse{CapacityBytes: req.CapacityRange.RequiredBytes}, nil
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: requiredBytes}, nil
 }
 
 // IsBlockDevice ...
@@ -575,14 +690,17 @@ func (su *VolumeStatUtils) IsDevicePathNotExist(devicePath string) bool {
 	return false
 }
 
-func collectMountOptions(fsType string, mntFlags []string) []string {
-	var options []string
-	options = append(options, mntFlags...)
-
+// collectMountOptions returns the mount options used to stage the volume, merged in order of precedence
+//  1. mount flags of the volume capability i.e the PV spec.mountOptions (copied from the storage class mountOptions)
+//  2. mountOptions parameter of the storage class passed through the volume context
+//  3. configured default mount options for the file system type, see getDefaultMountOptions
+//  4. driver defaults for the file system type
+func collectMountOptions(fsType string, mntFlags []string, volumeContext map[string]string, fsDefaults []string) []string {
+	var defaults []string
 	// By default, xfs does not allow mounting of two volumes with the same filesystem uuid.
 	// Force ignore this uuid to be able to mount volume + its clone / restored snapshot on the same node.
 	if fsType == "xfs" {
-		options = append(options, "nouuid")
+		defaults = append(defaults, "nouuid")
 	}
-	return options
+	return mergeMountOptions(mntFlags, splitMountOptions(volumeContext[MountOptions]), fsDefaults, defaults)
 }
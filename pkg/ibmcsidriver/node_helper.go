@@ -18,24 +18,72 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	commonError "github.com/IBM/ibm-csi-common/pkg/messages"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
 )
 
+// sysBlockPath is the sysfs directory which exposes the block devices queue settings and holders
+var sysBlockPath = "/sys/block"
+
+// sysClassPath is the sysfs directory which exposes the SCSI hosts and NVMe controllers rescan attributes
+var sysClassPath = "/sys/class"
+
+// deviceRescanSettleTime wait after a bus rescan for udev to create the device nodes
+var deviceRescanSettleTime = 5 * time.Second
+
+// stagingMountsRoot is the kubelet directory under which the CSI staging mounts are created i.e
+// <stagingMountsRoot>/<driver>/<hash>/globalmount with the volume details in <stagingMountsRoot>/<driver>/<hash>/vol_data.json
+var stagingMountsRoot = "/var/lib/kubelet/plugins/kubernetes.io/csi"
+
+// publishTargetDirs kubelet directories, relative to its root directory, under which the publish target paths are created
+// i.e pods/<pod uid>/volumes/kubernetes.io~csi/<pv>/mount or plugins/kubernetes.io/csi/volumeDevices/publish/<pv>/<pod uid>
+var publishTargetDirs = []string{"pods", "plugins/kubernetes.io/csi/volumeDevices/publish"}
+
+const (
+	// stagingMountDir last path element of the staging target path created by kubelet
+	stagingMountDir = "globalmount"
+
+	// volumeDataFile file created by kubelet next to the staging target path
+	volumeDataFile = "vol_data.json"
+)
+
+// stagingMount is the staging mount of a volume found on the node
+type stagingMount struct {
+	VolumeID string
+	Path     string
+	Device   string
+}
+
+// volumeData is the subset of vol_data.json written by kubelet for every staged CSI volume
+type volumeData struct {
+	DriverName   string `json:"driverName"`
+	VolumeHandle string `json:"volumeHandle"`
+}
+
 // findDevicePath finds path of device and verifies its existence
-func (csiNS *CSINodeServer) findDevicePathSource(ctxLogger *zap.Logger, devicePath string, volumeID string /*TODO may be required in future*/) (string, error) {
+func (csiNS *CSINodeServer) findDevicePathSource(ctx context.Context, ctxLogger *zap.Logger, devicePath string, volumeID string /*TODO may be required in future*/) (string, error) {
 	ctxLogger.Info("CSINodeServer-findDevicePathSource...")
 	exists, err := csiNS.Mounter.PathExists(devicePath)
 	if err != nil || !exists {
 		ctxLogger.Warn("Device path not found, trying to fix by udevadm trigger", zap.String("DevicePath", devicePath))
-		if err = csiNS.udevadmTrigger(ctxLogger); err != nil {
+		if err = csiNS.udevadmTrigger(ctx, ctxLogger); err != nil {
 			ctxLogger.Error("Failed to execute udevadm trigger, will try to check device path again", zap.Error(err))
 		}
 		// Re-verifying device path and returning error accordingly
@@ -44,9 +92,24 @@ func (csiNS *CSINodeServer) findDevicePathSource(ctxLogger *zap.Logger, devicePa
 			return "", err
 		}
 	}
+	// Last attempt before giving up, the volume may be attached while the kernel did not detect the device yet
+	if !exists && os.Getenv("DEVICE_RESCAN_ON_TIMEOUT") != "false" {
+		ctxLogger.Warn("Device path still not found, rescanning the SCSI and NVMe buses", zap.String("DevicePath", devicePath))
+		if rescanned := rescanDeviceBuses(ctxLogger); rescanned > 0 {
+			select {
+			case <-time.After(deviceRescanSettleTime):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			exists, err = csiNS.Mounter.PathExists(devicePath)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
 	// If the path exists, assume it is not nvme device
 	if exists {
-		return devicePath, nil
+		return csiNS.resolveMultipathDevice(ctxLogger, devicePath), nil
 	}
 	ctxLogger.Warn("Device Path is nvme. Try to find nvme device")
 	return devicePath, nil
@@ -98,7 +161,7 @@ func (csiNS *CSINodeServer) processMount(ctxLogger *zap.Logger, requestID, stagi
 // The mountType is "bind" mount and will not specify any FORMAT(e.g ext4, ext3..)
 // e.g SOURCE (volume provider attached device on Host): /dev/xvde
 // e.g TARGET (SoftLink to User defined POD device /dev/sda) : "/var/data/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pvc-9b82dced-fcd6-4181-968e-ae269e0f2311"
-func (csiNS *CSINodeServer) processMountForBlock(ctxLogger *zap.Logger, requestID, devicePath, target, volumeID string, options []string) (*csi.NodePublishVolumeResponse, error) {
+func (csiNS *CSINodeServer) processMountForBlock(ctx context.Context, ctxLogger *zap.Logger, requestID, devicePath, target, volumeID string, options []string) (*csi.NodePublishVolumeResponse, error) {
 	ctxLogger.Info("CSINodeServer-processMountForBlock", zap.String("devicePath", devicePath), zap.String("target", target), zap.Reflect("options", options))
 
 	//get devicepath to be used as mountpoint source
@@ -106,7 +169,7 @@ func (csiNS *CSINodeServer) processMountForBlock(ctxLogger *zap.Logger, requestI
 		return nil, commonError.GetCSIError(ctxLogger, commonError.EmptyDevicePath, requestID, nil)
 	}
 	// Check source Path existence
-	source, err := csiNS.findDevicePathSource(ctxLogger, devicePath, volumeID)
+	source, err := csiNS.findDevicePathSource(ctx, ctxLogger, devicePath, volumeID)
 	if err != nil {
 		return nil, commonError.GetCSIError(ctxLogger, commonError.DevicePathFindFailed, requestID, err, devicePath)
 	}
@@ -146,11 +209,69 @@ func (csiNS *CSINodeServer) processMountForBlock(ctxLogger *zap.Logger, requestI
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (csiNS *CSINodeServer) udevadmTrigger(ctxLogger *zap.Logger) error {
+// rescanDeviceBuses asks every SCSI host and NVMe controller of the node to rescan for new devices,
+// it returns the number of buses rescanned
+func rescanDeviceBuses(ctxLogger *zap.Logger) int {
+	rescans := map[string]string{
+		filepath.Join(sysClassPath, "scsi_host", "*", "scan"):         "- - -",
+		filepath.Join(sysClassPath, "nvme", "*", "rescan_controller"): "1",
+	}
+	rescanned := 0
+	for pattern, value := range rescans {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			if err := os.WriteFile(path, []byte(value), 0200); err != nil { // #nosec G306: sysfs attribute, permissions are not used.
+				ctxLogger.Warn("Failed to rescan the bus", zap.String("Path", path), zap.Error(err))
+				continue
+			}
+			rescanned++
+		}
+	}
+	ctxLogger.Info("Rescanned the SCSI and NVMe buses", zap.Int("Buses", rescanned))
+	return rescanned
+}
+
+// getDeviceScanPatterns returns the valid device name glob patterns set in the env variable as comma separated list
+func getDeviceScanPatterns(ctxLogger *zap.Logger, envName string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(os.Getenv(envName), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			ctxLogger.Warn("Ignoring invalid device scan pattern", zap.String(envName, pattern), zap.Error(err))
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// udevadmTriggerArgs returns the udevadm trigger arguments. By default all the devices are refreshed,
+// DEVICE_SCAN_INCLUDE and DEVICE_SCAN_EXCLUDE restrict it to the matching block devices e.g "vd*" and "loop*,ram*"
+func udevadmTriggerArgs(ctxLogger *zap.Logger) []string {
+	args := []string{"trigger"}
+	include := getDeviceScanPatterns(ctxLogger, "DEVICE_SCAN_INCLUDE")
+	exclude := getDeviceScanPatterns(ctxLogger, "DEVICE_SCAN_EXCLUDE")
+	if len(include) == 0 && len(exclude) == 0 {
+		return args
+	}
+	args = append(args, "--subsystem-match=block")
+	for _, pattern := range include {
+		args = append(args, "--sysname-match="+pattern)
+	}
+	for _, pattern := range exclude {
+		args = append(args, "--sysname-nomatch="+pattern)
+	}
+	return args
+}
+
+func (csiNS *CSINodeServer) udevadmTrigger(ctx context.Context, ctxLogger *zap.Logger) error {
 	ctxLogger.Info("CSINodeServer-udevadmTrigger refreshing all devices...")
-	out, err := exec.Command(
-		"udevadm",
-		"trigger").CombinedOutput()
+	args := udevadmTriggerArgs(ctxLogger)
+	ctxLogger.Info("udevadm trigger arguments", zap.Strings("args", args))
+	out, err := exec.CommandContext(ctx, "udevadm", args...).CombinedOutput() // #nosec G204: arguments are device name patterns from the node server configuration.
 	if err != nil {
 		return fmt.Errorf("udevadmTrigger: udevadm trigger failed, output %s, error: %v", string(out), err)
 	}
@@ -160,8 +281,536 @@ func (csiNS *CSINodeServer) udevadmTrigger(ctxLogger *zap.Logger) error {
 	if err != nil {
 		ctxLogger.Warn("udevadmTrigger: time.ParseDuration failed", zap.Error(err))
 	}
-	time.Sleep(duration)
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+		return fmt.Errorf("udevadmTrigger: %v", ctx.Err())
+	}
 
 	ctxLogger.Info("udevadmTrigger: Successfully executed udevadm trigger to referesh all devices.")
 	return nil
 }
+
+// contextExec runs all the commands with the RPC context, so that the command is killed
+// as soon as kubelet cancels the RPC or its deadline exceeds
+type contextExec struct {
+	ctx context.Context
+	utilexec.Interface
+}
+
+// Command ...
+func (e *contextExec) Command(cmd string, args ...string) utilexec.Cmd {
+	return e.Interface.CommandContext(e.ctx, cmd, args...)
+}
+
+// formatAndMount formats the device if needed and mounts it, mkfs/fsck are killed if ctx is cancelled
+func (csiNS *CSINodeServer) formatAndMount(ctx context.Context, source, target, fsType string, options []string) error {
+	safeMounter := csiNS.Mounter.GetSafeFormatAndMount()
+	ctxMounter := &mount.SafeFormatAndMount{Interface: safeMounter.Interface, Exec: &contextExec{ctx: ctx, Interface: safeMounter.Exec}}
+	return ctxMounter.FormatAndMount(source, target, fsType, options)
+}
+
+// getStageFsType returns the file system type to stage the volume with: the one of the volume capability, else the
+// existing file system of the device, else the one the controller recorded in the volume context, ext4 otherwise.
+// DEFAULT_FS_TYPE is applied by the controller only, so that changing it does not affect the provisioned volumes.
+func (csiNS *CSINodeServer) getStageFsType(ctx context.Context, ctxLogger *zap.Logger, mnt *csi.VolumeCapability_MountVolume, volumeContext map[string]string, source string) string {
+	if mnt.GetFsType() != "" {
+		return mnt.GetFsType()
+	}
+	safeMounter := csiNS.Mounter.GetSafeFormatAndMount()
+	ctxMounter := &mount.SafeFormatAndMount{Interface: safeMounter.Interface, Exec: &contextExec{ctx: ctx, Interface: safeMounter.Exec}}
+	existing, err := ctxMounter.GetDiskFormat(source)
+	if err != nil {
+		ctxLogger.Warn("Unable to get the existing file system of the device", zap.String("source", source), zap.Error(err))
+	} else if isSupportedFS(existing) {
+		return existing
+	}
+	if fsType := volumeContext[FsType]; fsType != "" {
+		return fsType
+	}
+	return defaultFsType
+}
+
+// deviceBusyRetryInitialBackoff is the wait after the first device busy failure, doubled after every further failure
+var deviceBusyRetryInitialBackoff = time.Second
+
+// defaultDeviceBusyRetries number of retries of a device busy format and mount if NODE_STAGE_BUSY_RETRIES is not set
+const defaultDeviceBusyRetries = 3
+
+// deviceBusyMessages output of mount/mkfs when the device or mount point is still held e.g by the unstage of a rescheduled pod
+var deviceBusyMessages = []string{
+	"device or resource busy",
+	"mount point busy",
+	"target is busy",
+	"apparently in use by the system",
+}
+
+// isDeviceBusyError returns true if the error is a transient device busy (EBUSY) condition
+func isDeviceBusyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.EBUSY) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, busyMsg := range deviceBusyMessages {
+		if strings.Contains(msg, busyMsg) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTargetPath verifies that the publish target path is under the kubelet pods or block publish directory and
+// that none of its existing path elements is a symlink, to refuse bind mounting onto a target swapped to another location.
+// The kubelet root directory differs between clusters e.g /var/data/kubelet on IKS, the check is only done when
+// KUBELET_ROOT_DIR is set.
+func validateTargetPath(targetPath string) error {
+	kubeletRootDir := os.Getenv("KUBELET_ROOT_DIR")
+	if len(kubeletRootDir) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(targetPath) || filepath.Clean(targetPath) != targetPath {
+		return fmt.Errorf("target path %s is not a clean absolute path", targetPath)
+	}
+
+	var targetDir string
+	for _, dir := range publishTargetDirs {
+		dir = filepath.Join(kubeletRootDir, dir)
+		if strings.HasPrefix(targetPath, dir+string(filepath.Separator)) {
+			targetDir = dir
+			break
+		}
+	}
+	if len(targetDir) == 0 {
+		return fmt.Errorf("target path %s is not under the kubelet directories %v of %s", targetPath, publishTargetDirs, kubeletRootDir)
+	}
+
+	// The target itself may not exist yet, check the deepest existing path element
+	existing := targetPath
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check target path %s: %v", existing, err)
+		}
+		if existing == kubeletRootDir {
+			// nothing exists under the kubelet root directory which could have been swapped
+			return nil
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	// The kubelet root directory itself may be a symlink e.g /var/lib/kubelet -> /var/data/kubelet
+	rootResolved, err := filepath.EvalSymlinks(kubeletRootDir)
+	if err != nil {
+		rootResolved = kubeletRootDir
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return fmt.Errorf("failed to resolve target path %s: %v", existing, err)
+	}
+	relPath, err := filepath.Rel(kubeletRootDir, existing)
+	if err != nil {
+		return fmt.Errorf("failed to check target path %s: %v", existing, err)
+	}
+	if expected := filepath.Join(rootResolved, relPath); resolved != expected {
+		return fmt.Errorf("target path %s resolves to %s through a symlink", existing, resolved)
+	}
+	return nil
+}
+
+// isNotMountedError returns true if umount failed because the target is not (or no longer) a mount point
+func isNotMountedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, syscall.EINVAL) || strings.Contains(strings.ToLower(err.Error()), "not mounted")
+}
+
+// cleanupTargetPath unmounts and removes the target path, a target path which does not exist or is
+// already unmounted is treated as cleaned up so that retried unpublish calls succeed
+func (csiNS *CSINodeServer) cleanupTargetPath(ctxLogger *zap.Logger, targetPath string) error {
+	if exists, err := mount.PathExists(targetPath); err == nil && !exists {
+		ctxLogger.Info("Target path does not exist, volume is already unpublished", zap.String("targetPath", targetPath))
+		return nil
+	}
+	err := mount.CleanupMountPoint(targetPath, csiNS.Mounter, false /* bind mount */)
+	if !isNotMountedError(err) {
+		return err
+	}
+	ctxLogger.Info("Target path is already unmounted, removing it", zap.String("targetPath", targetPath), zap.Error(err))
+	if err = os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// retryOnDeviceBusy runs op and retries it with backoff up to NODE_STAGE_BUSY_RETRIES times as long as it fails
+// with a device busy error, any other error or the last device busy error is returned as is
+func retryOnDeviceBusy(ctx context.Context, ctxLogger *zap.Logger, op func() error) error {
+	retries := getNonNegativeIntEnv(ctxLogger, "NODE_STAGE_BUSY_RETRIES", defaultDeviceBusyRetries)
+	backoff := deviceBusyRetryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !isDeviceBusyError(err) || attempt > retries {
+			return err
+		}
+		ctxLogger.Warn("Device busy, retrying", zap.Int("Attempt", attempt), zap.Int("MaxRetries", retries), zap.Duration("RetryAfter", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// resize expands the file system of the device if needed, resize2fs/xfs_growfs are killed if ctx is cancelled.
+// The file system is grown only if the device is larger than the file system, and is verified to fill
+// the device afterwards so a resize tool exiting successfully without growing is reported as an error.
+func (csiNS *CSINodeServer) resize(ctx context.Context, devicePath, deviceMountPath string) (bool, error) {
+	r := mount.NewResizeFs(&contextExec{ctx: ctx, Interface: csiNS.Mounter.GetSafeFormatAndMount().Exec})
+	needResize, err := r.NeedResize(devicePath, deviceMountPath)
+	if err != nil {
+		return false, err
+	}
+	if needResize {
+		if _, err := r.Resize(devicePath, deviceMountPath); err != nil {
+			return false, err
+		}
+		stillNeedResize, err := r.NeedResize(devicePath, deviceMountPath)
+		if err != nil {
+			return false, fmt.Errorf("failed to verify file system size of %s after resize: %v", devicePath, err)
+		}
+		if stillNeedResize {
+			return false, fmt.Errorf("file system of %s is still smaller than the device after resize", devicePath)
+		}
+	}
+	return true, nil
+}
+
+// contextError returns the gRPC error if the RPC context is cancelled or its deadline exceeded, nil otherwise
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return status.Error(codes.Canceled, "request cancelled by the caller")
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, "request deadline exceeded")
+	}
+	return nil
+}
+
+// applyIOScheduler sets the I/O scheduler of the block device backing devicePath.
+// The scheduler is set only if the kernel exposes it for the device, e.g
+// /sys/block/vdb/queue/scheduler contains "[mq-deadline] kyber bfq none"
+func applyIOScheduler(ctxLogger *zap.Logger, devicePath string, scheduler string) error {
+	device, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve device path %s: %v", devicePath, err)
+	}
+	schedulerFile := filepath.Join(sysBlockPath, filepath.Base(device), "queue", "scheduler")
+	content, err := os.ReadFile(schedulerFile) // #nosec G304: path is derived from the attached device name.
+	if err != nil {
+		return fmt.Errorf("failed to read available I/O schedulers from %s: %v", schedulerFile, err)
+	}
+
+	available := strings.Fields(strings.NewReplacer("[", "", "]", "").Replace(string(content)))
+	found := false
+	for _, s := range available {
+		if s == scheduler {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("I/O scheduler %s is not available for device %s. Available schedulers: %v", scheduler, device, available)
+	}
+
+	if err := os.WriteFile(schedulerFile, []byte(scheduler), filePermission); err != nil {
+		return fmt.Errorf("failed to set I/O scheduler %s in %s: %v", scheduler, schedulerFile, err)
+	}
+	ctxLogger.Info("Successfully set I/O scheduler", zap.String("device", device), zap.String(IOScheduler, scheduler))
+	return nil
+}
+
+// findOrphanedStagingMounts lists the driver staging mounts which do not belong to any of the attachedVolumes
+func (csiNS *CSINodeServer) findOrphanedStagingMounts(ctxLogger *zap.Logger, mountPoints []mount.MountPoint, attachedVolumes map[string]bool) []stagingMount {
+	var orphans []stagingMount
+	for _, mp := range mountPoints {
+		if !strings.HasPrefix(mp.Path, stagingMountsRoot+"/") || filepath.Base(mp.Path) != stagingMountDir {
+			continue
+		}
+		dataFile := filepath.Join(filepath.Dir(mp.Path), volumeDataFile)
+		content, err := os.ReadFile(dataFile) // #nosec G304: path is derived from the kubelet staging directory.
+		if err != nil {
+			ctxLogger.Warn("Unable to read volume data of the staging mount", zap.String("path", mp.Path), zap.Error(err))
+			continue
+		}
+		volData := volumeData{}
+		if err = json.Unmarshal(content, &volData); err != nil || len(volData.VolumeHandle) == 0 {
+			ctxLogger.Warn("Invalid volume data of the staging mount", zap.String("path", mp.Path), zap.Error(err))
+			continue
+		}
+		if volData.DriverName != csiNS.Driver.name {
+			continue
+		}
+		if !attachedVolumes[volData.VolumeHandle] {
+			ctxLogger.Warn("Found orphaned staging mount", zap.String("volumeID", volData.VolumeHandle), zap.String("path", mp.Path), zap.String("device", mp.Device))
+			orphans = append(orphans, stagingMount{VolumeID: volData.VolumeHandle, Path: mp.Path, Device: mp.Device})
+		}
+	}
+	return orphans
+}
+
+// cleanupOrphanedStagingMounts unmounts the orphaned staging mounts. A staging mount is skipped
+// if its device is mounted anywhere else, so that the volume of a running pod is never unmounted
+func (csiNS *CSINodeServer) cleanupOrphanedStagingMounts(ctxLogger *zap.Logger, mountPoints []mount.MountPoint, orphans []stagingMount) {
+	for _, orphan := range orphans {
+		inUse := false
+		for _, mp := range mountPoints {
+			if mp.Device == orphan.Device && mp.Path != orphan.Path {
+				ctxLogger.Warn("Skipping cleanup of orphaned staging mount, device is still in use", zap.String("volumeID", orphan.VolumeID), zap.String("device", orphan.Device), zap.String("usedBy", mp.Path))
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+		if err := mount.CleanupMountPoint(orphan.Path, csiNS.Mounter, false); err != nil {
+			ctxLogger.Error("Failed to cleanup orphaned staging mount", zap.String("volumeID", orphan.VolumeID), zap.String("path", orphan.Path), zap.Error(err))
+			continue
+		}
+		ctxLogger.Info("Successfully cleaned up orphaned staging mount", zap.String("volumeID", orphan.VolumeID), zap.String("path", orphan.Path))
+	}
+}
+
+// mountOptionConflicts groups of mount options overriding each other, only one option of a group is kept
+var mountOptionConflicts = [][]string{
+	{"ro", "rw"},
+	{"atime", "noatime", "relatime", "strictatime"},
+	{"diratime", "nodiratime"},
+	{"sync", "async"},
+	{"dev", "nodev"},
+	{"exec", "noexec"},
+	{"suid", "nosuid"},
+	{"discard", "nodiscard"},
+}
+
+// mountOptionKey returns the key identifying conflicting mount options e.g "noatime" and "relatime"
+// are both identified as "atime", "data=ordered" and "data=journal" as "data="
+func mountOptionKey(option string) string {
+	if i := strings.Index(option, "="); i > 0 {
+		return option[:i+1]
+	}
+	for _, group := range mountOptionConflicts {
+		for _, conflict := range group {
+			if option == conflict {
+				return group[0]
+			}
+		}
+	}
+	return option
+}
+
+// splitMountOptions splits comma separated mount options, dropping empty entries
+func splitMountOptions(options string) []string {
+	var result []string
+	for _, option := range strings.Split(options, ",") {
+		if option = strings.TrimSpace(option); len(option) != 0 {
+			result = append(result, option)
+		}
+	}
+	return result
+}
+
+// mergeMountOptions merges the mount option sources given in order of precedence. Duplicate options are
+// dropped and among conflicting options only the one from the source with higher precedence is kept,
+// otherwise the order of the options is preserved so the result is deterministic.
+func mergeMountOptions(sources ...[]string) []string {
+	var options []string
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		for _, option := range splitMountOptions(strings.Join(source, ",")) {
+			key := mountOptionKey(option)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// safeDefaultMountOptions mount options allowed in DEFAULT_MOUNT_OPTIONS, options ending with '=' take a numeric value
+var safeDefaultMountOptions = []string{
+	"atime", "noatime", "relatime", "strictatime", "lazytime", "nolazytime",
+	"diratime", "nodiratime", "discard", "nodiscard", "nodev", "nosuid", "noexec",
+	"sync", "async", "dirsync", "commit=",
+}
+
+// isSafeDefaultMountOption returns true if the option is in the safeDefaultMountOptions allowlist
+func isSafeDefaultMountOption(option string) bool {
+	for _, safe := range safeDefaultMountOptions {
+		if strings.HasSuffix(safe, "=") && strings.HasPrefix(option, safe) {
+			_, err := strconv.ParseUint(strings.TrimPrefix(option, safe), 10, 32)
+			return err == nil
+		}
+		if option == safe {
+			return true
+		}
+	}
+	return false
+}
+
+// getDefaultMountOptions returns the default mount options per file system type set in DEFAULT_MOUNT_OPTIONS
+// e.g DEFAULT_MOUNT_OPTIONS="ext4:noatime,nodiratime;xfs:noatime". An error is returned for an unsupported
+// file system type or an option which is not in the safe allowlist.
+func getDefaultMountOptions() (map[string][]string, error) {
+	defaults := make(map[string][]string)
+	for _, entry := range strings.Split(os.Getenv("DEFAULT_MOUNT_OPTIONS"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		fsType, options, found := strings.Cut(entry, ":")
+		fsType = strings.TrimSpace(fsType)
+		if !found || !isSupportedFS(fsType) {
+			return nil, fmt.Errorf("<%s> is not a valid entry, expecting <fsType>:<options> with fsType one of %v", entry, SupportedFS)
+		}
+		for _, option := range splitMountOptions(options) {
+			if !isSafeDefaultMountOption(option) {
+				return nil, fmt.Errorf("mount option <%s> for %s is not allowed, allowed options are %v", option, fsType, safeDefaultMountOptions)
+			}
+			defaults[fsType] = append(defaults[fsType], option)
+		}
+	}
+	return defaults, nil
+}
+
+// isSupportedFS returns true if the file system type is in SupportedFS
+func isSupportedFS(fsType string) bool {
+	for _, supported := range SupportedFS {
+		if fsType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// commonMountOptions mount options allowed for every file system type, options ending with '=' take any value
+var commonMountOptions = []string{
+	"defaults", "ro", "rw", "atime", "noatime", "relatime", "strictatime", "lazytime", "nolazytime",
+	"diratime", "nodiratime", "discard", "nodiscard", "nodev", "nosuid", "noexec",
+	"sync", "async", "dirsync", "acl", "noacl", "user_xattr", "nouser_xattr",
+	"quota", "noquota", "usrquota", "grpquota", "prjquota",
+	"nofail", "_netdev", "context=", "fscontext=", "defcontext=", "rootcontext=", "seclabel",
+}
+
+// extMountOptions mount options specific to the ext2, ext3 and ext4 file systems
+var extMountOptions = []string{
+	"commit=", "data=", "errors=", "barrier", "barrier=", "nobarrier", "delalloc", "nodelalloc",
+	"journal_checksum", "nojournal_checksum", "dioread_lock", "dioread_nolock", "auto_da_alloc", "noauto_da_alloc",
+	"init_itable", "init_itable=", "noinit_itable", "stripe=", "inode_readahead_blks=", "max_batch_time=", "min_batch_time=",
+}
+
+// xfsMountOptions mount options specific to the xfs file system
+var xfsMountOptions = []string{
+	"nouuid", "attr2", "noattr2", "inode32", "inode64", "largeio", "nolargeio", "swalloc", "noalign", "wsync",
+	"allocsize=", "logbufs=", "logbsize=", "sunit=", "swidth=", "uquota", "gquota", "pquota", "uqnoenforce", "gqnoenforce", "pqnoenforce",
+}
+
+// defaultMountOptionsAllowlist mount options users may set through the PV or storage class per file system type, for
+// the file system types not listed in MOUNT_OPTIONS_ALLOWLIST
+var defaultMountOptionsAllowlist = map[string][]string{
+	"ext2": append(append([]string{}, commonMountOptions...), extMountOptions...),
+	"ext3": append(append([]string{}, commonMountOptions...), extMountOptions...),
+	"ext4": append(append([]string{}, commonMountOptions...), extMountOptions...),
+	"xfs":  append(append([]string{}, commonMountOptions...), xfsMountOptions...),
+}
+
+// getMountOptionsAllowlist returns the mount options allowed per file system type, nil if MOUNT_OPTIONS_ALLOWLIST is
+// not set as every option is allowed. The built-in allowlist of a file system type is replaced by the one set in
+// MOUNT_OPTIONS_ALLOWLIST e.g "ext4:noatime,data=;xfs:*" where options ending with '=' take any value and '*' allows
+// every option
+func getMountOptionsAllowlist() (map[string][]string, error) {
+	if len(strings.TrimSpace(os.Getenv("MOUNT_OPTIONS_ALLOWLIST"))) == 0 {
+		return nil, nil
+	}
+	allowlist := make(map[string][]string)
+	for fsType, options := range defaultMountOptionsAllowlist {
+		allowlist[fsType] = options
+	}
+	for _, entry := range strings.Split(os.Getenv("MOUNT_OPTIONS_ALLOWLIST"), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+		fsType, options, found := strings.Cut(entry, ":")
+		fsType = strings.TrimSpace(fsType)
+		if !found || !isSupportedFS(fsType) {
+			return nil, fmt.Errorf("<%s> is not a valid entry, expecting <fsType>:<options> with fsType one of %v", entry, SupportedFS)
+		}
+		allowlist[fsType] = splitMountOptions(options)
+	}
+	return allowlist, nil
+}
+
+// isMountOptionAllowed returns true if the option is in the allowlist
+func isMountOptionAllowed(option string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if strings.HasSuffix(allowed, "=") {
+			if strings.HasPrefix(option, allowed) && len(option) > len(allowed) {
+				return true
+			}
+			continue
+		}
+		if allowed == "*" || option == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMountOptions returns an error naming the first option which is not allowed for the file system type,
+// every option is allowed if there is no allowlist
+func validateMountOptions(fsType string, allowlist map[string][]string, options []string) error {
+	if allowlist == nil {
+		return nil
+	}
+	for _, option := range options {
+		if !isMountOptionAllowed(option, allowlist[fsType]) {
+			return fmt.Errorf("mount option <%s> is not allowed for %s volumes", option, fsType)
+		}
+	}
+	return nil
+}
+
+// accessTypeName returns the name of the volume capability access type
+func accessTypeName(isBlock bool) string {
+	if isBlock {
+		return "block"
+	}
+	return "mount"
+}
+
+// validateAccessType verifies that the access type of the request matches the access type the volume was staged with,
+// the check is skipped if the volume was not staged since the driver started. csiNS.mux must be held.
+func (csiNS *CSINodeServer) validateAccessType(volumeID string, isBlock bool) error {
+	stagedBlock, staged := csiNS.stagedAccessTypes[volumeID]
+	if staged && stagedBlock != isBlock {
+		return fmt.Errorf("volume %s is staged with %s access type, %s access type requested", volumeID, accessTypeName(stagedBlock), accessTypeName(isBlock))
+	}
+	return nil
+}
+
+// recordAccessType records the access type the volume is staged with, csiNS.mux must be held
+func (csiNS *CSINodeServer) recordAccessType(volumeID string, isBlock bool) {
+	if csiNS.stagedAccessTypes == nil {
+		csiNS.stagedAccessTypes = make(map[string]bool)
+	}
+	csiNS.stagedAccessTypes[volumeID] = isBlock
+}
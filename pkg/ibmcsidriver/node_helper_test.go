@@ -17,10 +17,23 @@ limitations under the License.
 package ibmcsidriver
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	mount "k8s.io/mount-utils"
+	"k8s.io/utils/exec"
 )
 
 func TestFindDevicePathSource(t *testing.T) {
@@ -51,7 +64,7 @@ func TestFindDevicePathSource(t *testing.T) {
 	icDriver := initIBMCSIDriver(t)
 	for _, tc := range testCases {
 		t.Logf("Test case: %s", tc.name)
-		response, err := icDriver.ns.findDevicePathSource(logger, tc.req, "")
+		response, err := icDriver.ns.findDevicePathSource(context.TODO(), logger, tc.req, "")
 		if tc.expError != nil {
 			assert.Equal(t, tc.expError, err)
 		}
@@ -59,6 +72,59 @@ func TestFindDevicePathSource(t *testing.T) {
 	}
 }
 
+// pathExistsMounter overrides PathExists of the fake mounter
+type pathExistsMounter struct {
+	mountManager.Mounter
+	pathExists func(string) (bool, error)
+}
+
+func (m *pathExistsMounter) PathExists(pathname string) (bool, error) {
+	return m.pathExists(pathname)
+}
+
+func TestFindDevicePathSourceRescan(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// Fake udevadm failing right away to skip the wait after the trigger
+	binDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "udevadm"), []byte("#!/bin/sh\nexit 1\n"), 0700)) // #nosec G306: test script must be executable
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+
+	oldSysClassPath, oldSettleTime := sysClassPath, deviceRescanSettleTime
+	sysClassPath, deviceRescanSettleTime = t.TempDir(), 0
+	defer func() { sysClassPath, deviceRescanSettleTime = oldSysClassPath, oldSettleTime }()
+	scsiScan := filepath.Join(sysClassPath, "scsi_host", "host0", "scan")
+	nvmeRescan := filepath.Join(sysClassPath, "nvme", "nvme0", "rescan_controller")
+	for _, path := range []string{scsiScan, nvmeRescan} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0750))
+		assert.Nil(t, os.WriteFile(path, nil, 0600))
+	}
+
+	// Device shows up once the SCSI bus is rescanned
+	icDriver := initIBMCSIDriver(t)
+	icDriver.ns.Mounter = &pathExistsMounter{Mounter: icDriver.ns.Mounter, pathExists: func(string) (bool, error) {
+		content, err := os.ReadFile(scsiScan) // #nosec G304: test file
+		return string(content) == "- - -", err
+	}}
+	source, err := icDriver.ns.findDevicePathSource(context.Background(), logger, "/dev/disk/by-id/virtio-vol", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/disk/by-id/virtio-vol", source)
+	content, err := os.ReadFile(nvmeRescan) // #nosec G304: test file
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(content))
+
+	// Rescan disabled
+	t.Setenv("DEVICE_RESCAN_ON_TIMEOUT", "false")
+	assert.Nil(t, os.WriteFile(scsiScan, nil, 0600))
+	_, err = icDriver.ns.findDevicePathSource(context.Background(), logger, "/dev/disk/by-id/virtio-vol", "")
+	assert.Nil(t, err)
+	content, err = os.ReadFile(scsiScan) // #nosec G304: test file
+	assert.Nil(t, err)
+	assert.Empty(t, content)
+}
+
 func TestProcessMount(t *testing.T) {
 	// Creating test logger
 	logger, teardown := cloudProvider.GetTestLogger(t)
@@ -76,7 +142,7 @@ func TestUdevadmTrigger(t *testing.T) {
 	defer teardown()
 
 	icDriver := initIBMCSIDriver(t)
-	err := icDriver.ns.udevadmTrigger(logger)
+	err := icDriver.ns.udevadmTrigger(context.TODO(), logger)
 	t.Logf("Response error %v", err)
 }
 
@@ -87,6 +153,577 @@ func TestProcessMountForBlock(t *testing.T) {
 
 	icDriver := initIBMCSIDriver(t)
 	ops := []string{"bind"}
-	response, err := icDriver.ns.processMountForBlock(logger, "ProcessMountForBlock", "/dev/sda", "/targetpath", "volumeidxxx", ops)
+	response, err := icDriver.ns.processMountForBlock(context.TODO(), logger, "ProcessMountForBlock", "/dev/sda", "/targetpath", "volumeidxxx", ops)
 	t.Logf("Response %v, error %v", response, err)
 }
+
+func TestApplyIOScheduler(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// Fake sysfs tree for the device
+	oldSysBlockPath := sysBlockPath
+	sysBlockPath = t.TempDir()
+	defer func() { sysBlockPath = oldSysBlockPath }()
+
+	devDir := t.TempDir()
+	devicePath := filepath.Join(devDir, "vdb")
+	assert.Nil(t, os.WriteFile(devicePath, []byte{}, 0600))
+	queueDir := filepath.Join(sysBlockPath, "vdb", "queue")
+	assert.Nil(t, os.MkdirAll(queueDir, 0700))
+	schedulerFile := filepath.Join(queueDir, "scheduler")
+
+	testCases := []struct {
+		name        string
+		scheduler   string
+		expContent  string
+		expErrorNil bool
+	}{
+		{
+			name:        "Available scheduler",
+			scheduler:   "kyber",
+			expContent:  "kyber",
+			expErrorNil: true,
+		},
+		{
+			name:        "Unavailable scheduler",
+			scheduler:   "cfq",
+			expContent:  "[mq-deadline] kyber bfq none",
+			expErrorNil: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		assert.Nil(t, os.WriteFile(schedulerFile, []byte("[mq-deadline] kyber bfq none"), 0600))
+		err := applyIOScheduler(logger, devicePath, tc.scheduler)
+		assert.Equal(t, tc.expErrorNil, err == nil)
+		content, _ := os.ReadFile(schedulerFile)
+		assert.Equal(t, tc.expContent, string(content))
+	}
+
+	// Device without sysfs entry
+	err := applyIOScheduler(logger, filepath.Join(devDir, "missing"), "kyber")
+	assert.NotNil(t, err)
+}
+
+// setupFakeStagingMounts creates the kubelet staging directories under a temporary staging root and
+// returns a fake mounter having the staging mounts and a pod mount of the in use volume
+func setupFakeStagingMounts(t *testing.T, driverName string) *mount.FakeMounter {
+	stagingMountsRoot = t.TempDir()
+	stagingMounts := []struct {
+		driver   string
+		volumeID string
+		device   string
+	}{
+		{driverName, "vol-live", "/dev/vdb"},
+		{driverName, "vol-orphan", "/dev/vdc"},
+		{driverName, "vol-orphan-inuse", "/dev/vdd"},
+		{"other.csi.driver", "vol-other", "/dev/vde"},
+	}
+	fakeMounter := &mount.FakeMounter{}
+	for i, sm := range stagingMounts {
+		volDir := filepath.Join(stagingMountsRoot, sm.driver, fmt.Sprintf("hash%d", i))
+		assert.Nil(t, os.MkdirAll(filepath.Join(volDir, stagingMountDir), 0700))
+		volData := fmt.Sprintf(`{"driverName":"%s","volumeHandle":"%s"}`, sm.driver, sm.volumeID)
+		assert.Nil(t, os.WriteFile(filepath.Join(volDir, volumeDataFile), []byte(volData), 0600))
+		fakeMounter.MountPoints = append(fakeMounter.MountPoints, mount.MountPoint{Device: sm.device, Path: filepath.Join(volDir, stagingMountDir), Type: "ext4"})
+	}
+	// Pod still using the device of the orphaned staging mount
+	fakeMounter.MountPoints = append(fakeMounter.MountPoints, mount.MountPoint{Device: "/dev/vdd", Path: "/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~csi/pv1/mount", Type: "ext4"})
+	return fakeMounter
+}
+
+func TestFindAndCleanupOrphanedStagingMounts(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	oldStagingMountsRoot := stagingMountsRoot
+	defer func() { stagingMountsRoot = oldStagingMountsRoot }()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeMounter := setupFakeStagingMounts(t, icDriver.name)
+	icDriver.ns.Mounter = &mountManager.FakeNodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: fakeMounter}}
+
+	orphans := icDriver.ns.findOrphanedStagingMounts(logger, fakeMounter.MountPoints, map[string]bool{"vol-live": true})
+	var orphanIDs []string
+	for _, orphan := range orphans {
+		orphanIDs = append(orphanIDs, orphan.VolumeID)
+	}
+	assert.ElementsMatch(t, []string{"vol-orphan", "vol-orphan-inuse"}, orphanIDs)
+
+	icDriver.ns.cleanupOrphanedStagingMounts(logger, fakeMounter.MountPoints, orphans)
+	var devices []string
+	for _, mp := range fakeMounter.MountPoints {
+		devices = append(devices, mp.Device)
+	}
+	// Only the orphaned staging mount whose device is not used by any pod is unmounted
+	assert.NotContains(t, devices, "/dev/vdc")
+	assert.ElementsMatch(t, []string{"/dev/vdb", "/dev/vdd", "/dev/vde", "/dev/vdd"}, devices)
+}
+
+func TestFormatAndMountCancelled(t *testing.T) {
+	// Fake blkid reporting an unformatted disk and a long running mkfs which records its pid
+	binDir := t.TempDir()
+	pidFile := filepath.Join(binDir, "mkfs.pid")
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "blkid"), []byte("#!/bin/sh\nexit 2\n"), 0700))                                   // #nosec G306: test script must be executable
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "mkfs.ext4"), []byte("#!/bin/sh\necho $$ > "+pidFile+"\nexec sleep 30\n"), 0700)) // #nosec G306: test script must be executable
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+
+	icDriver := initIBMCSIDriver(t)
+	icDriver.ns.Mounter = &mountManager.FakeNodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: &mount.FakeMounter{}, Exec: exec.New()}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// Cancel once mkfs is running
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(pidFile); err == nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	start := time.Now()
+	err := icDriver.ns.formatAndMount(ctx, "/dev/fakedevice", t.TempDir(), "ext4", nil)
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 20*time.Second)
+
+	ctxErr := contextError(ctx)
+	serverError, ok := status.FromError(ctxErr)
+	assert.True(t, ok)
+	assert.Equal(t, codes.Canceled, serverError.Code())
+
+	// mkfs subprocess must have been killed
+	content, err := os.ReadFile(pidFile) // #nosec G304: test file
+	assert.Nil(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	assert.Nil(t, err)
+	assert.Equal(t, syscall.ESRCH, syscall.Kill(pid, 0))
+}
+
+func TestContextError(t *testing.T) {
+	assert.Nil(t, contextError(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	serverError, _ := status.FromError(contextError(ctx))
+	assert.Equal(t, codes.DeadlineExceeded, serverError.Code())
+}
+
+func TestUdevadmTriggerArgs(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	testCases := []struct {
+		name        string
+		include     string
+		exclude     string
+		expResponse []string
+	}{
+		{
+			name:        "No patterns, all devices are refreshed",
+			expResponse: []string{"trigger"},
+		},
+		{
+			name:        "Include and exclude patterns",
+			include:     "vd*",
+			exclude:     "loop*, ram*",
+			expResponse: []string{"trigger", "--subsystem-match=block", "--sysname-match=vd*", "--sysname-nomatch=loop*", "--sysname-nomatch=ram*"},
+		},
+		{
+			name:        "Invalid pattern is ignored",
+			exclude:     "[loop,nbd*",
+			expResponse: []string{"trigger", "--subsystem-match=block", "--sysname-nomatch=nbd*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		t.Setenv("DEVICE_SCAN_INCLUDE", tc.include)
+		t.Setenv("DEVICE_SCAN_EXCLUDE", tc.exclude)
+		assert.Equal(t, tc.expResponse, udevadmTriggerArgs(logger))
+	}
+}
+
+func TestUdevadmTriggerExcludedDevices(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// Fake udevadm recording its arguments
+	binDir := t.TempDir()
+	argsFile := filepath.Join(binDir, "udevadm.args")
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "udevadm"), []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\n"), 0700)) // #nosec G306: test script must be executable
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+	t.Setenv("DEVICE_SCAN_EXCLUDE", "loop*")
+
+	// Short deadline to skip the wait after the trigger
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	icDriver := initIBMCSIDriver(t)
+	err := icDriver.ns.udevadmTrigger(ctx, logger)
+	assert.NotNil(t, err)
+
+	content, err := os.ReadFile(argsFile) // #nosec G304: test file
+	assert.Nil(t, err)
+	assert.Equal(t, "trigger --subsystem-match=block --sysname-nomatch=loop*", strings.TrimSpace(string(content)))
+}
+
+func TestCollectMountOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fsType        string
+		mntFlags      []string
+		volumeContext map[string]string
+		fsDefaults    []string
+		expResponse   []string
+	}{
+		{
+			name:        "No mount options",
+			fsType:      "ext4",
+			expResponse: nil,
+		},
+		{
+			name:        "xfs default",
+			fsType:      "xfs",
+			mntFlags:    []string{"noatime"},
+			expResponse: []string{"noatime", "nouuid"},
+		},
+		{
+			name:          "Duplicate options across sources",
+			fsType:        "xfs",
+			mntFlags:      []string{"noatime", "noatime", "nouuid"},
+			volumeContext: map[string]string{MountOptions: "noatime,discard"},
+			expResponse:   []string{"noatime", "nouuid", "discard"},
+		},
+		{
+			name:          "Conflicting options, PV mount options take precedence",
+			fsType:        "ext4",
+			mntFlags:      []string{"relatime", "data=writeback"},
+			volumeContext: map[string]string{MountOptions: "noatime,data=ordered,nodev"},
+			expResponse:   []string{"relatime", "data=writeback", "nodev"},
+		},
+		{
+			name:          "Comma separated mount flag",
+			fsType:        "ext4",
+			mntFlags:      []string{"sync,noexec", ""},
+			volumeContext: map[string]string{MountOptions: "async,exec,nosuid"},
+			expResponse:   []string{"sync", "noexec", "nosuid"},
+		},
+		{
+			name:        "ext4 configured defaults applied",
+			fsType:      "ext4",
+			fsDefaults:  []string{"noatime", "nodiratime"},
+			expResponse: []string{"noatime", "nodiratime"},
+		},
+		{
+			name:          "ext4 configured defaults overridden by PV and storage class",
+			fsType:        "ext4",
+			mntFlags:      []string{"relatime"},
+			volumeContext: map[string]string{MountOptions: "diratime"},
+			fsDefaults:    []string{"noatime", "nodiratime", "nodev"},
+			expResponse:   []string{"relatime", "diratime", "nodev"},
+		},
+		{
+			name:        "xfs configured defaults applied with driver defaults",
+			fsType:      "xfs",
+			fsDefaults:  []string{"noatime"},
+			expResponse: []string{"noatime", "nouuid"},
+		},
+		{
+			name:        "xfs configured defaults overridden by PV",
+			fsType:      "xfs",
+			mntFlags:    []string{"strictatime"},
+			fsDefaults:  []string{"noatime", "discard"},
+			expResponse: []string{"strictatime", "discard", "nouuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		assert.Equal(t, tc.expResponse, collectMountOptions(tc.fsType, tc.mntFlags, tc.volumeContext, tc.fsDefaults))
+	}
+}
+
+func TestMergeMountOptions(t *testing.T) {
+	// readonly publish overrides rw mount option, order of the options is preserved
+	assert.Equal(t, []string{"bind", "ro", "noatime"}, mergeMountOptions([]string{"bind", "ro"}, []string{"rw", "noatime"}, []string{"bind", "strictatime"}))
+	assert.Equal(t, []string{"bind"}, mergeMountOptions([]string{"bind"}, nil))
+}
+
+func TestGetDefaultMountOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		env         string
+		expResponse map[string][]string
+		expErr      bool
+	}{
+		{
+			name:        "Not set",
+			expResponse: map[string][]string{},
+		},
+		{
+			name:        "ext4 and xfs defaults",
+			env:         "ext4:noatime,nodiratime,commit=30; xfs:noatime;",
+			expResponse: map[string][]string{"ext4": {"noatime", "nodiratime", "commit=30"}, "xfs": {"noatime"}},
+		},
+		{
+			name:   "Unsupported file system",
+			env:    "btrfs:noatime",
+			expErr: true,
+		},
+		{
+			name:   "Missing file system",
+			env:    "noatime",
+			expErr: true,
+		},
+		{
+			name:   "Option not in the allowlist",
+			env:    "ext4:noatime,ro",
+			expErr: true,
+		},
+		{
+			name:   "Invalid option value",
+			env:    "ext4:commit=soon",
+			expErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		t.Setenv("DEFAULT_MOUNT_OPTIONS", tc.env)
+		defaults, err := getDefaultMountOptions()
+		if tc.expErr {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expResponse, defaults)
+	}
+}
+
+func TestGetMountOptionsAllowlist(t *testing.T) {
+	t.Setenv("MOUNT_OPTIONS_ALLOWLIST", "")
+	allowlist, err := getMountOptionsAllowlist()
+	assert.Nil(t, err)
+	assert.Nil(t, allowlist)
+	assert.Nil(t, validateMountOptions("ext4", allowlist, []string{"suid", "logbufs=8"}))
+
+	t.Setenv("MOUNT_OPTIONS_ALLOWLIST", "ext4: noatime,data= ; xfs:*")
+	allowlist, err = getMountOptionsAllowlist()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"noatime", "data="}, allowlist["ext4"])
+	assert.Equal(t, []string{"*"}, allowlist["xfs"])
+	assert.Equal(t, defaultMountOptionsAllowlist["ext3"], allowlist["ext3"])
+
+	for _, env := range []string{"btrfs:noatime", "noatime"} {
+		t.Setenv("MOUNT_OPTIONS_ALLOWLIST", env)
+		_, err = getMountOptionsAllowlist()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestValidateMountOptions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fsType    string
+		options   []string
+		expOption string
+	}{
+		{
+			name:    "ext4 options",
+			fsType:  "ext4",
+			options: []string{"noatime", "data=ordered", "errors=remount-ro", "commit=30"},
+		},
+		{
+			name:    "xfs options",
+			fsType:  "xfs",
+			options: []string{"noatime", "nouuid", "logbufs=8", "inode64"},
+		},
+		{
+			name:      "xfs option on ext4",
+			fsType:    "ext4",
+			options:   []string{"noatime", "logbufs=8"},
+			expOption: "logbufs=8",
+		},
+		{
+			name:      "ext4 option on xfs",
+			fsType:    "xfs",
+			options:   []string{"data=journal"},
+			expOption: "data=journal",
+		},
+		{
+			name:    "kubelet and SELinux options",
+			fsType:  "xfs",
+			options: []string{"nofail", "_netdev", "context=system_u:object_r:container_file_t:s0:c1,c2"},
+		},
+		{
+			name:      "Unknown option",
+			fsType:    "ext4",
+			options:   []string{"suid"},
+			expOption: "suid",
+		},
+		{
+			name:      "Option without value",
+			fsType:    "ext4",
+			options:   []string{"data="},
+			expOption: "data=",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMountOptions(tc.fsType, defaultMountOptionsAllowlist, tc.options)
+			if tc.expOption == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "<"+tc.expOption+">")
+		})
+	}
+
+	// every option allowed
+	assert.Nil(t, validateMountOptions("xfs", map[string][]string{"xfs": {"*"}}, []string{"suid", "context=system_u:object_r:container_file_t:s0"}))
+}
+
+func TestRetryOnDeviceBusy(t *testing.T) {
+	oldBackoff := deviceBusyRetryInitialBackoff
+	deviceBusyRetryInitialBackoff = time.Millisecond
+	defer func() { deviceBusyRetryInitialBackoff = oldBackoff }()
+
+	busyErr := fmt.Errorf("mount failed: exit status 32, output: mount: /staging: /dev/vdd already mounted or mount point busy")
+	permanentErr := fmt.Errorf("mount failed: exit status 32, output: wrong fs type, bad option, bad superblock on /dev/vdd")
+
+	testCases := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "Success", errs: nil, expectedCalls: 1},
+		{name: "Device busy then success", errs: []error{busyErr, syscall.EBUSY}, expectedCalls: 3},
+		{name: "Permanent error is not retried", errs: []error{permanentErr}, expectedCalls: 1, expectedErr: permanentErr},
+		{name: "Device busy retries exhausted", errs: []error{busyErr, busyErr, busyErr, busyErr, busyErr}, expectedCalls: 4, expectedErr: busyErr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, teardown := cloudProvider.GetTestLogger(t)
+			defer teardown()
+			calls := 0
+			err := retryOnDeviceBusy(context.Background(), logger, func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+
+	// Retries stop once the request is cancelled
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := retryOnDeviceBusy(ctx, logger, func() error {
+		calls++
+		return busyErr
+	})
+	assert.Equal(t, busyErr, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestValidateTargetPath(t *testing.T) {
+	kubeletRootDir := t.TempDir()
+	t.Setenv("KUBELET_ROOT_DIR", kubeletRootDir)
+	outsideDir := t.TempDir()
+
+	podVolumesDir := filepath.Join(kubeletRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi")
+	assert.Nil(t, os.MkdirAll(filepath.Join(podVolumesDir, "pv-ok"), 0750))
+	assert.Nil(t, os.MkdirAll(filepath.Join(podVolumesDir, "pv-mounted", "mount"), 0750))
+	// target directory swapped with a symlink to another location
+	assert.Nil(t, os.Symlink(outsideDir, filepath.Join(podVolumesDir, "pv-swapped")))
+	// symlink to another pod directory under the kubelet root directory
+	assert.Nil(t, os.Symlink(filepath.Join(podVolumesDir, "pv-ok"), filepath.Join(podVolumesDir, "pv-other")))
+
+	testCases := []struct {
+		name       string
+		targetPath string
+		expErr     bool
+	}{
+		{
+			name:       "Target not created yet",
+			targetPath: filepath.Join(podVolumesDir, "pv-ok", "mount"),
+		},
+		{
+			name:       "Existing target",
+			targetPath: filepath.Join(podVolumesDir, "pv-mounted", "mount"),
+		},
+		{
+			name:       "Block volume target",
+			targetPath: filepath.Join(kubeletRootDir, "plugins", "kubernetes.io", "csi", "volumeDevices", "publish", "pv", "pod-uid"),
+		},
+		{
+			name:       "Target outside of the kubelet directories",
+			targetPath: filepath.Join(outsideDir, "mount"),
+			expErr:     true,
+		},
+		{
+			name:       "Target escaping the kubelet directories",
+			targetPath: filepath.Join(podVolumesDir, "..", "..", "..", "..", "etc"),
+			expErr:     true,
+		},
+		{
+			name:       "Relative target",
+			targetPath: "pods/pod-uid/volumes/kubernetes.io~csi/pv-ok/mount",
+			expErr:     true,
+		},
+		{
+			name:       "Target symlinked outside of the kubelet directories",
+			targetPath: filepath.Join(podVolumesDir, "pv-swapped", "mount"),
+			expErr:     true,
+		},
+		{
+			name:       "Target symlinked to another pod volume",
+			targetPath: filepath.Join(podVolumesDir, "pv-other", "mount"),
+			expErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTargetPath(tc.targetPath)
+			assert.Equal(t, tc.expErr, err != nil, "error: %v", err)
+		})
+	}
+
+	// kubelet root directory reached through a symlink
+	linkedRootDir := filepath.Join(t.TempDir(), "kubelet")
+	assert.Nil(t, os.Symlink(kubeletRootDir, linkedRootDir))
+	t.Setenv("KUBELET_ROOT_DIR", linkedRootDir)
+	assert.Nil(t, validateTargetPath(filepath.Join(linkedRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv-mounted", "mount")))
+	assert.NotNil(t, validateTargetPath(filepath.Join(linkedRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv-swapped", "mount")))
+
+	// IKS kubelet root directory
+	iksRootDir := filepath.Join(t.TempDir(), "var", "data", "kubelet")
+	assert.Nil(t, os.MkdirAll(filepath.Join(iksRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv"), 0750))
+	iksTargetPath := filepath.Join(iksRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv", "mount")
+	t.Setenv("KUBELET_ROOT_DIR", iksRootDir)
+	assert.Nil(t, validateTargetPath(iksTargetPath))
+
+	// check skipped when the kubelet root directory is not set
+	t.Setenv("KUBELET_ROOT_DIR", "")
+	assert.Nil(t, validateTargetPath("/var/data/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/pv/mount"))
+	assert.Nil(t, validateTargetPath(iksTargetPath))
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"time"
+
+	nodeMetadata "github.com/IBM/ibm-csi-common/pkg/metadata"
+	"go.uber.org/zap"
+)
+
+const (
+	// metadataRetryAttemptsEnv is the number of attempts made to fetch node metadata at startup
+	metadataRetryAttemptsEnv = "METADATA_RETRY_ATTEMPTS"
+	// metadataRetryMaxBackoffEnv caps the wait between two attempts, in seconds
+	metadataRetryMaxBackoffEnv = "METADATA_RETRY_MAX_BACKOFF"
+
+	defaultMetadataRetryAttempts   = 5
+	defaultMetadataRetryMaxBackoff = 30
+)
+
+// metadataRetryInitialBackoff is the wait after the first failed attempt, doubled after every further failure
+var metadataRetryInitialBackoff = time.Second
+
+// newNodeMetadataWithRetry fetches the node metadata, retrying with exponential backoff
+// since the metadata service may not be reachable yet right after the node boots
+func newNodeMetadataWithRetry(logger *zap.Logger, nodeInfo nodeMetadata.NodeInfo) (nodeMetadata.NodeMetadata, error) {
+	attempts := getNonNegativeIntEnv(logger, metadataRetryAttemptsEnv, defaultMetadataRetryAttempts)
+	if attempts == 0 {
+		attempts = 1
+	}
+	maxBackoff := time.Duration(getNonNegativeIntEnv(logger, metadataRetryMaxBackoffEnv, defaultMetadataRetryMaxBackoff)) * time.Second
+
+	backoff := metadataRetryInitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var metadata nodeMetadata.NodeMetadata
+		metadata, err = nodeInfo.NewNodeMetadata(logger)
+		if err == nil {
+			logger.Info("Fetched node metadata", zap.Int("Attempt", attempt))
+			return metadata, nil
+		}
+		if attempt >= attempts {
+			break
+		}
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		logger.Warn("Failed to fetch node metadata, retrying", zap.Int("Attempt", attempt), zap.Int("MaxAttempts", attempts), zap.Duration("RetryAfter", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	logger.Error("Failed to fetch node metadata", zap.Int("Attempts", attempts), zap.Error(err))
+	return nil, err
+}
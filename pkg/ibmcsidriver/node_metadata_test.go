@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	nodeMetadata "github.com/IBM/ibm-csi-common/pkg/metadata"
+	nodeInfo "github.com/IBM/ibm-csi-common/pkg/metadata/fake"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNodeMetadataWithRetry(t *testing.T) {
+	oldBackoff := metadataRetryInitialBackoff
+	metadataRetryInitialBackoff = time.Millisecond
+	defer func() { metadataRetryInitialBackoff = oldBackoff }()
+
+	testCases := []struct {
+		name          string
+		attempts      string
+		failedCalls   int
+		expectedCalls int
+		expectErr     bool
+	}{
+		{name: "Available at first attempt", attempts: "3", failedCalls: 0, expectedCalls: 1},
+		{name: "Available after failed attempts", attempts: "3", failedCalls: 2, expectedCalls: 3},
+		{name: "Never available", attempts: "3", failedCalls: 5, expectedCalls: 3, expectErr: true},
+		{name: "Zero attempts still tries once", attempts: "0", failedCalls: 1, expectedCalls: 1, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, teardown := cloudProvider.GetTestLogger(t)
+			defer teardown()
+			t.Setenv(metadataRetryAttemptsEnv, tc.attempts)
+
+			fakeNodeData := nodeMetadata.FakeNodeMetadata{}
+			fakeNodeData.GetRegionReturns("testregion")
+			fakeNodeInfo := nodeInfo.FakeNodeInfo{}
+			fakeNodeInfo.NewNodeMetadataReturns(&fakeNodeData, nil)
+			for i := 0; i < tc.failedCalls; i++ {
+				fakeNodeInfo.NewNodeMetadataReturnsOnCall(i, nil, errors.New("metadata service unavailable"))
+			}
+
+			metadata, err := newNodeMetadataWithRetry(logger, &fakeNodeInfo)
+			assert.Equal(t, tc.expectedCalls, fakeNodeInfo.NewNodeMetadataCallCount())
+			if tc.expectErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, metadata)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, "testregion", metadata.GetRegion())
+			}
+		})
+	}
+}
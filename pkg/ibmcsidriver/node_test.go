@@ -21,19 +21,23 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"k8s.io/utils/exec"
 	testingexec "k8s.io/utils/exec/testing"
 
+	mountManager "github.com/IBM/ibm-csi-common/pkg/mountmanager"
 	"github.com/IBM/ibm-csi-common/pkg/utils"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	mount "k8s.io/mount-utils"
 )
 
 const defaultVolumeID = "csiprovidervolumeid"
@@ -73,6 +77,9 @@ func (su *MockStatUtils) IsDevicePathNotExist(devicePath string) bool {
 }
 
 func TestNodePublishVolume(t *testing.T) {
+	kubeletRootDir := t.TempDir()
+	t.Setenv("KUBELET_ROOT_DIR", kubeletRootDir)
+	targetPath := filepath.Join(kubeletRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv", "mount")
 	testCases := []struct {
 		name       string
 		req        *csi.NodePublishVolumeRequest
@@ -82,7 +89,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Valid request",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          defaultVolumeID,
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				Readonly:          false,
 				VolumeCapability:  stdVolCap[0],
@@ -93,7 +100,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Empty volume ID",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          "",
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				Readonly:          false,
 				VolumeCapability:  stdVolCap[0],
@@ -104,7 +111,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Empty staging target path",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          "testvolumeid",
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: "",
 				Readonly:          false,
 				VolumeCapability:  stdVolCap[0],
@@ -126,7 +133,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Empty volume capabilities",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          "testvolumeid",
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				Readonly:          false,
 				VolumeCapability:  nil,
@@ -137,7 +144,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Not supported volume capabilities",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          "testvolumeid",
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				Readonly:          false,
 				VolumeCapability:  stdVolCapNotSupported[0],
@@ -148,7 +155,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Raw block request with validdevice",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          defaultVolumeID,
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/sda"},
 				Readonly:          false,
@@ -160,7 +167,7 @@ func TestNodePublishVolume(t *testing.T) {
 			name: "Raw block request with invaliddevice",
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:          defaultVolumeID,
-				TargetPath:        defaultTargetPath,
+				TargetPath:        targetPath,
 				StagingTargetPath: defaultStagingPath,
 				PublishContext:    map[string]string{PublishInfoDevicePath: ""},
 				Readonly:          false,
@@ -180,6 +187,17 @@ func TestNodePublishVolume(t *testing.T) {
 			},
 			expErrCode: codes.InvalidArgument,
 		},
+		{
+			name: "Target path outside of the kubelet directory",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          defaultVolumeID,
+				TargetPath:        defaultTargetPath,
+				StagingTargetPath: defaultStagingPath,
+				Readonly:          false,
+				VolumeCapability:  stdVolCap[0],
+			},
+			expErrCode: codes.InvalidArgument,
+		},
 	}
 
 	icDriver := initIBMCSIDriver(t)
@@ -256,6 +274,61 @@ func TestNodeUnpublishVolume(t *testing.T) {
 	}
 }
 
+func TestNodeUnpublishVolumeIdempotent(t *testing.T) {
+	testCases := []struct {
+		name        string
+		createDir   bool
+		mounted     bool
+		unmountFunc mount.UnmountFunc
+	}{
+		{
+			name: "Target already unmounted and removed",
+		},
+		{
+			name:      "Target mounted",
+			createDir: true,
+			mounted:   true,
+		},
+		{
+			name:      "Target unmounted but directory not removed",
+			createDir: true,
+		},
+		{
+			name:      "Target unmounted outside of the driver",
+			createDir: true,
+			mounted:   true,
+			unmountFunc: func(path string) error {
+				return fmt.Errorf("umount: %s: not mounted", path)
+			},
+		},
+	}
+
+	icDriver := initIBMCSIDriver(t)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targetPath := t.TempDir() + "/target"
+			fakeMounter := &mount.FakeMounter{UnmountFunc: tc.unmountFunc}
+			if tc.createDir {
+				assert.Nil(t, os.Mkdir(targetPath, 0750))
+			}
+			if tc.mounted {
+				fakeMounter.MountPoints = []mount.MountPoint{{Device: "/dev/vdb", Path: targetPath, Type: "ext4"}}
+			}
+			icDriver.ns.Mounter = &mountManager.FakeNodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: fakeMounter}}
+
+			req := &csi.NodeUnpublishVolumeRequest{VolumeId: defaultVolumeID, TargetPath: targetPath}
+			_, err := icDriver.ns.NodeUnpublishVolume(context.Background(), req)
+			assert.Nil(t, err)
+			_, err = os.Stat(targetPath)
+			assert.True(t, os.IsNotExist(err))
+
+			// a retried call must succeed as well
+			_, err = icDriver.ns.NodeUnpublishVolume(context.Background(), req)
+			assert.Nil(t, err)
+		})
+	}
+}
+
 func TestNodeStageVolume(t *testing.T) {
 	volumeID := "newstagevolumeID"
 	testCases := []struct {
@@ -326,13 +399,26 @@ func TestNodeStageVolume(t *testing.T) {
 		{
 			name: "Valid raw block StageVolume request",
 			req: &csi.NodeStageVolumeRequest{
-				VolumeId:          volumeID,
+				VolumeId:          "newblockstagevolumeID",
 				StagingTargetPath: defaultStagingPath,
 				VolumeCapability:  stdBlockVolCap[0],
 				PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/sda"},
 			},
 			expErrCode: codes.OK,
 		},
+		{
+			name: "Mount option not allowed",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "newoptionsstagevolumeID",
+				StagingTargetPath: "/staging-options",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4", MountFlags: []string{"noatime", "suid"}}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				},
+				PublishContext: map[string]string{PublishInfoDevicePath: "/dev"},
+			},
+			expErrCode: codes.InvalidArgument,
+		},
 	}
 
 	actionList := []testingexec.FakeCommandAction{
@@ -388,6 +474,8 @@ func TestNodeStageVolume(t *testing.T) {
 		),
 	}
 
+	// ext4 volumes use the built-in allowlist
+	t.Setenv("MOUNT_OPTIONS_ALLOWLIST", "xfs:*")
 	icDriver := initIBMCSIDriver(t, actionList...)
 	for _, tc := range testCases {
 		t.Logf("Test case: %s", tc.name)
@@ -408,6 +496,193 @@ func TestNodeStageVolume(t *testing.T) {
 	}
 }
 
+// fakeOutputCmd returns a command action which outputs the text
+func fakeOutputCmd(cmd string, output string) testingexec.FakeCommandAction {
+	return makeFakeCmd(&testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+		func() ([]byte, []byte, error) { return []byte(output), nil, nil },
+	}}, cmd)
+}
+
+func TestNodeStageVolumeExistingFsType(t *testing.T) {
+	// Applied by the controller only
+	t.Setenv("DEFAULT_FS_TYPE", "ext4")
+	// Device already formatted with xfs, the file system fills the 1GiB device
+	icDriver := initIBMCSIDriver(t,
+		fakeOutputCmd("blkid", "DEVNAME=/dev/vdb\nTYPE=xfs"),
+		fakeOutputCmd("blkid", "DEVNAME=/dev/vdb\nTYPE=xfs"),
+		fakeOutputCmd("fsck", ""),
+		fakeOutputCmd("blockdev", "0"),
+		fakeOutputCmd("blockdev", "1073741824"),
+		fakeOutputCmd("blkid", "DEVNAME=/dev/vdb\nTYPE=xfs"),
+		fakeOutputCmd("xfs_io", "geom.bsize = 4096\ngeom.datablocks = 262144"),
+	)
+	safeMounter := icDriver.ns.Mounter.GetSafeFormatAndMount()
+	fakeMounter, ok := safeMounter.Interface.(*mount.FakeMounter)
+	assert.True(t, ok)
+	fakeExec, ok := safeMounter.Exec.(*testingexec.FakeExec)
+	assert.True(t, ok)
+
+	volCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	_, err := icDriver.ns.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+		VolumeId:          "xfsstagevolumeID",
+		StagingTargetPath: "/staging-xfs",
+		VolumeCapability:  volCap,
+		PublishContext:    map[string]string{PublishInfoDevicePath: "/dev"},
+		VolumeContext:     map[string]string{FsType: "ext4"},
+	})
+	assert.Nil(t, err)
+	// mounted as xfs without formatting nor growing the file system
+	assert.Equal(t, 7, fakeExec.CommandCalls)
+	mountPoints, err := fakeMounter.List()
+	assert.Nil(t, err)
+	assert.Contains(t, mountPoints, mount.MountPoint{Device: "/dev", Path: "/staging-xfs", Type: "xfs", Opts: []string{"nouuid", "defaults"}})
+}
+
+func TestGetStageFsType(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+	unformatted := func() testingexec.FakeCommandAction {
+		return makeFakeCmd(&testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+			func() ([]byte, []byte, error) { return nil, nil, &testingexec.FakeExitError{Status: 2} },
+		}}, "blkid")
+	}
+	icDriver := initIBMCSIDriver(t, unformatted(), unformatted(), fakeOutputCmd("blkid", "DEVNAME=/dev/vdb\nTYPE=ext3"))
+	noFsType := &csi.VolumeCapability_MountVolume{}
+
+	// fsType of the volume capability
+	assert.Equal(t, "xfs", icDriver.ns.getStageFsType(context.Background(), logger, &csi.VolumeCapability_MountVolume{FsType: "xfs"}, nil, "/dev/vdb"))
+	// unformatted device, fsType recorded by the controller
+	assert.Equal(t, "xfs", icDriver.ns.getStageFsType(context.Background(), logger, noFsType, map[string]string{FsType: "xfs"}, "/dev/vdb"))
+	// unformatted device of a volume provisioned before the fsType was recorded
+	assert.Equal(t, "ext4", icDriver.ns.getStageFsType(context.Background(), logger, noFsType, nil, "/dev/vdb"))
+	// existing file system
+	assert.Equal(t, "ext3", icDriver.ns.getStageFsType(context.Background(), logger, noFsType, map[string]string{FsType: "xfs"}, "/dev/vdb"))
+}
+
+func TestNodeVolumeAccessTypeConsistency(t *testing.T) {
+	kubeletRootDir := t.TempDir()
+	t.Setenv("KUBELET_ROOT_DIR", kubeletRootDir)
+	targetPath := filepath.Join(kubeletRootDir, "pods", "pod-uid", "volumes", "kubernetes.io~csi", "pv", "mount")
+	testCases := []struct {
+		name          string
+		stagedBlock   bool
+		publishVolCap *csi.VolumeCapability
+		expErrCode    codes.Code
+	}{
+		{
+			name:          "Consistent block",
+			stagedBlock:   true,
+			publishVolCap: stdBlockVolCap[0],
+			expErrCode:    codes.OK,
+		},
+		{
+			name:          "Consistent mount",
+			stagedBlock:   false,
+			publishVolCap: stdVolCap[0],
+			expErrCode:    codes.OK,
+		},
+		{
+			name:          "Staged block, published mount",
+			stagedBlock:   true,
+			publishVolCap: stdVolCap[0],
+			expErrCode:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			icDriver := initIBMCSIDriver(t)
+			icDriver.ns.recordAccessType(defaultVolumeID, tc.stagedBlock)
+
+			_, err := icDriver.ns.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:          defaultVolumeID,
+				TargetPath:        targetPath,
+				StagingTargetPath: defaultStagingPath,
+				PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/sda"},
+				VolumeCapability:  tc.publishVolCap,
+			})
+			assert.Equal(t, tc.expErrCode, status.Code(err))
+		})
+	}
+
+	// Volume staged as block can not be staged again as mount until it is unstaged
+	icDriver := initIBMCSIDriver(t)
+	stageReq := &csi.NodeStageVolumeRequest{
+		VolumeId:          defaultVolumeID,
+		StagingTargetPath: defaultStagingPath,
+		VolumeCapability:  stdBlockVolCap[0],
+		PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/sda"},
+	}
+	_, err := icDriver.ns.NodeStageVolume(context.Background(), stageReq)
+	assert.Nil(t, err)
+	stageReq.VolumeCapability = stdVolCap[0]
+	_, err = icDriver.ns.NodeStageVolume(context.Background(), stageReq)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = icDriver.ns.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{VolumeId: defaultVolumeID, StagingTargetPath: defaultStagingPath})
+	assert.Nil(t, err)
+	assert.Nil(t, icDriver.ns.validateAccessType(defaultVolumeID, false))
+}
+
+func TestNodeBlockVolumeStaging(t *testing.T) {
+	kubeletRootDir := t.TempDir()
+	t.Setenv("KUBELET_ROOT_DIR", kubeletRootDir)
+	targetPath := filepath.Join(kubeletRootDir, "plugins/kubernetes.io/csi/volumeDevices/publish", "pv", "pod-uid")
+
+	icDriver := initIBMCSIDriver(t)
+	safeMounter := icDriver.ns.Mounter.GetSafeFormatAndMount()
+	fakeMounter, ok := safeMounter.Interface.(*mount.FakeMounter)
+	assert.True(t, ok)
+	fakeExec, ok := safeMounter.Exec.(*testingexec.FakeExec)
+	assert.True(t, ok)
+	icDriver.ns.Mounter = &pathExistsMounter{Mounter: icDriver.ns.Mounter, pathExists: func(pathname string) (bool, error) {
+		return pathname == "/dev/vdb", nil
+	}}
+
+	// Staging neither formats nor mounts, and is idempotent
+	stageReq := &csi.NodeStageVolumeRequest{
+		VolumeId:          defaultVolumeID,
+		StagingTargetPath: defaultStagingPath,
+		VolumeCapability:  stdBlockVolCap[0],
+		PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/vdb"},
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := icDriver.ns.NodeStageVolume(context.Background(), stageReq)
+		assert.Nil(t, err)
+		assert.Equal(t, &csi.NodeStageVolumeResponse{}, resp)
+	}
+	assert.Empty(t, fakeMounter.GetLog())
+	assert.Equal(t, 0, fakeExec.CommandCalls)
+
+	// Publishing bind mounts the raw device to the target path
+	_, err := icDriver.ns.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+		VolumeId:          defaultVolumeID,
+		TargetPath:        targetPath,
+		StagingTargetPath: defaultStagingPath,
+		PublishContext:    map[string]string{PublishInfoDevicePath: "/dev/vdb"},
+		VolumeCapability:  stdBlockVolCap[0],
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []mount.FakeAction{{Action: mount.FakeActionMount, Target: targetPath, Source: "/dev/vdb", FSType: ""}}, fakeMounter.GetLog())
+	assert.Equal(t, 0, fakeExec.CommandCalls)
+	mountPoints, err := fakeMounter.List()
+	assert.Nil(t, err)
+	assert.Contains(t, mountPoints, mount.MountPoint{Device: "/dev/vdb", Path: targetPath, Type: "", Opts: []string{"bind"}})
+
+	// Unpublishing removes the bind mount and the device file of the target path, the fake mounter does not create it
+	assert.Nil(t, os.MkdirAll(filepath.Dir(targetPath), 0750))
+	assert.Nil(t, os.WriteFile(targetPath, nil, 0600))
+	_, err = icDriver.ns.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{VolumeId: defaultVolumeID, TargetPath: targetPath})
+	assert.Nil(t, err)
+	mountPoints, err = fakeMounter.List()
+	assert.Nil(t, err)
+	assert.NotContains(t, mountPoints, mount.MountPoint{Device: "/dev/vdb", Path: targetPath, Type: "", Opts: []string{"bind"}})
+	_, err = os.Stat(targetPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestNodeUnstageVolume(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -548,6 +823,7 @@ func TestNodeGetVolumeStats(t *testing.T) {
 						Unit:  1,
 					},
 				},
+				VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"},
 			},
 			expErrCode: codes.OK,
 			expError:   "",
@@ -593,6 +869,7 @@ func TestNodeGetVolumeStats(t *testing.T) {
 						Unit:      2,
 					},
 				},
+				VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"},
 			},
 			expErrCode: codes.OK,
 			expError:   "",
@@ -743,6 +1020,93 @@ func TestNodeExpandVolume(t *testing.T) {
 	_ = os.RemoveAll("valid-vol-path")
 }
 
+// deviceSizeStatUtils reports a fixed block device size
+type deviceSizeStatUtils struct {
+	MockStatUtils
+	deviceSize int64
+}
+
+func (su *deviceSizeStatUtils) DeviceInfo(path string) (int64, error) {
+	return su.deviceSize, nil
+}
+
+func TestNodeExpandVolumeResize(t *testing.T) {
+	fakeOutput := func(output string) testingexec.FakeCommandAction {
+		return makeFakeCmd(&testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(output), nil, nil },
+			},
+		}, "")
+	}
+	// Commands run by mount-utils ResizeFs.NeedResize for an ext4 file system of fsBlocks 1 byte blocks
+	needResizeActions := func(deviceSize, fsBlocks string) []testingexec.FakeCommandAction {
+		return []testingexec.FakeCommandAction{
+			fakeOutput("0"),                                       // blockdev --getro
+			fakeOutput(deviceSize),                                // blockdev --getsize64
+			fakeOutput("DEVNAME=/dev/sdb\nTYPE=ext4"),             // blkid
+			fakeOutput("block size: 1\nblock count: " + fsBlocks), // dumpe2fs
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		deviceSize  int64
+		fakeActions []testingexec.FakeCommandAction
+		expErrCode  codes.Code
+	}{
+		{
+			name:       "Device not grown",
+			deviceSize: 1024,
+			expErrCode: codes.FailedPrecondition,
+		},
+		{
+			name:       "Grow success",
+			deviceSize: 2048,
+			fakeActions: append(append(needResizeActions("2048", "1024"),
+				fakeOutput("")), // resize2fs
+				needResizeActions("2048", "2048")...),
+			expErrCode: codes.OK,
+		},
+		{
+			name:       "Grow noop",
+			deviceSize: 2048,
+			fakeActions: append(append(needResizeActions("2048", "1024"),
+				fakeOutput("")), // resize2fs
+				needResizeActions("2048", "1024")...),
+			expErrCode: codes.Internal,
+		},
+		{
+			name:        "File system already expanded",
+			deviceSize:  2048,
+			fakeActions: needResizeActions("2048", "2048"),
+			expErrCode:  codes.OK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		icDriver := initIBMCSIDriver(t, tc.fakeActions...)
+		icDriver.ns.Stats = &deviceSizeStatUtils{deviceSize: tc.deviceSize}
+		volumePath := t.TempDir()
+		_ = icDriver.ns.Mounter.Mount("resize-devicePath", volumePath, "ext4", []string{})
+
+		req := &csi.NodeExpandVolumeRequest{
+			VolumeId:      defaultVolumeID,
+			VolumePath:    volumePath,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			},
+		}
+		response, err := icDriver.ns.NodeExpandVolume(context.Background(), req)
+		assert.Equal(t, tc.expErrCode, status.Code(err), "%v", err)
+		if tc.expErrCode == codes.OK {
+			assert.Equal(t, int64(2048), response.CapacityBytes)
+		}
+	}
+}
+
 func TestIsBlockDevice(t *testing.T) {
 	testCases := []struct {
 		name          string
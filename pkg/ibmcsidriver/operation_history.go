@@ -0,0 +1,162 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultOperationHistoryVolumes number of volumes for which the operation history is kept
+	defaultOperationHistoryVolumes = 1000
+
+	// defaultOperationHistoryDepth number of operations kept per volume
+	defaultOperationHistoryDepth = 10
+
+	// operationResultSuccess result of a successful operation
+	operationResultSuccess = "success"
+)
+
+// VolumeOperation is an attach/detach operation done by the controller server for a volume
+type VolumeOperation struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Operation    string    `json:"operation"`
+	NodeID       string    `json:"nodeID"`
+	Result       string    `json:"result"`
+	RequestID    string    `json:"requestID"`
+	AttachmentID string    `json:"attachmentID,omitempty"` // VPC volume attachment ID
+}
+
+// volumeOperations operations of a volume, oldest first
+type volumeOperations struct {
+	volumeID   string
+	operations []VolumeOperation
+}
+
+// operationHistory keeps the recent operations of the most recently used volumes.
+// A nil operationHistory does not record anything.
+type operationHistory struct {
+	mutex      sync.Mutex
+	maxVolumes int
+	depth      int
+	volumes    map[string]*list.Element
+	lru        *list.List // most recently used volume first
+}
+
+// newOperationHistory returns a history of depth operations for up to maxVolumes volumes, nil if any of them is not positive
+func newOperationHistory(maxVolumes, depth int) *operationHistory {
+	if maxVolumes <= 0 || depth <= 0 {
+		return nil
+	}
+	return &operationHistory{
+		maxVolumes: maxVolumes,
+		depth:      depth,
+		volumes:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// newVolumeOperationHistory returns the attach/detach operation history of the controller server.
+// VOLUME_OPERATION_HISTORY_VOLUMES sets the number of tracked volumes and VOLUME_OPERATION_HISTORY_DEPTH
+// the number of operations kept per volume, 0 for any of them disables the history.
+func newVolumeOperationHistory(logger *zap.Logger) *operationHistory {
+	maxVolumes := getNonNegativeIntEnv(logger, "VOLUME_OPERATION_HISTORY_VOLUMES", defaultOperationHistoryVolumes)
+	depth := getNonNegativeIntEnv(logger, "VOLUME_OPERATION_HISTORY_DEPTH", defaultOperationHistoryDepth)
+	return newOperationHistory(maxVolumes, depth)
+}
+
+// record adds the operation to the volume history, evicting the least recently used volume if needed
+func (h *operationHistory) record(volumeID string, op VolumeOperation) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var entry *volumeOperations
+	if elem, ok := h.volumes[volumeID]; ok {
+		h.lru.MoveToFront(elem)
+		entry = elem.Value.(*volumeOperations)
+	} else {
+		entry = &volumeOperations{volumeID: volumeID}
+		h.volumes[volumeID] = h.lru.PushFront(entry)
+		if h.lru.Len() > h.maxVolumes {
+			oldest := h.lru.Back()
+			h.lru.Remove(oldest)
+			delete(h.volumes, oldest.Value.(*volumeOperations).volumeID)
+		}
+	}
+	entry.operations = append(entry.operations, op)
+	if len(entry.operations) > h.depth {
+		entry.operations = append([]VolumeOperation(nil), entry.operations[len(entry.operations)-h.depth:]...)
+	}
+}
+
+// get returns a copy of the volume operations, oldest first
+func (h *operationHistory) get(volumeID string) []VolumeOperation {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	elem, ok := h.volumes[volumeID]
+	if !ok {
+		return nil
+	}
+	return append([]VolumeOperation(nil), elem.Value.(*volumeOperations).operations...)
+}
+
+// recordVolumeOperation records the result of an attach/detach operation of the controller server
+func (csiCS *CSIControllerServer) recordVolumeOperation(operation, volumeID, nodeID, requestID, attachmentID string, err error) {
+	result := operationResultSuccess
+	if err != nil {
+		result = err.Error()
+	}
+	csiCS.opHistory.record(volumeID, VolumeOperation{
+		Timestamp:    time.Now(),
+		Operation:    operation,
+		NodeID:       nodeID,
+		Result:       result,
+		RequestID:    requestID,
+		AttachmentID: attachmentID,
+	})
+}
+
+// ServeVolumeOperations serves the recent attach/detach operations of the volume given by the volumeID query parameter
+func (icDriver *IBMCSIDriver) ServeVolumeOperations(w http.ResponseWriter, r *http.Request) {
+	volumeID := r.URL.Query().Get("volumeID")
+	if len(volumeID) == 0 {
+		http.Error(w, "volumeID query parameter is required", http.StatusBadRequest)
+		return
+	}
+	var operations []VolumeOperation
+	if icDriver.cs != nil {
+		operations = icDriver.cs.opHistory.get(volumeID)
+	}
+	if operations == nil {
+		operations = []VolumeOperation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(operations)
+}
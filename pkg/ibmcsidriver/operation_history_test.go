@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestOperationHistory(t *testing.T) {
+	history := newOperationHistory(2, 3)
+	for _, op := range []string{"op1", "op2", "op3", "op4"} {
+		history.record("vol1", VolumeOperation{Operation: op})
+	}
+	history.record("vol2", VolumeOperation{Operation: "op1"})
+
+	// Only the latest operations are kept, oldest first
+	operations := history.get("vol1")
+	assert.Equal(t, 3, len(operations))
+	assert.Equal(t, "op2", operations[0].Operation)
+	assert.Equal(t, "op4", operations[2].Operation)
+
+	// Least recently used volume is evicted
+	history.record("vol3", VolumeOperation{Operation: "op1"})
+	assert.Nil(t, history.get("vol1"))
+	assert.Equal(t, 1, len(history.get("vol2")))
+	assert.Equal(t, 1, len(history.get("vol3")))
+
+	// Disabled history
+	assert.Nil(t, newOperationHistory(0, 3))
+	var noHistory *operationHistory
+	noHistory.record("vol1", VolumeOperation{Operation: "op1"})
+	assert.Nil(t, noHistory.get("vol1"))
+}
+
+func TestOperationHistoryConcurrentAccess(t *testing.T) {
+	history := newOperationHistory(5, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			volumeID := "vol" + strconv.Itoa(i%10)
+			for j := 0; j < 50; j++ {
+				history.record(volumeID, VolumeOperation{Operation: "op" + strconv.Itoa(j)})
+				assert.LessOrEqual(t, len(history.get(volumeID)), 3)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, history.lru.Len(), 5)
+	assert.Equal(t, history.lru.Len(), len(history.volumes))
+}
+
+func TestVolumeOperationsRecorded(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.Equal(t, true, ok)
+	attachResponse := &provider.VolumeAttachmentResponse{VolumeAttachmentRequest: provider.VolumeAttachmentRequest{VolumeID: "vol123", InstanceID: "node123", VPCVolumeAttachment: &provider.VolumeAttachment{ID: "attachment123", DevicePath: "/tmp"}}}
+	fakeStructSession.GetVolumeReturns(&provider.Volume{VolumeID: "vol123"}, nil)
+	fakeStructSession.AttachVolumeReturns(attachResponse, nil)
+	fakeStructSession.WaitForAttachVolumeReturns(attachResponse, nil)
+	fakeStructSession.WaitForDetachVolumeReturns(providerError.Message{Description: "detach timed out"})
+
+	publishReq := &csi.ControllerPublishVolumeRequest{VolumeId: "vol123", NodeId: "node123", VolumeCapability: &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}}
+	_, err = icDriver.cs.ControllerPublishVolume(context.Background(), publishReq)
+	assert.Nil(t, err)
+	_, err = icDriver.cs.ControllerUnpublishVolume(context.Background(), &csi.ControllerUnpublishVolumeRequest{VolumeId: "vol123", NodeId: "node123"})
+	assert.NotNil(t, err)
+	// Invalid requests are not recorded
+	_, err = icDriver.cs.ControllerUnpublishVolume(context.Background(), &csi.ControllerUnpublishVolumeRequest{VolumeId: "vol123"})
+	assert.NotNil(t, err)
+
+	// Retrieve the history from the debug endpoint
+	w := httptest.NewRecorder()
+	icDriver.ServeVolumeOperations(w, httptest.NewRequest(http.MethodGet, "/debug/volume-operations?volumeID=vol123", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var operations []VolumeOperation
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &operations))
+	assert.Equal(t, 2, len(operations))
+	assert.Equal(t, "ControllerPublishVolume", operations[0].Operation)
+	assert.Equal(t, "node123", operations[0].NodeID)
+	assert.Equal(t, operationResultSuccess, operations[0].Result)
+	assert.Equal(t, "attachment123", operations[0].AttachmentID)
+	assert.NotEmpty(t, operations[0].RequestID)
+	assert.Equal(t, "ControllerUnpublishVolume", operations[1].Operation)
+	assert.Contains(t, operations[1].Result, "detach timed out")
+
+	// Unknown volume
+	w = httptest.NewRecorder()
+	icDriver.ServeVolumeOperations(w, httptest.NewRequest(http.MethodGet, "/debug/volume-operations?volumeID=unknown", nil))
+	assert.Equal(t, "[]", w.Body.String()[:2])
+
+	// Missing volume ID
+	w = httptest.NewRecorder()
+	icDriver.ServeVolumeOperations(w, httptest.NewRequest(http.MethodGet, "/debug/volume-operations", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
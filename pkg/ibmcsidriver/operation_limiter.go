@@ -0,0 +1,207 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultMaxQueuedSnapshotOperations number of snapshot operations allowed to wait for a free slot
+	defaultMaxQueuedSnapshotOperations = 100
+
+	// defaultMaxQueuedFSResizes number of file system resizes allowed to wait for a free slot
+	defaultMaxQueuedFSResizes = 100
+
+	// defaultMaxQueuedVolumeExpansions number of volume expansions allowed to wait for a free slot
+	defaultMaxQueuedVolumeExpansions = 100
+)
+
+// errOperationQueueFull is returned when the limiter queue is saturated
+var errOperationQueueFull = errors.New("too many operations are waiting to be processed")
+
+// operationLimiter limits the number of concurrent operations, excess operations wait in a
+// bounded queue for a free slot. A nil operationLimiter does not limit anything.
+type operationLimiter struct {
+	slots     chan struct{}
+	maxQueued int32
+	queued    atomic.Int32
+
+	inflightGauge prometheus.Gauge
+	queuedGauge   prometheus.Gauge
+}
+
+// newOperationLimiter returns a limiter allowing maxInflight concurrent operations, nil if maxInflight is not positive
+func newOperationLimiter(maxInflight, maxQueued int, inflightGauge, queuedGauge prometheus.Gauge) *operationLimiter {
+	if maxInflight <= 0 {
+		return nil
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+	return &operationLimiter{
+		slots:         make(chan struct{}, maxInflight),
+		maxQueued:     int32(maxQueued),
+		inflightGauge: inflightGauge,
+		queuedGauge:   queuedGauge,
+	}
+}
+
+// acquire waits for a free slot. It returns errOperationQueueFull if the queue is saturated
+// and the context error if the context is done while waiting.
+func (l *operationLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.inflightGauge.Inc()
+		return nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		return errOperationQueueFull
+	}
+	l.queuedGauge.Inc()
+	defer func() {
+		l.queued.Add(-1)
+		l.queuedGauge.Dec()
+	}()
+
+	select {
+	case l.slots <- struct{}{}:
+		l.inflightGauge.Inc()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire
+func (l *operationLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+	l.inflightGauge.Dec()
+}
+
+// newSnapshotOperationLimiter returns the limiter shared by CreateSnapshot and DeleteSnapshot.
+// MAX_INFLIGHT_SNAPSHOT_OPERATIONS sets the number of concurrent snapshot operations (unset or 0 means no limit)
+// and MAX_QUEUED_SNAPSHOT_OPERATIONS the number of operations allowed to wait for a free slot.
+func newSnapshotOperationLimiter(logger *zap.Logger) *operationLimiter {
+	maxInflight := getNonNegativeIntEnv(logger, "MAX_INFLIGHT_SNAPSHOT_OPERATIONS", 0)
+	maxQueued := getNonNegativeIntEnv(logger, "MAX_QUEUED_SNAPSHOT_OPERATIONS", defaultMaxQueuedSnapshotOperations)
+	if maxInflight > 0 && logger != nil {
+		logger.Info("Limiting concurrent snapshot operations", zap.Int("MaxInflight", maxInflight), zap.Int("MaxQueued", maxQueued))
+	}
+	return newOperationLimiter(maxInflight, maxQueued, snapshotOperationsInflight, snapshotOperationsQueued)
+}
+
+// newFSResizeLimiter returns the limiter of the NodeExpandVolume file system resizes of the node.
+// MAX_CONCURRENT_FS_RESIZES sets the number of concurrent resizes (unset or 0 means no limit)
+// and MAX_QUEUED_FS_RESIZES the number of resizes allowed to wait for a free slot.
+func newFSResizeLimiter(logger *zap.Logger) *operationLimiter {
+	maxInflight := getNonNegativeIntEnv(logger, "MAX_CONCURRENT_FS_RESIZES", 0)
+	maxQueued := getNonNegativeIntEnv(logger, "MAX_QUEUED_FS_RESIZES", defaultMaxQueuedFSResizes)
+	if maxInflight > 0 && logger != nil {
+		logger.Info("Limiting concurrent file system resizes", zap.Int("MaxInflight", maxInflight), zap.Int("MaxQueued", maxQueued))
+	}
+	return newOperationLimiter(maxInflight, maxQueued, fsResizesInflight, fsResizesQueued)
+}
+
+// newVolumeExpansionLimiter returns the limiter of the ControllerExpandVolume backend expansions.
+// MAX_INFLIGHT_VOLUME_EXPANSIONS sets the number of concurrent expansions (unset or 0 means no limit)
+// and MAX_QUEUED_VOLUME_EXPANSIONS the number of expansions allowed to wait for a free slot.
+func newVolumeExpansionLimiter(logger *zap.Logger) *operationLimiter {
+	maxInflight := getNonNegativeIntEnv(logger, "MAX_INFLIGHT_VOLUME_EXPANSIONS", 0)
+	maxQueued := getNonNegativeIntEnv(logger, "MAX_QUEUED_VOLUME_EXPANSIONS", defaultMaxQueuedVolumeExpansions)
+	if maxInflight > 0 && logger != nil {
+		logger.Info("Limiting concurrent volume expansions", zap.Int("MaxInflight", maxInflight), zap.Int("MaxQueued", maxQueued))
+	}
+	return newOperationLimiter(maxInflight, maxQueued, volumeExpansionsInflight, volumeExpansionsQueued)
+}
+
+// acquireOperationSlot waits for a free slot of the limiter, a retryable error is returned
+// if too many operations are already waiting or the request is cancelled meanwhile
+func acquireOperationSlot(ctx context.Context, ctxLogger *zap.Logger, limiter *operationLimiter, operation string) error {
+	err := limiter.acquire(ctx)
+	if err == nil {
+		return nil
+	}
+	ctxLogger.Warn("Unable to start operation", zap.String("Operation", operation), zap.Error(err))
+	if errors.Is(err, errOperationQueueFull) {
+		return status.Errorf(codes.Unavailable, "%s operation not started: %v, retry later", operation, err)
+	}
+	return contextError(ctx)
+}
+
+// acquireSnapshotSlot waits for a free snapshot operation slot
+func (csiCS *CSIControllerServer) acquireSnapshotSlot(ctx context.Context, ctxLogger *zap.Logger) error {
+	return acquireOperationSlot(ctx, ctxLogger, csiCS.snapshotLimiter, "Snapshot")
+}
+
+// acquireExpandSlot waits for a free volume expansion slot
+func (csiCS *CSIControllerServer) acquireExpandSlot(ctx context.Context, ctxLogger *zap.Logger) error {
+	return acquireOperationSlot(ctx, ctxLogger, csiCS.expandLimiter, "Volume expansion")
+}
+
+// acquireResizeSlot serializes the resizes of a volume and waits for a free resize slot, resizes
+// of distinct volumes run concurrently up to MAX_CONCURRENT_FS_RESIZES. releaseResizeSlot must be
+// called once the resize is done if no error is returned.
+func (csiNS *CSINodeServer) acquireResizeSlot(ctx context.Context, ctxLogger *zap.Logger, volumeID string) error {
+	csiNS.volumeLocks.Lock(volumeID)
+	if err := acquireOperationSlot(ctx, ctxLogger, csiNS.resizeLimiter, "File system resize"); err != nil {
+		csiNS.volumeLocks.Unlock(volumeID)
+		return err
+	}
+	return nil
+}
+
+// releaseResizeSlot frees the resize slot and the volume lock taken by acquireResizeSlot
+func (csiNS *CSINodeServer) releaseResizeSlot(volumeID string) {
+	csiNS.resizeLimiter.release()
+	csiNS.volumeLocks.Unlock(volumeID)
+}
+
+// getNonNegativeIntEnv returns the integer value of the env, defaultValue if unset or invalid
+func getNonNegativeIntEnv(logger *zap.Logger, envName string, defaultValue int) int {
+	envValue := os.Getenv(envName)
+	if envValue == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(envValue)
+	if err != nil || value < 0 {
+		if logger != nil {
+			logger.Warn("Invalid value, expecting non negative integer", zap.String("Env", envName), zap.String("Value", envValue), zap.Int("Considered value", defaultValue))
+		}
+		return defaultValue
+	}
+	return value
+}
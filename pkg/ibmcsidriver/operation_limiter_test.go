@@ -0,0 +1,270 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSnapshotOperationLimiter(t *testing.T) {
+	t.Setenv("MAX_INFLIGHT_SNAPSHOT_OPERATIONS", "2")
+	t.Setenv("MAX_QUEUED_SNAPSHOT_OPERATIONS", "3")
+
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.Equal(t, true, ok)
+
+	var inflight, maxInflight atomic.Int32
+	unblock := make(chan struct{})
+	fakeStructSession.DeleteSnapshotStub = func(*provider.Snapshot) error {
+		current := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			seen := maxInflight.Load()
+			if current <= seen || maxInflight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		<-unblock
+		return nil
+	}
+
+	// 2 snapshot operations in flight and 3 queued
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := icDriver.cs.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-id"})
+			assert.Nil(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return inflight.Load() == 2 && icDriver.cs.snapshotLimiter.queued.Load() == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Queue is saturated, request is rejected with retryable error
+	_, err = icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInflight.Load())
+	assert.Equal(t, 5, fakeStructSession.DeleteSnapshotCallCount())
+	assert.Equal(t, int32(0), icDriver.cs.snapshotLimiter.queued.Load())
+	assert.Equal(t, 0, len(icDriver.cs.snapshotLimiter.slots))
+}
+
+func TestNewSnapshotOperationLimiter(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// No limit by default
+	assert.Nil(t, newSnapshotOperationLimiter(logger))
+
+	t.Setenv("MAX_INFLIGHT_SNAPSHOT_OPERATIONS", "4")
+	t.Setenv("MAX_QUEUED_SNAPSHOT_OPERATIONS", "invalid")
+	limiter := newSnapshotOperationLimiter(logger)
+	assert.NotNil(t, limiter)
+	assert.Equal(t, 4, cap(limiter.slots))
+	assert.Equal(t, int32(defaultMaxQueuedSnapshotOperations), limiter.maxQueued)
+
+	// Queued operation is cancelled by the caller
+	limiter = newOperationLimiter(1, 1, snapshotOperationsInflight, snapshotOperationsQueued)
+	assert.Nil(t, limiter.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.acquire(ctx))
+	assert.Equal(t, int32(0), limiter.queued.Load())
+	limiter.release()
+	assert.Equal(t, 0, len(limiter.slots))
+
+	// nil limiter never blocks
+	var noLimiter *operationLimiter
+	assert.Nil(t, noLimiter.acquire(context.Background()))
+	noLimiter.release()
+}
+
+func TestVolumeExpansionLimiter(t *testing.T) {
+	t.Setenv("MAX_INFLIGHT_VOLUME_EXPANSIONS", "2")
+	t.Setenv("MAX_QUEUED_VOLUME_EXPANSIONS", "3")
+
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.Equal(t, true, ok)
+
+	fakeStructSession.GetVolumeStub = func(string) (*provider.Volume, error) {
+		capacity := 10
+		return &provider.Volume{VolumeID: "vol-id", Capacity: &capacity}, nil
+	}
+	var inflight, maxInflight atomic.Int32
+	unblock := make(chan struct{})
+	fakeStructSession.ExpandVolumeStub = func(provider.ExpandVolumeRequest) (int64, error) {
+		current := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			seen := maxInflight.Load()
+			if current <= seen || maxInflight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		<-unblock
+		return stdCapRange.RequiredBytes, nil
+	}
+
+	// 2 volume expansions in flight and 3 queued
+	req := &csi.ControllerExpandVolumeRequest{VolumeId: "vol-id", CapacityRange: stdCapRange}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := icDriver.cs.ControllerExpandVolume(context.Background(), req)
+			assert.Nil(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return inflight.Load() == 2 && icDriver.cs.expandLimiter.queued.Load() == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Queue is saturated, request is rejected with retryable error
+	_, err = icDriver.cs.ControllerExpandVolume(context.Background(), req)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInflight.Load())
+	assert.Equal(t, 5, fakeStructSession.ExpandVolumeCallCount())
+	assert.Equal(t, int32(0), icDriver.cs.expandLimiter.queued.Load())
+	assert.Equal(t, 0, len(icDriver.cs.expandLimiter.slots))
+}
+
+func TestResizeSlot(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_FS_RESIZES", "2")
+	icDriver := initIBMCSIDriver(t)
+	csiNS := icDriver.ns
+	assert.Equal(t, 2, cap(csiNS.resizeLimiter.slots))
+
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	// Resizes of two distinct volumes proceed concurrently under the cap
+	var inflight atomic.Int32
+	bothInflight := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, volumeID := range []string{"vol-1", "vol-2"} {
+		wg.Add(1)
+		go func(volumeID string) {
+			defer wg.Done()
+			assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, volumeID))
+			defer csiNS.releaseResizeSlot(volumeID)
+			if inflight.Add(1) == 2 {
+				close(bothInflight)
+			}
+			select {
+			case <-bothInflight:
+			case <-time.After(5 * time.Second):
+				t.Errorf("resize of %s did not run concurrently", volumeID)
+			}
+		}(volumeID)
+	}
+	wg.Wait()
+
+	// Second resize of the same volume waits for the first one
+	assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, "vol-1"))
+	acquired := make(chan struct{})
+	go func() {
+		assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, "vol-1"))
+		close(acquired)
+		csiNS.releaseResizeSlot("vol-1")
+	}()
+	assert.Never(t, func() bool {
+		select {
+		case <-acquired:
+			return true
+		default:
+			return false
+		}
+	}, 100*time.Millisecond, 10*time.Millisecond)
+	csiNS.releaseResizeSlot("vol-1")
+	<-acquired
+
+	// Cap reached, a resize of a third volume is cancelled while waiting and releases the volume lock
+	assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, "vol-1"))
+	assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, "vol-2"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(csiNS.acquireResizeSlot(ctx, logger, "vol-3")))
+	csiNS.releaseResizeSlot("vol-1")
+	csiNS.releaseResizeSlot("vol-2")
+	assert.Nil(t, csiNS.acquireResizeSlot(context.Background(), logger, "vol-3"))
+	csiNS.releaseResizeSlot("vol-3")
+	assert.Equal(t, 0, len(csiNS.resizeLimiter.slots))
+}
+
+func TestCreateSnapshotFailureReleasesSlot(t *testing.T) {
+	t.Setenv("MAX_INFLIGHT_SNAPSHOT_OPERATIONS", "1")
+	t.Setenv("CUSTOM_SNAPSHOT_CREATE_DELAY", "1")
+
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.Equal(t, true, ok)
+	fakeStructSession.CreateSnapshotReturns(nil, errors.New("snapshot creation failed"))
+
+	// the failed creation backs off without holding the only slot
+	done := make(chan error)
+	go func() {
+		_, err := icDriver.cs.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap", SourceVolumeId: "vol-id"})
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return fakeStructSession.CreateSnapshotCallCount() == 1 && len(icDriver.cs.snapshotLimiter.slots) == 0
+	}, time.Second, 10*time.Millisecond)
+	_, err = icDriver.cs.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-id"})
+	assert.Nil(t, err)
+	assert.NotNil(t, <-done)
+	assert.Equal(t, 0, len(icDriver.cs.snapshotLimiter.slots))
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// providerHealthCheck checks that the controller can reach the VPC API with its credentials. The result is cached
+// so that frequent probes do not hammer the API.
+type providerHealthCheck struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	err     error
+	expires time.Time
+}
+
+// newProviderHealthCheck returns the VPC API health check of the controller. PROVIDER_HEALTH_CHECK_TIMEOUT sets the
+// seconds the check may take (default 2, 0 disables the check) and PROVIDER_HEALTH_CHECK_CACHE the seconds its result
+// is cached (default 30). The timeout must stay below the --probe-timeout of the liveness-probe sidecar, else the
+// sidecar gives up first. Node servers make no VPC API calls and are not checked.
+func newProviderHealthCheck(logger *zap.Logger) *providerHealthCheck {
+	if os.Getenv("IS_NODE_SERVER") == "true" {
+		return nil
+	}
+	timeout := getNonNegativeIntEnv(logger, "PROVIDER_HEALTH_CHECK_TIMEOUT", 2)
+	if timeout == 0 {
+		return nil
+	}
+	return &providerHealthCheck{
+		timeout: time.Duration(timeout) * time.Second,
+		ttl:     time.Duration(getNonNegativeIntEnv(logger, "PROVIDER_HEALTH_CHECK_CACHE", 30)) * time.Second,
+	}
+}
+
+// check returns the cached result of the last check, or establishes a provider session and lists a volume to verify
+// the VPC API is reachable. Concurrent callers wait for the check in progress.
+func (h *providerHealthCheck) check(ctxLogger *zap.Logger, csiCS *CSIControllerServer) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Now().Before(h.expires) {
+		return h.err
+	}
+
+	// Not bound to the context of the caller, the result is shared with the other callers
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		// Not rate limited, the check must not wait behind the requests for a VPC API call
+		session, err := csiCS.getUnlimitedProviderSession(ctx, ctxLogger)
+		if err == nil {
+			_, err = session.ListVolumes(1, "", nil)
+		}
+		done <- err
+	}()
+	select {
+	case h.err = <-done:
+	case <-ctx.Done():
+		h.err = fmt.Errorf("VPC API did not respond within %v", h.timeout)
+	}
+	h.expires = time.Now().Add(h.ttl)
+	if h.err != nil {
+		ctxLogger.Warn("VPC API health check failed", zap.Error(h.err))
+	}
+	return h.err
+}
+
+// ServeLiveness reports if the controller can reach the VPC API, so that a controller which lost its credentials
+// is restarted
+func (icDriver *IBMCSIDriver) ServeLiveness(w http.ResponseWriter, r *http.Request) {
+	if icDriver.cs != nil {
+		if err := icDriver.cs.providerHealth.check(icDriver.logger, icDriver.cs); err != nil {
+			http.Error(w, fmt.Sprintf("VPC API not reachable: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestNewProviderHealthCheck(t *testing.T) {
+	check := newProviderHealthCheck(nil)
+	assert.Equal(t, 2*time.Second, check.timeout)
+	assert.Equal(t, 30*time.Second, check.ttl)
+
+	t.Setenv("PROVIDER_HEALTH_CHECK_TIMEOUT", "0")
+	assert.Nil(t, newProviderHealthCheck(nil))
+
+	t.Setenv("PROVIDER_HEALTH_CHECK_TIMEOUT", "2")
+	t.Setenv("IS_NODE_SERVER", "true")
+	assert.Nil(t, newProviderHealthCheck(nil))
+}
+
+func TestProviderHealthCheck(t *testing.T) {
+	// Creating test logger
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, err := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	fakeStructSession, ok := fakeSession.(*fake.FakeSession)
+	assert.True(t, ok)
+	check := &providerHealthCheck{timeout: time.Second, ttl: time.Hour}
+	icDriver.cs.providerHealth = check
+
+	// credentials lost, the result is cached
+	fakeStructSession.ListVolumesReturns(nil, providerError.Message{Code: "AuthenticationFailed", Description: "Failed to authenticate.", Type: providerError.Unauthenticated})
+	assert.NotNil(t, check.check(logger, icDriver.cs))
+	w := httptest.NewRecorder()
+	icDriver.ServeLiveness(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, 1, fakeStructSession.ListVolumesCallCount())
+
+	// checked again once the result expired
+	check.expires = time.Time{}
+	fakeStructSession.ListVolumesReturns(&provider.VolumeList{}, nil)
+	w = httptest.NewRecorder()
+	icDriver.ServeLiveness(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, fakeStructSession.ListVolumesCallCount())
+	limit, start, _ := fakeStructSession.ListVolumesArgsForCall(1)
+	assert.Equal(t, 1, limit)
+	assert.Equal(t, "", start)
+
+	// not waiting for the VPC API rate limiter
+	check.expires = time.Time{}
+	check.timeout = 100 * time.Millisecond
+	icDriver.cs.apiLimiter = newAPIRateLimiter(1, 1)
+	assert.Nil(t, icDriver.cs.apiLimiter.wait(context.Background()))
+	assert.Nil(t, check.check(logger, icDriver.cs))
+	assert.Equal(t, 3, fakeStructSession.ListVolumesCallCount())
+
+	// API not responding
+	check.expires = time.Time{}
+	check.timeout = 10 * time.Millisecond
+	fakeStructSession.ListVolumesStub = func(int, string, map[string]string) (*provider.VolumeList, error) {
+		time.Sleep(time.Second)
+		return &provider.VolumeList{}, nil
+	}
+	assert.ErrorContains(t, check.check(logger, icDriver.cs), "did not respond")
+}
@@ -24,13 +24,19 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/IBM/ibm-csi-common/pkg/utils"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // NonBlockingGRPCServer Defines Non blocking GRPC server interfaces
@@ -43,6 +49,8 @@ type NonBlockingGRPCServer interface {
 	Stop()
 	// Stops the service forcefully
 	ForceStop()
+	// Reports if the service is accepting connections
+	IsReady() bool
 }
 
 // NewNonBlockingGRPCServer ...
@@ -55,6 +63,20 @@ type nonBlockingGRPCServer struct {
 	wg     sync.WaitGroup
 	server *grpc.Server
 	logger *zap.Logger
+	ready  atomic.Bool
+}
+
+// readyListener marks the server ready once the gRPC server starts accepting connections on the listener
+type readyListener struct {
+	net.Listener
+	once  sync.Once
+	ready *atomic.Bool
+}
+
+// Accept ...
+func (l *readyListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { l.ready.Store(true) })
+	return l.Listener.Accept()
 }
 
 // Start ...
@@ -71,20 +93,27 @@ func (s *nonBlockingGRPCServer) Wait() {
 
 // Stop ...
 func (s *nonBlockingGRPCServer) Stop() {
+	s.ready.Store(false)
 	s.server.GracefulStop()
 }
 
 // ForceStop ...
 func (s *nonBlockingGRPCServer) ForceStop() {
+	s.ready.Store(false)
 	s.server.Stop()
 }
 
+// IsReady ...
+func (s *nonBlockingGRPCServer) IsReady() bool {
+	return s.ready.Load()
+}
+
 // Setup ...
 func (s *nonBlockingGRPCServer) Setup(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) (net.Listener, error) {
 	s.logger.Info("nonBlockingGRPCServer-Setup...", zap.Reflect("Endpoint", endpoint))
 
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logGRPC),
+		grpc.ChainUnaryInterceptor(logGRPC, traceGRPC),
 	}
 
 	u, err := url.Parse(endpoint)
@@ -142,7 +171,7 @@ func (s *nonBlockingGRPCServer) Setup(endpoint string, ids csi.IdentityServer, c
 	if ns != nil {
 		csi.RegisterNodeServer(s.server, ns)
 	}
-	go removeCSISocket(addr)
+	go s.removeCSISocket(addr)
 	return listener, nil
 }
 
@@ -155,25 +184,73 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		s.logger.Fatal("Failed to setup GRPC Server", zap.Error(err))
 	}
 	s.logger.Info("Listening GRPC server for connections", zap.Reflect("Addr", listener.Addr()))
-	if err := s.server.Serve(listener); err != nil {
+	if err := s.server.Serve(&readyListener{Listener: listener, ready: &s.ready}); err != nil {
 		s.logger.Info("Failed to serve", zap.Error(err))
 	}
+	s.ready.Store(false)
+}
+
+// polledMethods are called periodically by the liveness probe and kubelet, their calls are logged at debug level
+var polledMethods = map[string]bool{
+	"/csi.v1.Identity/Probe":          true,
+	"/csi.v1.Node/NodeGetVolumeStats": true,
 }
 
-// logGRPC ...
+// logGRPC logs the exit of every CSI call with its request ID, duration and gRPC status code, the request itself
+// is logged by the handler. The request ID is the one set by ControllerPublishVolume in the publish context or
+// supplied by the caller in the gRPC metadata, a new request ID is generated otherwise and set in the incoming
+// metadata so the handler logs with the same request ID.
 func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	glog.V(3).Infof("GRPC call: %s", info.FullMethod)
-	glog.V(5).Infof("GRPC request: %+v", req)
+	requestID := getRequestID(ctx)
+	if publishReq, ok := req.(interface{ GetPublishContext() map[string]string }); ok && publishReq.GetPublishContext()[PublishInfoRequestID] != "" {
+		requestID = publishReq.GetPublishContext()[PublishInfoRequestID]
+	}
+	if requestID == "" {
+		requestID = uuid.New().String()
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		md.Set(requestIDMetadataKey(), requestID)
+		ctx = metadata.NewIncomingContext(ctx, md)
+	}
+
+	start := time.Now()
 	resp, err := handler(ctx, req)
+	ctxLogger, _ := utils.GetContextLoggerWithRequestID(ctx, false, &requestID)
+	fields := []zap.Field{zap.String("Method", info.FullMethod), zap.Duration("Duration", time.Since(start)), zap.String("Code", status.Code(err).String())}
 	if err != nil {
-		glog.Errorf("GRPC error: %v", err)
+		ctxLogger.Error("GRPC call failed", append(fields, zap.Error(err))...)
+	} else if polledMethods[info.FullMethod] {
+		ctxLogger.Debug("GRPC call completed", fields...)
 	} else {
-		glog.V(5).Infof("GRPC response: %+v", resp)
+		ctxLogger.Info("GRPC call completed", fields...)
 	}
 	return resp, err
 }
 
-func removeCSISocket(endPoint string) {
+// defaultShutdownDrainTimeout seconds the in-flight RPCs are given to finish on SIGTERM if SHUTDOWN_DRAIN_TIMEOUT is not set
+const defaultShutdownDrainTimeout = 20
+
+// drain stops accepting new RPCs and waits up to timeout for the in-flight RPCs to finish, the ones still
+// running once the timeout expires are cancelled. It reports if all the in-flight RPCs finished in time.
+func (s *nonBlockingGRPCServer) drain(timeout time.Duration) bool {
+	s.ready.Store(false)
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.logger.Info("In-flight RPCs drained")
+		return true
+	case <-time.After(timeout):
+		s.logger.Warn("Drain timeout expired, cancelling in-flight RPCs", zap.Duration("Timeout", timeout))
+		s.server.Stop()
+		return false
+	}
+}
+
+func (s *nonBlockingGRPCServer) removeCSISocket(endPoint string) {
 	// Reference: https://github.com/kubernetes-csi/node-driver-registrar/blob/master/cmd/csi-node-driver-registrar/node_register.go#L168
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGTERM)
@@ -191,6 +268,11 @@ func removeCSISocket(endPoint string) {
 	csiPluginLibPath := "/var/data/kubelet/csi-plugins/vpc.block.csi.ibm.io/"
 	directoryDelete(csiPluginDataPath)
 	directoryDelete(csiPluginLibPath)
+
+	// Let in-flight operations e.g long attaches complete to avoid leaving half-completed backend state
+	drainTimeout := time.Duration(getNonNegativeIntEnv(s.logger, "SHUTDOWN_DRAIN_TIMEOUT", defaultShutdownDrainTimeout)) * time.Second
+	s.logger.Info("Received SIGTERM, draining in-flight RPCs", zap.Duration("Timeout", drainTimeout))
+	s.drain(drainTimeout)
 	os.Exit(0)
 
 }
@@ -19,10 +19,22 @@ package ibmcsidriver
 
 import (
 	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestSetup(t *testing.T) {
@@ -84,6 +96,160 @@ func TestSetup(t *testing.T) {
 	}
 }
 
+func TestServerReadiness(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	socketPath := filepath.Join(t.TempDir(), "csi.sock")
+	s := NewNonBlockingGRPCServer(logger)
+	assert.False(t, s.IsReady())
+
+	s.Start("unix:"+socketPath, &CSIIdentityServer{}, nil, nil)
+	assert.Eventually(t, s.IsReady, 5*time.Second, 10*time.Millisecond)
+
+	// Ready only once the socket is accepting connections
+	conn, err := net.Dial("unix", socketPath)
+	assert.Nil(t, err)
+	if conn != nil {
+		_ = conn.Close()
+	}
+
+	s.ForceStop()
+	assert.False(t, s.IsReady())
+}
+
+// blockingIdentityServer blocks GetPluginInfo until unblock is closed
+type blockingIdentityServer struct {
+	csi.UnimplementedIdentityServer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+// GetPluginInfo ...
+func (b *blockingIdentityServer) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	close(b.started)
+	select {
+	case <-b.unblock:
+		return &csi.GetPluginInfoResponse{Name: "mydriver"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestServerDrain(t *testing.T) {
+	logger, teardown := cloudProvider.GetTestLogger(t)
+	defer teardown()
+
+	testCases := []struct {
+		name        string
+		timeout     time.Duration
+		finishRPC   bool
+		expDrained  bool
+		expRPCError bool
+	}{
+		{name: "In-flight RPC finishes within the timeout", timeout: 5 * time.Second, finishRPC: true, expDrained: true},
+		{name: "In-flight RPC cancelled after the timeout", timeout: 100 * time.Millisecond, finishRPC: false, expDrained: false, expRPCError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			socketPath := filepath.Join(t.TempDir(), "csi.sock")
+			ids := &blockingIdentityServer{started: make(chan struct{}), unblock: make(chan struct{})}
+			s := NewNonBlockingGRPCServer(logger).(*nonBlockingGRPCServer)
+			s.Start("unix:"+socketPath, ids, nil, nil)
+			assert.Eventually(t, s.IsReady, 5*time.Second, 10*time.Millisecond)
+
+			conn, err := grpc.NewClient("unix:"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			assert.Nil(t, err)
+			defer conn.Close()
+			rpcErr := make(chan error, 1)
+			go func() {
+				_, err := csi.NewIdentityClient(conn).GetPluginInfo(context.Background(), &csi.GetPluginInfoRequest{})
+				rpcErr <- err
+			}()
+			<-ids.started
+
+			drained := make(chan bool, 1)
+			go func() { drained <- s.drain(tc.timeout) }()
+
+			// Shutdown waits for the in-flight RPC
+			assert.Never(t, func() bool { return len(drained) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+			assert.False(t, s.IsReady())
+			if tc.finishRPC {
+				close(ids.unblock)
+			}
+			assert.Equal(t, tc.expDrained, <-drained)
+			assert.Equal(t, tc.expRPCError, <-rpcErr != nil)
+		})
+	}
+}
+
+// captureStdout returns what is logged to stdout by the function
+func captureStdout(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	f()
+	os.Stdout = stdout
+	assert.Nil(t, writer.Close())
+	output, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return string(output)
+}
+
 func TestLogGRPC(t *testing.T) {
-	t.Logf("TODO:~ TestLogGRPC")
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/CreateVolume"}
+	req := &csi.CreateVolumeRequest{
+		Name:       "volume-1",
+		Secrets:    map[string]string{"api-key": "secret-api-key"},
+		Parameters: map[string]string{EncryptionKey: "crn:v1:bluemix:public:kms:us-south:a/abc:def:key:secret-key-id"},
+	}
+
+	// Request ID is generated and passed to the handler
+	var handlerRequestID string
+	output := captureStdout(t, func() {
+		_, err := logGRPC(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			handlerRequestID = getRequestID(ctx)
+			return &csi.CreateVolumeResponse{}, nil
+		})
+		assert.Nil(t, err)
+	})
+	assert.NotEmpty(t, handlerRequestID)
+	assert.Contains(t, output, `"RequestID":"`+handlerRequestID+`"`)
+	assert.Contains(t, output, `"Method":"/csi.v1.Controller/CreateVolume"`)
+	assert.Contains(t, output, `"Code":"OK"`)
+	assert.Contains(t, output, `"Duration"`)
+	assert.NotContains(t, output, "secret-api-key")
+	assert.NotContains(t, output, "secret-key-id")
+	// the request is logged by the handler only
+	assert.NotContains(t, output, `"msg":"GRPC call"`)
+
+	// Request ID of the caller is kept
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(defaultRequestIDMetadataKey, "tooling-req-42"))
+	output = captureStdout(t, func() {
+		_, err := logGRPC(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			handlerRequestID = getRequestID(ctx)
+			return &csi.CreateVolumeResponse{}, nil
+		})
+		assert.Nil(t, err)
+	})
+	assert.Equal(t, "tooling-req-42", handlerRequestID)
+	assert.Contains(t, output, `"RequestID":"tooling-req-42"`)
+
+	// Error of the handler is returned as is
+	_, err := logGRPC(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "volume not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Request ID of ControllerPublishVolume is used by the node calls
+	stageReq := &csi.NodeStageVolumeRequest{VolumeId: "volume-1", PublishContext: map[string]string{PublishInfoRequestID: "publish-req-7"}}
+	output = captureStdout(t, func() {
+		_, err := logGRPC(context.Background(), stageReq, &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeStageVolume"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &csi.NodeStageVolumeResponse{}, nil
+		})
+		assert.Nil(t, err)
+	})
+	assert.Contains(t, output, `"RequestID":"publish-req-7"`)
 }
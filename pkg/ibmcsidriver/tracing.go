@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelCodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// tracingEndpointEnv is the OTLP/gRPC collector endpoint e.g http://otel-collector:4317, tracing is disabled if empty
+	tracingEndpointEnv = "TRACING_OTLP_ENDPOINT"
+
+	tracerName = "github.com/kubernetes-sigs/ibm-vpc-block-csi-driver"
+
+	controllerServicePrefix = "/csi.v1.Controller/"
+)
+
+// Span attributes of the controller operations
+const (
+	attrRequestID    = attribute.Key("csi.request_id")
+	attrResult       = attribute.Key("csi.result")
+	attrVolumeID     = attribute.Key("vpc.volume_id")
+	attrZone         = attribute.Key("vpc.zone")
+	attrProfile      = attribute.Key("vpc.profile")
+	attrAttachmentID = attribute.Key("vpc.attachment_id")
+	attrSnapshotID   = attribute.Key("vpc.snapshot_id")
+	attrVPCRequestID = attribute.Key("vpc.request_id")
+	attrVPCTrace     = attribute.Key("vpc.trace")
+)
+
+// vpcTracePattern trace ID of the failed VPC API call, as reported in the backend error e.g Trace Code:<id>
+var vpcTracePattern = regexp.MustCompile(`Trace Code:\s*([^,\s]+)`)
+
+// SetupTracing exports the controller operation spans to the configured OTLP endpoint.
+// The returned function flushes and stops the exporter, it is a no-op if tracing is disabled.
+func SetupTracing(logger *zap.Logger, serviceName string, version string) (func(context.Context) error, error) {
+	endpoint := strings.TrimSpace(os.Getenv(tracingEndpointEnv))
+	if endpoint == "" {
+		logger.Info("Tracing disabled", zap.String("Env", tracingEndpointEnv))
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	logger.Info("Tracing enabled", zap.String("Endpoint", redactEndpoint(endpoint)))
+	return tracerProvider.Shutdown, nil
+}
+
+// traceGRPC wraps each controller RPC in a span, other services are not traced
+func traceGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, controllerServicePrefix) {
+		return handler(ctx, req)
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	resp, err := handler(ctx, req)
+	span.SetAttributes(attrResult.String(status.Code(err).String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelCodes.Error, err.Error())
+	}
+	return resp, err
+}
+
+// traceRequestID links the RPC span and the logs of a request, it returns the logger with the trace ID if the request is traced
+func traceRequestID(ctx context.Context, ctxLogger *zap.Logger, requestID string) *zap.Logger {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return ctxLogger
+	}
+	span.SetAttributes(attrRequestID.String(strings.TrimSpace(requestID)))
+	return ctxLogger.With(zap.String("TraceID", span.SpanContext().TraceID().String()))
+}
+
+// startProviderSpan starts a child span of the RPC span around a VPC provider call, with the request ID the provider
+// session sends to the VPC API as X-Request-ID
+func startProviderSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) trace.Span {
+	if requestID := ctx.Value(provider.RequestID); requestID != nil {
+		attrs = append(attrs, attrVPCRequestID.String(fmt.Sprintf("%v", requestID)))
+	}
+	_, span := otel.Tracer(tracerName).Start(ctx, "provider."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return span
+}
+
+// endProviderSpan records the outcome of the provider call, the attributes are added to the RPC span too. A failed
+// call records the trace ID the VPC API returned, the provider library does not expose it on success.
+func endProviderSpan(ctx context.Context, span trace.Span, err error, attrs ...attribute.KeyValue) {
+	defer span.End()
+	span.SetAttributes(attrs...)
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+	if err != nil {
+		span.SetAttributes(attrResult.String("error"))
+		if match := vpcTracePattern.FindStringSubmatch(err.Error()); match != nil {
+			span.SetAttributes(attrVPCTrace.String(match[1]))
+		}
+		span.RecordError(err)
+		span.SetStatus(otelCodes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attrResult.String("success"))
+}
+
+// volumeSpanAttributes ...
+func volumeSpanAttributes(volume *provider.Volume) []attribute.KeyValue {
+	if volume == nil {
+		return nil
+	}
+	attrs := []attribute.KeyValue{attrZone.String(volume.Az)}
+	if volume.VolumeID != "" {
+		attrs = append(attrs, attrVolumeID.String(volume.VolumeID))
+	}
+	if volume.VPCVolume.Profile != nil {
+		attrs = append(attrs, attrProfile.String(volume.VPCVolume.Profile.Name))
+	}
+	return attrs
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	providerError "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+)
+
+func setupInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	oldTracerProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracerProvider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldTracerProvider)
+		_ = tracerProvider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	return attrs
+}
+
+func TestTraceGRPCCreateVolume(t *testing.T) {
+	exporter := setupInMemoryTracing(t)
+	icDriver := initIBMCSIDriver(t)
+	fakeSession, _ := icDriver.cs.CSIProvider.GetProviderSession(context.Background(), icDriver.logger)
+	fakeStructSession := fakeSession.(*fake.FakeSession)
+	fakeStructSession.GetVolumeByNameReturns(nil, nil)
+	fakeStructSession.CreateVolumeReturns(&provider.Volume{VolumeID: "testVolumeID", Az: "us-south-1", VPCVolume: provider.VPCVolume{Profile: &provider.Profile{Name: "general-purpose"}}}, nil)
+
+	req := &csi.CreateVolumeRequest{
+		Name:               "test-volume",
+		CapacityRange:      stdCapRange,
+		VolumeCapabilities: stdVolCap,
+		Parameters:         stdParams,
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/CreateVolume"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return icDriver.cs.CreateVolume(ctx, req.(*csi.CreateVolumeRequest))
+	}
+	_, err := traceGRPC(context.Background(), req, info, handler)
+	assert.Nil(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	spansByName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		spansByName[span.Name] = span
+	}
+
+	providerSpan, ok := spansByName["provider.CreateVolume"]
+	assert.True(t, ok)
+	assert.Equal(t, "success", spanAttributes(providerSpan)[attrResult])
+	assert.NotEmpty(t, spanAttributes(providerSpan)[attrVPCRequestID])
+
+	rpcSpan, ok := spansByName["/csi.v1.Controller/CreateVolume"]
+	assert.True(t, ok)
+	assert.Equal(t, rpcSpan.SpanContext.TraceID(), providerSpan.Parent.TraceID())
+	attrs := spanAttributes(rpcSpan)
+	assert.Equal(t, "OK", attrs[attrResult])
+	assert.Equal(t, "testVolumeID", attrs[attrVolumeID])
+	assert.Equal(t, "us-south-1", attrs[attrZone])
+	assert.Equal(t, "general-purpose", attrs[attrProfile])
+	assert.NotEmpty(t, attrs[attrRequestID])
+}
+
+func TestEndProviderSpanError(t *testing.T) {
+	exporter := setupInMemoryTracing(t)
+	ctx := context.WithValue(context.Background(), provider.RequestID, "req-42")
+	span := startProviderSpan(ctx, "ExpandVolume", attrVolumeID.String("vol-1"))
+	endProviderSpan(ctx, span, providerError.Message{Code: "FailedToExpandVolume", Description: "Trace Code:3f1c2b7a-9d4e, Code:too_many_requests, Description:Too many requests, RC:429"})
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 1, len(spans))
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "error", attrs[attrResult])
+	assert.Equal(t, "req-42", attrs[attrVPCRequestID])
+	assert.Equal(t, "3f1c2b7a-9d4e", attrs[attrVPCTrace])
+
+	// No trace ID reported by the provider library
+	span = startProviderSpan(context.Background(), "ExpandVolume")
+	endProviderSpan(context.Background(), span, errors.New("connection refused"))
+	attrs = spanAttributes(exporter.GetSpans()[1])
+	assert.Equal(t, "error", attrs[attrResult])
+	assert.NotContains(t, attrs, attrVPCRequestID)
+	assert.NotContains(t, attrs, attrVPCTrace)
+}
+
+func TestTraceGRPCSkipsNonControllerMethods(t *testing.T) {
+	exporter := setupInMemoryTracing(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeGetInfo"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_, err := traceGRPC(context.Background(), nil, info, handler)
+	assert.Nil(t, err)
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func TestSetupTracingDisabled(t *testing.T) {
+	t.Setenv(tracingEndpointEnv, "")
+	shutdown, err := SetupTracing(initIBMCSIDriver(t).logger, "mydriver", "test")
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	iksprovider "github.com/IBM/ibmcloud-volume-vpc/iks/provider"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	csiConfig "github.com/kubernetes-sigs/ibm-vpc-block-csi-driver/config"
+)
+
+// userAgentTransport sets the User-Agent header of every request sent through the base transport
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+// RoundTrip ...
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// GetUserAgent returns the user agent of the driver i.e ibm-vpc-block-csi-driver/<version> (cluster/<id>) <suffix>
+func GetUserAgent(vendorVersion string, clusterID string, suffix string) string {
+	userAgent := fmt.Sprintf("%s/%s", csiConfig.CSIDriverGithubName, vendorVersion)
+	if len(clusterID) != 0 {
+		userAgent = fmt.Sprintf("%s (cluster/%s)", userAgent, clusterID)
+	}
+	if suffix = strings.TrimSpace(suffix); len(suffix) != 0 {
+		userAgent = fmt.Sprintf("%s %s", userAgent, suffix)
+	}
+	return userAgent
+}
+
+// SetProviderUserAgent sets the user agent on the HTTP client used by the provider sessions.
+// Provider is shared by the controller and the PV watcher, so both send the same user agent.
+func SetProviderUserAgent(cp *cloudProvider.IBMCloudStorageProvider, userAgent string) error {
+	prov, err := cp.Registry.Get(cp.ProviderName)
+	if err != nil {
+		return err
+	}
+
+	var httpClient *http.Client
+	switch p := prov.(type) {
+	case *vpcprovider.VPCBlockProvider:
+		httpClient = p.APIConfig.HTTPClient
+	case *iksprovider.IksVpcBlockProvider:
+		// Embedded VPC provider shares the HTTP client with the VPC session
+		httpClient = p.APIConfig.HTTPClient
+	}
+	if httpClient == nil {
+		return fmt.Errorf("HTTP client not found for provider %s", cp.ProviderName)
+	}
+
+	base := httpClient.Transport
+	if uaTransport, ok := base.(*userAgentTransport); ok {
+		base = uaTransport.base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = &userAgentTransport{userAgent: userAgent, base: base}
+	return nil
+}
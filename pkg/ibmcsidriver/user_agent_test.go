@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	"github.com/IBM/ibmcloud-volume-vpc/common/registry"
+	"github.com/IBM/ibmcloud-volume-vpc/common/vpcclient/riaas"
+	cloudProvider "github.com/IBM/ibmcloud-volume-vpc/pkg/ibmcloudprovider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUserAgent(t *testing.T) {
+	testCases := []struct {
+		name        string
+		clusterID   string
+		suffix      string
+		expResponse string
+	}{
+		{
+			name:        "With cluster ID and suffix",
+			clusterID:   "cluster-1",
+			suffix:      " team-a ",
+			expResponse: "ibm-vpc-block-csi-driver/v5.2.0 (cluster/cluster-1) team-a",
+		},
+		{
+			name:        "Without cluster ID and suffix",
+			expResponse: "ibm-vpc-block-csi-driver/v5.2.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("Test case: %s", tc.name)
+		assert.Equal(t, tc.expResponse, GetUserAgent("v5.2.0", tc.clusterID, tc.suffix))
+	}
+}
+
+func TestSetProviderUserAgent(t *testing.T) {
+	var receivedUserAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedUserAgent = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	httpClient := server.Client()
+	providerRegistry := &registry.ProviderRegistry{}
+	providerRegistry.Register("vpc", &vpcprovider.VPCBlockProvider{APIConfig: riaas.Config{HTTPClient: httpClient}})
+	cp := &cloudProvider.IBMCloudStorageProvider{ProviderName: "vpc", Registry: providerRegistry}
+
+	userAgent := GetUserAgent("v5.2.0", "cluster-1", "")
+	assert.Nil(t, SetProviderUserAgent(cp, userAgent))
+	// Setting it again replaces the user agent instead of wrapping the transport twice
+	assert.Nil(t, SetProviderUserAgent(cp, userAgent))
+
+	resp, err := httpClient.Get(server.URL)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, userAgent, receivedUserAgent)
+
+	// Unknown provider
+	cp.ProviderName = "unknown"
+	assert.NotNil(t, SetProviderUserAgent(cp, userAgent))
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-vpc/common/vpcclient/models"
+	"golang.org/x/net/context"
+)
+
+// volumeProfileLookup tells whether a volume profile exists in the VPC region of the provider session
+type volumeProfileLookup interface {
+	profileExists(ctx context.Context, session provider.Session, name string) (bool, error)
+}
+
+// vpcProfileClient gets the volume profiles from the VPC API with the IAM access token of the provider session. The
+// VPC API client of the provider has no profile service, so the profiles are looked up this way.
+type vpcProfileClient struct {
+	httpClient *http.Client
+}
+
+// newVPCProfileClient returns the volume profile client
+func newVPCProfileClient() *vpcProfileClient {
+	return &vpcProfileClient{httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// profileExists gets the volume profile from the VPC endpoint of the session, false if the VPC API returns 404
+func (c *vpcProfileClient) profileExists(ctx context.Context, session provider.Session, name string) (bool, error) {
+	vpcSession, ok := getVPCSession(session)
+	if !ok || vpcSession.Config == nil || vpcSession.Config.VPCConfig == nil {
+		return false, fmt.Errorf("no VPC endpoint in the provider session")
+	}
+	creds := vpcSession.ContextCredentials
+	if creds.AuthType != provider.IAMAccessToken || len(creds.Credential) == 0 {
+		return false, fmt.Errorf("no IAM access token in the provider session")
+	}
+	apiVersion := vpcSession.Config.VPCConfig.G2APIVersion
+	if len(apiVersion) == 0 {
+		apiVersion = models.APIVersion
+	}
+	endpoint := strings.TrimSuffix(vpcSession.Config.VPCConfig.G2EndpointURL, "/")
+	query := url.Values{"version": []string{apiVersion}, "generation": []string{"2"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/v1/volume/profiles/"+url.PathEscape(name)+"?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.Credential)
+	if requestID := ctx.Value(provider.RequestID); requestID != nil {
+		req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return false, fmt.Errorf("VPC API returned RC:%d %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
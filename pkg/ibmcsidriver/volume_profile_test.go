@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ibmcsidriver ...
+package ibmcsidriver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	vpcprovider "github.com/IBM/ibmcloud-volume-vpc/block/provider"
+	vpcconfig "github.com/IBM/ibmcloud-volume-vpc/block/vpcconfig"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeVolumeProfileLookup records the profile looked up
+type fakeVolumeProfileLookup struct {
+	name   string
+	exists bool
+	err    error
+}
+
+func (f *fakeVolumeProfileLookup) profileExists(ctx context.Context, session provider.Session, name string) (bool, error) {
+	f.name = name
+	return f.exists, f.err
+}
+
+func TestVPCProfileClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "2024-04-30", r.URL.Query().Get("version"))
+		assert.Equal(t, "req-42", r.Header.Get("X-Request-ID"))
+		switch r.URL.Path {
+		case "/v1/volume/profiles/general-purpose":
+			_, _ = w.Write([]byte(`{"name":"general-purpose","family":"tiered"}`))
+		case "/v1/volume/profiles/unknown":
+			http.Error(w, `{"errors":[{"code":"not_found"}]}`, http.StatusNotFound)
+		default:
+			http.Error(w, `{"errors":[{"code":"internal_error"}]}`, http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := &vpcProfileClient{httpClient: server.Client()}
+	session := &vpcprovider.VPCSession{
+		Config:             &vpcconfig.VPCBlockConfig{VPCConfig: &config.VPCProviderConfig{G2EndpointURL: server.URL + "/", G2APIVersion: "2024-04-30"}},
+		ContextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: "test-token"},
+	}
+	ctx := context.WithValue(context.Background(), provider.RequestID, "req-42")
+
+	exists, err := client.profileExists(ctx, session, "general-purpose")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	exists, err = client.profileExists(ctx, &rateLimitedSession{Session: session}, "unknown")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	_, err = client.profileExists(ctx, session, "broken")
+	assert.ErrorContains(t, err, "RC:500")
+
+	_, err = client.profileExists(ctx, &fake.FakeSession{}, "general-purpose")
+	assert.ErrorContains(t, err, "no VPC endpoint")
+}
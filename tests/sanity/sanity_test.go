@@ -533,14 +533,15 @@ func (c *fakeProviderSession) DeleteSnapshot(snap *provider.Snapshot) error {
 
 // Get the snapshot
 func (c *fakeProviderSession) GetSnapshot(snapshotID string) (*provider.Snapshot, error) {
-	fmt.Println("GetSnapshot", c.snapshots)
-	fmt.Println("snapshotID", snapshotID)
-	fmt.Println("c.snapshots[snapshotID]", c.snapshots[snapshotID])
-	ret, err := c.snapshots[snapshotID]
-	fmt.Println(ret)
-	if !err {
-		fmt.Println("Error")
-		return nil, errors.New("error")
+	ret, ok := c.snapshots[snapshotID]
+	if !ok {
+		errorMsg := providerError.Message{
+			Code:         "SnapshotIDNotFound",
+			Description:  "Snapshot ID not found",
+			Type:         providerError.RetrivalFailed,
+			BackendError: "Trace Code:1, Code:not_found, Description:Snapshot not found, RC:404 Not Found",
+		}
+		return nil, errorMsg
 	}
 	return ret.Snapshot, nil
 }